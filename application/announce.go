@@ -0,0 +1,203 @@
+package application
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/grasparv/go-chromecast/cast"
+)
+
+// playbackState is what the chromecast was doing before an announcement, so
+// it can be restored afterwards.
+type playbackState struct {
+	application *cast.Application
+	volume      *cast.Volume
+	// media and queue are only set if the default media receiver was
+	// playing or paused, the media of other applications can't be reloaded.
+	media *cast.Media
+	queue []cast.QueueItem
+}
+
+// Announce interrupts whatever is playing to play the media, ie: speech or a
+// doorbell sound, and waits for it to finish. Afterwards the previous
+// application is relaunched, or the media the default media receiver was
+// playing is reloaded with its queue at the position it was at. If volume is
+// not 0, the announcement is played at that volume and the previous volume is
+// restored afterwards.
+//
+// Media served by another go-chromecast process is interrupted like any other
+// media, but it is only reloaded if that process is still serving it.
+func (a *Application) Announce(filenameOrUrl, contentType string, volume float32) error {
+	return a.announce(volume, func() error {
+		return a.Load(filenameOrUrl, contentType, false, false)
+	})
+}
+
+// AnnounceMemory is Announce for media held in memory, several items are
+// played as a queue.
+func (a *Application) AnnounceMemory(media []MemoryMedia, volume float32) error {
+	return a.announce(volume, func() error {
+		return a.LoadMemory(media)
+	})
+}
+
+// announce plays the announcement with load, and restores what was
+// playing afterwards.
+func (a *Application) announce(volume float32, load func() error) error {
+	if volume < 0 || volume > 1 {
+		return ErrVolumeOutOfRange
+	}
+	state, err := a.playbackState()
+	if err != nil {
+		return errors.Wrap(err, "unable to get what is playing")
+	}
+
+	if volume != 0 {
+		// A muted device would otherwise stay silent, the previous muting
+		// is restored along with the volume.
+		err = errors.Wrap(a.SetVolume(volume), "unable to set the announcement volume")
+		if err == nil {
+			err = errors.Wrap(a.SetMuted(false), "unable to unmute for the announcement")
+		}
+	}
+	if err == nil {
+		err = load()
+	}
+	if restoreErr := a.restorePlaybackState(state, volume != 0); restoreErr != nil {
+		if err != nil {
+			a.log("unable to restore what was playing: %v", restoreErr)
+			return err
+		}
+		return errors.Wrap(restoreErr, "unable to restore what was playing")
+	}
+	return err
+}
+
+// playbackState returns what the chromecast is currently doing.
+func (a *Application) playbackState() (playbackState, error) {
+	a.application = nil
+	a.media = nil
+	if err := a.Update(); err != nil {
+		return playbackState{}, err
+	}
+	var state playbackState
+	if a.application != nil {
+		app := *a.application
+		state.application = &app
+	}
+	if a.volumeReceiver != nil {
+		volume := *a.volumeReceiver
+		state.volume = &volume
+	}
+
+	if state.application == nil || state.application.AppId != defaultChromecastAppId || a.media == nil {
+		return state, nil
+	}
+	switch a.media.PlayerState {
+	case "PLAYING", "PAUSED", "BUFFERING":
+	default:
+		return state, nil
+	}
+	media := *a.media
+	state.media = &media
+	queue, err := a.QueueItems()
+	if err != nil {
+		a.log("unable to get the queue, only the current media is restored: %v", err)
+	}
+	state.queue = queue
+	return state, nil
+}
+
+// restorePlaybackState puts the chromecast back in the state, the volume
+// is only restored if restoreVolume is set.
+func (a *Application) restorePlaybackState(state playbackState, restoreVolume bool) error {
+	// The volume is restored first so the previous media doesn't start out
+	// at the announcement volume.
+	if restoreVolume && state.volume != nil {
+		if err := a.SetVolume(state.volume.Level); err != nil {
+			return errors.Wrap(err, "unable to restore the volume")
+		}
+		if state.volume.Muted {
+			if err := a.SetMuted(true); err != nil {
+				return errors.Wrap(err, "unable to restore the volume")
+			}
+		}
+	}
+
+	switch payload := restoreRequest(state).(type) {
+	case nil:
+		return nil
+	case *cast.LaunchRequest:
+		if _, err := a.sendAndWaitDefaultRecv(payload); err != nil {
+			return errors.Wrapf(err, "unable to relaunch %s", state.application.DisplayName)
+		}
+		return a.Update()
+	case *cast.LoadMediaCommand, *cast.QueueLoad:
+		if err := a.ensureIsDefaultMediaReceiver(); err != nil {
+			return err
+		}
+		return a.sendMediaRecv(payload)
+	default:
+		return a.sendDefaultRecv(payload)
+	}
+}
+
+// restoreRequest returns the request that puts the chromecast back in the
+// state: a STOP to get back to the idle screen, a LAUNCH of the previous
+// application, or a LOAD or QUEUE_LOAD of the previous media for the default
+// media receiver. It returns nil if there is nothing to restore.
+func restoreRequest(state playbackState) cast.Payload {
+	switch {
+	case state.application == nil || state.application.IsIdleScreen:
+		// Nothing was running, so the default media receiver is stopped
+		// to get back to the idle screen.
+		stop := cast.StopHeader
+		return &stop
+	case state.application.AppId != defaultChromecastAppId:
+		return &cast.LaunchRequest{
+			PayloadHeader: cast.LaunchHeader,
+			AppId:         state.application.AppId,
+		}
+	case state.media == nil:
+		return nil
+	}
+
+	autoplay := state.media.PlayerState != "PAUSED"
+	repeatMode := state.media.RepeatMode
+	if repeatMode == "" {
+		repeatMode = "REPEAT_OFF"
+	}
+	// A LOAD can't repeat or limit the playback duration, so a single item
+	// only uses it when neither needs to be restored.
+	if len(state.queue) == 0 || (len(state.queue) == 1 && repeatMode == "REPEAT_OFF" && state.queue[0].PlaybackDuration == 0) {
+		return &cast.LoadMediaCommand{
+			PayloadHeader: cast.LoadHeader,
+			CurrentTime:   int(state.media.CurrentTime),
+			Autoplay:      autoplay,
+			Media:         state.media.Media,
+		}
+	}
+
+	startIndex := 0
+	for i, item := range state.queue {
+		if item.ItemId == state.media.CurrentItemId {
+			startIndex = i
+		}
+	}
+	items := make([]cast.QueueLoadItem, len(state.queue))
+	for i, item := range state.queue {
+		items[i] = cast.QueueLoadItem{
+			// Only the current media stays paused, the next ones play
+			// once it is unpaused.
+			Autoplay:         autoplay || i != startIndex,
+			Media:            item.Media,
+			PlaybackDuration: item.PlaybackDuration,
+		}
+	}
+	return &cast.QueueLoad{
+		PayloadHeader: cast.QueueLoadHeader,
+		CurrentTime:   state.media.CurrentTime,
+		StartIndex:    startIndex,
+		RepeatMode:    repeatMode,
+		Items:         items,
+	}
+}
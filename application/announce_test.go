@@ -0,0 +1,258 @@
+package application
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grasparv/go-chromecast/cast"
+	pb "github.com/grasparv/go-chromecast/cast/proto"
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+func TestRestoreRequest(t *testing.T) {
+	defaultReceiver := &cast.Application{AppId: defaultChromecastAppId, DisplayName: "Default Media Receiver"}
+	song := func(id string) cast.MediaItem {
+		return cast.MediaItem{ContentId: id, ContentType: "audio/mp3", StreamType: "BUFFERED"}
+	}
+	queue := []cast.QueueItem{
+		{ItemId: 11, Media: song("one")},
+		{ItemId: 12, Media: song("two")},
+		{ItemId: 13, Media: song("three")},
+	}
+	tests := []struct {
+		name  string
+		state playbackState
+		want  cast.Payload
+	}{
+		{
+			name:  "nothing running",
+			state: playbackState{},
+			want:  &cast.PayloadHeader{Type: "STOP"},
+		},
+		{
+			name:  "idle screen",
+			state: playbackState{application: &cast.Application{AppId: "E8C28D3C", IsIdleScreen: true}},
+			want:  &cast.PayloadHeader{Type: "STOP"},
+		},
+		{
+			name:  "another application",
+			state: playbackState{application: &cast.Application{AppId: "CC32E753", DisplayName: "Spotify"}},
+			want:  &cast.LaunchRequest{PayloadHeader: cast.LaunchHeader, AppId: "CC32E753"},
+		},
+		{
+			name:  "default media receiver without media",
+			state: playbackState{application: defaultReceiver},
+			want:  nil,
+		},
+		{
+			name: "single media",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PLAYING", CurrentTime: 42.7, Media: song("one")},
+				queue:       queue[:1],
+			},
+			want: &cast.LoadMediaCommand{PayloadHeader: cast.LoadHeader, CurrentTime: 42, Autoplay: true, Media: song("one")},
+		},
+		{
+			name: "paused single media",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PAUSED", CurrentTime: 5, Media: song("one")},
+			},
+			want: &cast.LoadMediaCommand{PayloadHeader: cast.LoadHeader, CurrentTime: 5, Autoplay: false, Media: song("one")},
+		},
+		{
+			name: "queue",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "BUFFERING", CurrentTime: 12.5, CurrentItemId: 12, Media: song("two")},
+				queue:       queue,
+			},
+			want: &cast.QueueLoad{
+				PayloadHeader: cast.QueueLoadHeader,
+				CurrentTime:   12.5,
+				StartIndex:    1,
+				RepeatMode:    "REPEAT_OFF",
+				Items: []cast.QueueLoadItem{
+					{Autoplay: true, Media: song("one")},
+					{Autoplay: true, Media: song("two")},
+					{Autoplay: true, Media: song("three")},
+				},
+			},
+		},
+		{
+			name: "paused queue",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PAUSED", CurrentTime: 3, CurrentItemId: 13, Media: song("three")},
+				queue:       queue,
+			},
+			want: &cast.QueueLoad{
+				PayloadHeader: cast.QueueLoadHeader,
+				CurrentTime:   3,
+				StartIndex:    2,
+				RepeatMode:    "REPEAT_OFF",
+				Items: []cast.QueueLoadItem{
+					{Autoplay: true, Media: song("one")},
+					{Autoplay: true, Media: song("two")},
+					{Autoplay: false, Media: song("three")},
+				},
+			},
+		},
+		{
+			name: "current item not in the queue",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PLAYING", CurrentItemId: 99, Media: song("other")},
+				queue:       queue[:2],
+			},
+			want: &cast.QueueLoad{
+				PayloadHeader: cast.QueueLoadHeader,
+				RepeatMode:    "REPEAT_OFF",
+				Items: []cast.QueueLoadItem{
+					{Autoplay: true, Media: song("one")},
+					{Autoplay: true, Media: song("two")},
+				},
+			},
+		},
+		{
+			name: "repeated queue",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PLAYING", CurrentItemId: 11, RepeatMode: "REPEAT_ALL_AND_SHUFFLE", Media: song("one")},
+				queue:       queue[:2],
+			},
+			want: &cast.QueueLoad{
+				PayloadHeader: cast.QueueLoadHeader,
+				RepeatMode:    "REPEAT_ALL_AND_SHUFFLE",
+				Items: []cast.QueueLoadItem{
+					{Autoplay: true, Media: song("one")},
+					{Autoplay: true, Media: song("two")},
+				},
+			},
+		},
+		{
+			name: "repeated single media",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PLAYING", CurrentTime: 8, CurrentItemId: 11, RepeatMode: "REPEAT_SINGLE", Media: song("one")},
+				queue:       queue[:1],
+			},
+			want: &cast.QueueLoad{
+				PayloadHeader: cast.QueueLoadHeader,
+				CurrentTime:   8,
+				RepeatMode:    "REPEAT_SINGLE",
+				Items:         []cast.QueueLoadItem{{Autoplay: true, Media: song("one")}},
+			},
+		},
+		{
+			name: "slideshow",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PLAYING", CurrentItemId: 22, RepeatMode: "REPEAT_ALL", Media: song("b.jpg")},
+				queue: []cast.QueueItem{
+					{ItemId: 21, Media: song("a.jpg"), PlaybackDuration: 5},
+					{ItemId: 22, Media: song("b.jpg"), PlaybackDuration: 5},
+				},
+			},
+			want: &cast.QueueLoad{
+				PayloadHeader: cast.QueueLoadHeader,
+				StartIndex:    1,
+				RepeatMode:    "REPEAT_ALL",
+				Items: []cast.QueueLoadItem{
+					{Autoplay: true, Media: song("a.jpg"), PlaybackDuration: 5},
+					{Autoplay: true, Media: song("b.jpg"), PlaybackDuration: 5},
+				},
+			},
+		},
+		{
+			name: "single image",
+			state: playbackState{
+				application: defaultReceiver,
+				media:       &cast.Media{PlayerState: "PLAYING", CurrentItemId: 21, Media: song("a.jpg")},
+				queue:       []cast.QueueItem{{ItemId: 21, Media: song("a.jpg"), PlaybackDuration: 5}},
+			},
+			want: &cast.QueueLoad{
+				PayloadHeader: cast.QueueLoadHeader,
+				RepeatMode:    "REPEAT_OFF",
+				Items:         []cast.QueueLoadItem{{Autoplay: true, Media: song("a.jpg"), PlaybackDuration: 5}},
+			},
+		},
+	}
+	for _, test := range tests {
+		if got := restoreRequest(test.state); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.want, got)
+		}
+	}
+
+	// The request is a copy, sending it doesn't change the shared header.
+	restoreRequest(playbackState{}).SetRequestId(7)
+	if cast.StopHeader.RequestId != 0 {
+		t.Errorf("expected the stop header to be unchanged, got request id %d", cast.StopHeader.RequestId)
+	}
+}
+
+func TestMediaFinishedOnlyForLoadedSession(t *testing.T) {
+	a := NewApplication("", false, true, WithStore(storage.NewMemoryStore()))
+	a.mediaFinished = make(chan bool, 1)
+	a.mediaRequestId = 5
+
+	receive := func(payload string) {
+		a.recvMsgChan <- &pb.CastMessage{PayloadUtf8: &payload}
+	}
+	finished := func() bool {
+		select {
+		case <-a.mediaFinished:
+			return true
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}
+
+	// The previous session is interrupted by the load, before the reply
+	// with the new session arrives.
+	receive(`{"type":"MEDIA_STATUS","requestId":0,"status":[{"mediaSessionId":1,"playerState":"IDLE","idleReason":"INTERRUPTED"}]}`)
+	receive(`{"type":"MEDIA_STATUS","requestId":5,"status":[{"mediaSessionId":2,"playerState":"BUFFERING","media":{"contentId":"announcement"}}]}`)
+	receive(`{"type":"MEDIA_STATUS","requestId":0,"status":[{"mediaSessionId":1,"playerState":"IDLE","idleReason":"FINISHED"}]}`)
+	if finished() {
+		t.Fatalf("expected the previous session not to finish the media")
+	}
+
+	receive(`{"type":"MEDIA_STATUS","requestId":0,"status":[{"mediaSessionId":2,"playerState":"IDLE","idleReason":"FINISHED"}]}`)
+	if !finished() {
+		t.Errorf("expected the loaded session to finish the media")
+	}
+}
+
+func TestMediaFinishedOnLoadErrors(t *testing.T) {
+	for _, messageType := range []string{"LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST"} {
+		a := NewApplication("", false, true, WithStore(storage.NewMemoryStore()))
+		a.mediaFinished = make(chan bool, 1)
+		a.mediaRequestId = 5
+
+		receive := func(requestID int) {
+			payload := fmt.Sprintf(`{"type":%q,"requestId":%d}`, messageType, requestID)
+			a.recvMsgChan <- &pb.CastMessage{PayloadUtf8: &payload}
+		}
+		finished := func() bool {
+			select {
+			case <-a.mediaFinished:
+				return true
+			case <-time.After(100 * time.Millisecond):
+				return false
+			}
+		}
+
+		// Other requests failing, ie: a seek, don't stop the wait.
+		receive(6)
+		if finished() {
+			t.Errorf("%s: expected another request not to finish the media", messageType)
+		}
+		receive(5)
+		if !finished() {
+			t.Errorf("%s: expected the load failing to finish the media", messageType)
+		}
+	}
+}
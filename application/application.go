@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,7 @@ import (
 	"github.com/grasparv/go-chromecast/cast"
 	pb "github.com/grasparv/go-chromecast/cast/proto"
 	castdns "github.com/grasparv/go-chromecast/dns"
+	"github.com/grasparv/go-chromecast/probe"
 	"github.com/grasparv/go-chromecast/storage"
 )
 
@@ -44,12 +46,6 @@ const (
 	namespaceMedia = "urn:x-cast:com.google.cast.media"
 )
 
-type PlayedItem struct {
-	ContentID string `json:"content_id"`
-	Started   int64  `json:"started"`
-	Finished  int64  `json:"finished"`
-}
-
 type CastMessageFunc func(*pb.CastMessage)
 
 type Application struct {
@@ -84,15 +80,73 @@ type Application struct {
 	iface      string
 
 	// NOTE: Currently only playing one media file at a time is handled
-	mediaFinished  chan bool
-	mediaFilenames []string
-
+	mediaFinished chan bool
+	// The request id of the LOAD or QUEUE_LOAD being waited for, and the
+	// media session the chromecast started for it.
+	mediaRequestId int
+	mediaSessionId int
+	// Media that the streaming server is allowed to serve, keyed by a
+	// random per-session token.
+	servedMedia *mediaRegistry
+	// If set, the streaming server will only serve media to requests
+	// coming from the address of the cast device.
+	pinMediaClient bool
+	deviceAddr     string
+	// The model of the cast device, ie: 'Chromecast Ultra', used to work
+	// out which media it can play without transcoding.
+	deviceModel string
+	// group is set when the cast device is a speaker group.
+	group bool
+	// How media that needs transcoding is served to the chromecast.
+	transcodeMode TranscodeMode
+	// Runs and keeps track of the ffmpeg processes.
+	transcoder    *transcoder
+	maxTranscodes int
+	// Optional on-disk cache of transcoded media.
+	transcodeCache *transcodeCache
+	// If set, images are processed to suit the device before being served.
+	images *imageProcessor
+	// The media in the order it was queued on the chromecast, used to
+	// know what to pre-transcode next.
+	queue []*servedMedia
+	// If set, urls are proxied through the streaming server with the
+	// extra headers rather than loaded directly by the chromecast.
+	proxyRemote  bool
+	proxyHeaders http.Header
+	proxyClient  *http.Client
+	// Content-types detected for local files and urls, so each is only
+	// sniffed or requested once in a session.
+	contentTypesMu sync.Mutex
+	contentTypes   map[string]string
+
+	// playedItemsMu guards playedItems, which media requests update
+	// concurrently.
+	playedItemsMu sync.Mutex
 	playedItems   map[string]PlayedItem
 	cacheDisabled bool
-	cache         *storage.Storage
+	cache         storage.Store
+}
+
+// ApplicationOption configures optional behaviour of an Application.
+type ApplicationOption func(*Application)
+
+// WithMediaClientPinning restricts the streaming server to only serve
+// media to the cast device the application is connected to.
+func WithMediaClientPinning(pin bool) ApplicationOption {
+	return func(a *Application) {
+		a.pinMediaClient = pin
+	}
 }
 
-func NewApplication(iface string, debug, cacheDisabled bool) *Application {
+// WithStore sets the store the played items are kept in, by default they
+// are kept in the storage file in the default directory.
+func WithStore(store storage.Store) ApplicationOption {
+	return func(a *Application) {
+		a.cache = store
+	}
+}
+
+func NewApplication(iface string, debug, cacheDisabled bool, opts ...ApplicationOption) *Application {
 	// TODO(grasparv): make cast.Connection an interface, most likely will just need
 	// the Send method
 	// Channel to receive messages from the cast connecttion. 5 is a randomly
@@ -106,9 +160,18 @@ func NewApplication(iface string, debug, cacheDisabled bool) *Application {
 		debug:         debug,
 		cacheDisabled: cacheDisabled,
 		playedItems:   map[string]PlayedItem{},
-		cache:         storage.NewStorage(),
+		contentTypes:  map[string]string{},
 		iface:         iface,
+		servedMedia:   newMediaRegistry(),
+		transcodeMode: TranscodeModeMP4,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.cache == nil {
+		a.cache = storage.NewFileStore("")
 	}
+	a.transcoder = newTranscoder(a.maxTranscodes, a.debug, a.log)
 	// Kick off the listener for asynchronous messages received from the
 	// cast connection.
 	go a.recvMessages()
@@ -150,20 +213,33 @@ func (a *Application) recvMessages() {
 		// This already gets checked in the cast.Connection.handleMessage function.
 		messageType, _ := jsonparser.GetString(messageBytes, "type")
 		switch messageType {
-		case "LOAD_FAILED":
-			a.mediaFinished <- true
+		case "LOAD_FAILED", "LOAD_CANCELLED", "INVALID_REQUEST":
+			// Only the load being waited for failing finishes the media,
+			// not ie: a seek that was refused.
+			if requestID != 0 && int(requestID) == a.mediaRequestId {
+				a.finishMedia()
+			}
 		case "MEDIA_STATUS":
 			resp := cast.MediaStatusResponse{}
 			if err := json.Unmarshal(messageBytes, &resp); err == nil {
 				for _, status := range resp.Status {
+					// The reply to the load has the media session it started.
+					// Only that session finishing is waited for, not ie: the
+					// previous session being interrupted by the load.
+					if requestID != 0 && int(requestID) == a.mediaRequestId {
+						a.mediaSessionId = status.MediaSessionId
+					}
+					if status.MediaSessionId != a.mediaSessionId {
+						continue
+					}
 					// The LoadingItemId is only set when there is a playlist and there
 					// is an item being loaded to play next.
 					if status.IdleReason == "FINISHED" && status.LoadingItemId == 0 {
-						a.mediaFinished <- true
+						a.finishMedia()
 					} else if status.IdleReason == "INTERRUPTED" && status.Media.ContentId == "" {
 						// This can happen when we go "next" in a playlist when it
 						// is playing the last track.
-						a.mediaFinished <- true
+						a.finishMedia()
 					}
 				}
 			}
@@ -179,7 +255,7 @@ func (a *Application) recvMessages() {
 				// it because that currently isn't possible.
 				for _, app := range resp.Status.Applications {
 					if app.AppId != a.application.AppId {
-						a.mediaFinished <- true
+						a.finishMedia()
 					}
 					a.application = &app
 				}
@@ -191,6 +267,17 @@ func (a *Application) recvMessages() {
 	}
 }
 
+// finishMedia signals that the media being waited for has finished playing.
+// It never blocks, the signal is dropped if there is no media being waited
+// for or it has already been signalled, ie: when an announcement switches
+// between applications.
+func (a *Application) finishMedia() {
+	select {
+	case a.mediaFinished <- true:
+	default:
+	}
+}
+
 func (a *Application) SetDebug(debug bool) { a.debug = debug; a.conn.SetDebug(debug) }
 
 func (a *Application) Start(entry castdns.CastDNSEntry) error {
@@ -201,6 +288,13 @@ func (a *Application) Start(entry castdns.CastDNSEntry) error {
 	if err := a.conn.Start(entry.GetAddr(), entry.GetPort()); err != nil {
 		return err
 	}
+	// Use the address we are actually connected to, the entry could contain
+	// a hostname that won't match the address requests come from.
+	if remoteAddr, err := a.conn.RemoteAddr(); err == nil {
+		a.deviceAddr = remoteAddr
+	}
+	a.deviceModel = entry.GetDevice()
+	a.group = castdns.IsGroupEntry(entry)
 	if err := a.sendDefaultConn(&cast.ConnectHeader); err != nil {
 		return errors.Wrap(err, "unable to connect to chromecast")
 	}
@@ -212,20 +306,44 @@ func (a *Application) loadPlayedItems() error {
 		return nil
 	}
 
-	b, err := a.cache.Load("application")
-	if err != nil || len(b) == 0 {
-		return nil
+	playedItems, err := LoadPlayedItems(a.cache)
+	if err != nil {
+		return err
 	}
-	return json.Unmarshal(b, &a.playedItems)
+	a.playedItemsMu.Lock()
+	defer a.playedItemsMu.Unlock()
+	for k, v := range playedItems {
+		a.playedItems[k] = v
+	}
+	return nil
 }
 
-func (a *Application) writePlayedItems() error {
+// writePlayedItem stores the played item. Only this item is merged into the
+// stored ones, so items written by other processes in the meantime are kept.
+func (a *Application) writePlayedItem(item PlayedItem) error {
+	a.playedItemsMu.Lock()
+	a.playedItems[item.ContentID] = item
+	a.playedItemsMu.Unlock()
+
 	if a.cacheDisabled {
 		return nil
 	}
+	return updatePlayedItems(a.cache, func(playedItems map[string]PlayedItem) {
+		playedItems[item.ContentID] = item
+	})
+}
 
-	playedItemsJson, _ := json.Marshal(a.playedItems)
-	return a.cache.Save("application", playedItemsJson)
+// recordPlayed updates the played item for filename with f and stores it,
+// failures are logged as serving the media doesn't depend on them.
+func (a *Application) recordPlayed(filename string, f func(pi *PlayedItem)) {
+	a.playedItemsMu.Lock()
+	pi := a.playedItems[filename]
+	a.playedItemsMu.Unlock()
+	pi.ContentID = filename
+	f(&pi)
+	if err := a.writePlayedItem(pi); err != nil {
+		log.WithField("package", "application").WithError(err).Error("unable to store played items")
+	}
 }
 
 func (a *Application) Update() error {
@@ -257,6 +375,8 @@ func (a *Application) Update() error {
 	a.volumeReceiver = &recvStatus.Status.Volume
 
 	if a.application == nil || a.application.IsIdleScreen {
+		// Nothing is playing, so any media from before is gone.
+		a.media = nil
 		return nil
 	}
 
@@ -273,6 +393,8 @@ func (a *Application) updateMediaStatus() error {
 	if err != nil {
 		return err
 	}
+	// The media session has ended if the receiver no longer reports it.
+	a.media = nil
 	for _, media := range mediaStatus.Status {
 		a.media = &media
 		a.volumeMedia = &media.Volume
@@ -283,6 +405,19 @@ func (a *Application) updateMediaStatus() error {
 func (a *Application) Close() {
 	a.sendMediaConn(&cast.CloseHeader)
 	a.sendDefaultConn(&cast.CloseHeader)
+
+	// The session is over, so none of the media served in it should
+	// be reachable anymore, and nothing should still be transcoding.
+	a.servedMedia.expire()
+	a.transcoder.close()
+	if a.httpServer != nil {
+		a.httpServer.Close()
+	}
+}
+
+// IsGroup returns whether the application is connected to a speaker group.
+func (a *Application) IsGroup() bool {
+	return a.group
 }
 
 func (a *Application) Status() (*cast.Application, *cast.Media, *cast.Volume) {
@@ -451,62 +586,83 @@ func (a *Application) getReceiverStatus() (*cast.ReceiverStatusResponse, error)
 
 }
 
+// QueueItems returns the items in the media queue on the chromecast.
+func (a *Application) QueueItems() ([]cast.QueueItem, error) {
+	if a.media == nil {
+		return nil, ErrNoMediaQueue
+	}
+
+	apiMessage, err := a.sendAndWaitMediaRecv(&cast.QueueGetItems{
+		PayloadHeader:  cast.QueueGetItemIdsHeader,
+		MediaSessionId: a.media.MediaSessionId,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get queue item ids")
+	}
+	var ids cast.QueueItemIdsResponse
+	if err := json.Unmarshal([]byte(*apiMessage.PayloadUtf8), &ids); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling json")
+	}
+	// Media loaded without a queue has no queue items, the current media
+	// is the only item.
+	if len(ids.ItemIds) == 0 {
+		return []cast.QueueItem{{ItemId: a.media.CurrentItemId, Media: a.media.Media}}, nil
+	}
+
+	apiMessage, err = a.sendAndWaitMediaRecv(&cast.QueueGetItems{
+		PayloadHeader:  cast.QueueGetItemsHeader,
+		MediaSessionId: a.media.MediaSessionId,
+		ItemIds:        ids.ItemIds,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get queue items")
+	}
+	var items cast.QueueItemsResponse
+	if err := json.Unmarshal([]byte(*apiMessage.PayloadUtf8), &items); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling json")
+	}
+	return items.Items, nil
+}
+
+// PlayableMediaType returns whether the file is media that can be played
+// on the chromecast, either directly or after transcoding it.
 func (a *Application) PlayableMediaType(filename string) bool {
-	if a.knownFileType(filename) {
+	ct := a.detectContentType(filename)
+	if castableContentTypes[ct] || transcodableContentTypes[ct] {
+		return true
+	}
+	if a.images != nil && convertibleImageContentTypes[imageContentType(filename)] {
 		return true
 	}
 
-	switch path.Ext(filename) {
-	case ".avi":
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".avi", ".mkv":
 		return true
 	}
 
 	return false
 }
 
+// possibleContentType returns the content-type of the media if it is one
+// that the chromecast can play. The contents of local files and the response
+// headers of urls are inspected, the file extension is used as a fallback.
 func (a *Application) possibleContentType(filename string) (string, error) {
-	// TODO(grasparv): Inspect the file for known headers?
-	// Currently we just check the file extension
-
-	// Can use the following from the Go std library
-	// mime.TypesByExtenstion(filepath.Ext(filename))
-	// fs.DetectContentType(data []byte) // needs opened(ish) file
-
-	// URL's can contain url parameters, and path.Ext doesn't
-	// handle it nicely (`.jpg?xxxx....` isn't the extension).
-	// Split the URL by ? and use the left side for extension.
-	if strings.Contains(filename, "://") && strings.Contains(filename, "?") {
-		parts := strings.Split(filename, "?")
-		filename = parts[0]
-	}
-
-	// https://developers.google.com/cast/docs/media
-	switch ext := strings.ToLower(path.Ext(filename)); ext {
-	case ".jpg", ".jpeg":
-		return "image/jpeg", nil
-	case ".gif":
-		return "image/gif", nil
-	case ".bmp":
-		return "image/bmp", nil
-	case ".png":
-		return "image/png", nil
-	case ".webp":
-		return "image/webp", nil
-	case ".mp4", ".m4a", ".m4p":
-		return "video/mp4", nil
-	case ".webm":
-		return "video/webm", nil
-	case ".mp3":
-		return "audio/mp3", nil
-	case ".flac":
-		return "audio/flac", nil
-	case ".wav":
-		return "audio/wav", nil
-	case ".m3u8":
-		return "application/x-mpegURL", nil
-	default:
-		return "", fmt.Errorf("unknown file extension %q", ext)
+	if ct := a.detectContentType(filename); castableContentTypes[ct] {
+		return ct, nil
+	} else if ct != "" {
+		return "", fmt.Errorf("content-type %q of %q can't be played by the chromecast", ct, filename)
 	}
+	return extensionContentType(filename)
+}
+
+// isHLSPlaylist returns whether the media is a HLS playlist, these are
+// played directly and never probed or transcoded.
+func (a *Application) isHLSPlaylist(filename string) bool {
+	switch ct, _ := a.possibleContentType(filename); ct {
+	case "application/x-mpegURL", "application/vnd.apple.mpegurl":
+		return true
+	}
+	return false
 }
 
 func (a *Application) knownFileType(filename string) bool {
@@ -517,13 +673,24 @@ func (a *Application) knownFileType(filename string) bool {
 }
 
 func (a *Application) PlayedItems() map[string]PlayedItem {
-	return a.playedItems
+	a.playedItemsMu.Lock()
+	defer a.playedItemsMu.Unlock()
+	playedItems := make(map[string]PlayedItem, len(a.playedItems))
+	for k, v := range a.playedItems {
+		playedItems[k] = v
+	}
+	return playedItems
 }
 
 func (a *Application) Load(filenameOrUrl, contentType string, transcode, detach bool) error {
 	var mi mediaItem
 	isExternalMedia := false
-	if strings.HasPrefix(filenameOrUrl, "http://") || strings.HasPrefix(filenameOrUrl, "https://") {
+	if filenameOrUrl == stdinFilename {
+		var err error
+		if mi, err = a.serveLiveInput(filenameOrUrl, liveInputStdin, contentType, transcode); err != nil {
+			return errors.Wrap(err, "unable to serve stdin")
+		}
+	} else if isURL(filenameOrUrl) && !a.proxyRemote {
 		isExternalMedia = true
 		if contentType == "" {
 			var err error
@@ -552,28 +719,33 @@ func (a *Application) Load(filenameOrUrl, contentType string, transcode, detach
 		return fmt.Errorf("unable to detach from locally playing media content")
 	}
 
+	// If we should detach from waiting for media to finish playing
+	// this is a url loaded external media, so we can exit early.
+	return a.loadMediaItem(mi, detach)
+}
+
+// loadMediaItem loads a single media item on the chromecast, and unless
+// detach is set waits for it to finish playing.
+func (a *Application) loadMediaItem(mi mediaItem, detach bool) error {
 	if err := a.ensureIsDefaultMediaReceiver(); err != nil {
 		return err
 	}
 
-	// NOTE: This isn't concurrent safe, but it doesn't need to be at the moment!
-	a.mediaFinished = make(chan bool, 1)
-
 	// Send the command to the chromecast
-	a.sendMediaRecv(&cast.LoadMediaCommand{
+	if err := a.sendMediaLoad(&cast.LoadMediaCommand{
 		PayloadHeader: cast.LoadHeader,
 		CurrentTime:   0,
 		Autoplay:      true,
 		Media: cast.MediaItem{
 			ContentId:   mi.contentURL,
-			StreamType:  "BUFFERED",
+			StreamType:  mi.streamType(),
 			ContentType: mi.contentType,
 		},
-	})
+	}); err != nil {
+		return errors.Wrap(err, "unable to load media")
+	}
 
-	// If we should detach from waiting for media to finish playing
-	// and this is a url loaded external media, then we can exit early.
-	if detach && isExternalMedia {
+	if detach {
 		return nil
 	}
 
@@ -582,38 +754,51 @@ func (a *Application) Load(filenameOrUrl, contentType string, transcode, detach
 	return nil
 }
 
-func (a *Application) QueueLoad(filenames []string, contentType string, transcode bool) error {
+// DefaultPlaybackDuration is how long, in seconds, each item in a queue
+// is played for by the commands that play playlists.
+const DefaultPlaybackDuration = 60
 
+// QueueLoad plays the files as a queue on the chromecast, and waits for them
+// to finish playing. Each item is played for playbackDuration seconds, or to
+// its end if playbackDuration is 0.
+func (a *Application) QueueLoad(filenames []string, contentType string, transcode bool, playbackDuration int) error {
 	mediaItems, err := a.loadAndServeFiles(filenames, contentType, transcode)
 	if err != nil {
 		return errors.Wrap(err, "unable to load and serve files")
 	}
 
-	if err := a.ensureIsDefaultMediaReceiver(); err != nil {
-		return err
-	}
-
 	items := make([]cast.QueueLoadItem, len(mediaItems))
 	for i, mi := range mediaItems {
 		items[i] = cast.QueueLoadItem{
 			Autoplay:         true,
-			PlaybackDuration: 60,
+			PlaybackDuration: playbackDuration,
 			Media: cast.MediaItem{
 				ContentId:   mi.contentURL,
-				StreamType:  "BUFFERED",
+				StreamType:  mi.streamType(),
 				ContentType: mi.contentType,
 			},
 		}
 	}
+	return a.queueLoadItems(items)
+}
+
+// queueLoadItems loads the items as a queue on the chromecast, and waits for
+// them to finish playing.
+func (a *Application) queueLoadItems(items []cast.QueueLoadItem) error {
+	if err := a.ensureIsDefaultMediaReceiver(); err != nil {
+		return err
+	}
 
 	// Send the command to the chromecast
-	a.sendMediaRecv(&cast.QueueLoad{
+	if err := a.sendMediaLoad(&cast.QueueLoad{
 		PayloadHeader: cast.QueueLoadHeader,
 		CurrentTime:   0,
 		StartIndex:    0,
 		RepeatMode:    "REPEAT_OFF",
 		Items:         items,
-	})
+	}); err != nil {
+		return errors.Wrap(err, "unable to load queue")
+	}
 
 	// Wait until we have been notified that the media has finished playing
 	<-a.mediaFinished
@@ -638,91 +823,61 @@ func (a *Application) ensureIsDefaultMediaReceiver() error {
 	return nil
 }
 
-func (a *Application) Slideshow(filenames []string, duration int, repeat bool) error {
-	mediaItems, err := a.loadAndServeFiles(filenames, "", false)
-	if err != nil {
-		return errors.Wrap(err, "unable to load and serve files")
-	}
-
-	if err := a.ensureIsDefaultMediaReceiver(); err != nil {
-		return err
-	}
-
-	items := make([]cast.QueueLoadItem, len(mediaItems))
-	for i, mi := range mediaItems {
-		items[i] = cast.QueueLoadItem{
-			Autoplay:         true,
-			PlaybackDuration: duration,
-			Media: cast.MediaItem{
-				ContentId:   mi.contentURL,
-				StreamType:  "BUFFERED",
-				ContentType: mi.contentType,
-			},
-		}
-	}
-
-	var repeatMode string
-	if repeat {
-		repeatMode = "REPEAT_ALL"
-	} else {
-		repeatMode = "REPEAT_OFF"
-	}
-
-	// Send the command to the chromecast
-	a.sendMediaRecv(&cast.QueueLoad{
-		PayloadHeader: cast.QueueLoadHeader,
-		CurrentTime:   0,
-		StartIndex:    0,
-		RepeatMode:    repeatMode,
-		Items:         items,
-	})
-
-	// Timer for when to call the next image
-	t := time.NewTicker(time.Second * time.Duration(duration))
-	i := len(filenames)
-	for {
-		//  If we are not repeating, we need to stop after we have show the last image.
-		if !repeat {
-			if i == 0 {
-				break
-			}
-			i--
-		}
-		select {
-		case <-t.C:
-			if err := a.Update(); err != nil {
-				return err
-			}
-			// This is a hack because I can't work out how to
-			// get the chromecast to automatically change a photo
-			// in a slideshow. There is some documentation that
-			// implies it should be possible but I was not able to make it work.
-			// https://developers.google.com/cast/docs/reference/caf_receiver/cast.framework.messages.QueueItem.html#playbackDuration
-			if err := a.Next(); err != nil {
-				return err
-			}
-		// Media has finished playing
-		case <-a.mediaFinished:
-			return nil
-		}
-	}
-	return nil
-}
-
 type mediaItem struct {
 	filename    string
 	contentType string
 	contentURL  string
 	transcode   bool
+	served      *servedMedia
+}
+
+func (mi mediaItem) streamType() string {
+	// Live inputs have no known duration and can't be seeked.
+	if mi.served != nil && mi.served.input != liveInputNone {
+		return "LIVE"
+	}
+	return "BUFFERED"
 }
 
 func (a *Application) loadAndServeFiles(filenames []string, contentType string, transcode bool) ([]mediaItem, error) {
 	mediaItems := make([]mediaItem, len(filenames))
 	for i, filename := range filenames {
 		transcodeFile := transcode
-		if _, err := os.Stat(filename); err != nil {
+		if isURL(filename) && !a.proxyRemote {
+			// Urls in a playlist are loaded directly by the chromecast
+			// unless they are being proxied.
+			contentTypeToUse := contentType
+			if contentTypeToUse == "" {
+				var err error
+				if contentTypeToUse, err = a.possibleContentType(filename); err != nil {
+					return nil, err
+				}
+			}
+			mediaItems[i] = mediaItem{
+				filename:    filename,
+				contentType: contentTypeToUse,
+				contentURL:  filename,
+			}
+			continue
+		} else if isURL(filename) {
+			// Remote media is proxied, so there is no file to check.
+		} else if _, err := os.Stat(filename); err != nil {
 			return nil, errors.Wrapf(err, "unable to find %q", filename)
 		}
+		if a.images != nil && !isURL(filename) && contentType == "" {
+			if ct := imageContentType(filename); ct != "" && a.images.needsProcessing(filename, ct, a.deviceModel) {
+				served := newServedImage(filename)
+				if err := a.servedMedia.register(served); err != nil {
+					return nil, err
+				}
+				mediaItems[i] = mediaItem{
+					filename:    filename,
+					contentType: "image/jpeg",
+					served:      served,
+				}
+				continue
+			}
+		}
 		/*
 			We can play media for the following:
 
@@ -736,92 +891,176 @@ func (a *Application) loadAndServeFiles(filenames []string, contentType string,
 			return nil, fmt.Errorf("unknown content-type for %q, either specify a content-type or set transcode to true", filename)
 		}
 
+		// Probing the media lets us pick the cheapest way of making it playable
+		// on this device, if ffprobe isn't available we fall back to only
+		// looking at the file extension.
+		var info *probe.MediaInfo
+		if contentType == "" && transcodeFile && !a.isHLSPlaylist(filename) && imageContentType(filename) == "" {
+			var err error
+			if info, err = probe.Probe(filename, a.ffmpegHeaderArgs(filename)...); err != nil {
+				a.log("unable to probe %q, falling back to the file extension: %v", filename, err)
+			}
+		}
+
 		// If we have a content-type specified we should always
 		// attempt to use that
 		contentTypeToUse := contentType
+		profile := fullTranscode
 		if contentType != "" {
+		} else if info != nil {
+			caps := probe.CapabilitiesForModel(a.deviceModel)
+			decision := probe.Decide(info, caps)
+			a.log("using %s for %q on device model %q", decision, filename, a.deviceModel)
+			if decision == probe.DirectPlay && info.ContentType() != "" {
+				contentTypeToUse = info.ContentType()
+				transcodeFile = false
+			} else {
+				profile = profileForDecision(decision, caps)
+				contentTypeToUse = profile.contentType()
+			}
 		} else if knownFileType {
 			// If this is a media file we know the chromecast can play,
 			// then we don't need to transcode it.
 			contentTypeToUse, _ = a.possibleContentType(filename)
 			transcodeFile = false
 		} else if transcodeFile {
-			contentTypeToUse = "video/mp4"
+			contentTypeToUse = profile.contentType()
+		}
+		if contentType == "" && transcodeFile && a.transcodeMode == TranscodeModeHLS {
+			contentTypeToUse = "application/x-mpegURL"
 		}
 
+		// Register the filename with the media that go-chromecast will serve.
+		served := newServedMedia(filename, transcodeFile, a.transcodeMode == TranscodeModeHLS, profile)
+		if err := a.servedMedia.register(served); err != nil {
+			return nil, err
+		}
 		mediaItems[i] = mediaItem{
 			filename:    filename,
 			contentType: contentTypeToUse,
 			transcode:   transcodeFile,
+			served:      served,
 		}
-		// Add the filename to the list of filenames that go-chromecast will serve.
-		a.mediaFilenames = append(a.mediaFilenames, filename)
 	}
 
+	if err := a.serveMediaItems(mediaItems); err != nil {
+		return nil, err
+	}
+	a.recordServedMedia(mediaItems)
+
+	a.queue = make([]*servedMedia, len(mediaItems))
+	for i, mi := range mediaItems {
+		a.queue[i] = mi.served
+	}
+	return mediaItems, nil
+}
+
+// serveMediaItems starts the streaming server if needed, and sets the url
+// that the chromecast can load each media item from.
+func (a *Application) serveMediaItems(mediaItems []mediaItem) error {
 	localIP, err := a.getLocalIP()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	a.log("local IP address: %s", localIP)
 
 	a.log("starting streaming server...")
 	// Start server to serve the media
 	if err := a.startStreamingServer(); err != nil {
-		return nil, errors.Wrap(err, "unable to start streaming server")
+		return errors.Wrap(err, "unable to start streaming server")
 	}
 	a.log("started streaming server")
 
 	// We can only set the content url after the server has started, otherwise we have
 	// no way to know the port used.
 	for i, m := range mediaItems {
-		mediaItems[i].contentURL = fmt.Sprintf("http://%s:%d?media_file=%s&live_streaming=%t", localIP, a.serverPort, m.filename, m.transcode)
+		if m.served == nil {
+			continue
+		}
+		mediaItems[i].contentURL = fmt.Sprintf("http://%s%s", net.JoinHostPort(localIP, strconv.Itoa(a.serverPort)), m.served.path())
 	}
-
-	return mediaItems, nil
+	return nil
 }
 
+// getLocalIP returns the local address the chromecast should use to reach
+// the media server. It is on the same subnet, or failing that the same
+// address family, as the chromecast.
 func (a *Application) getLocalIP() (string, error) {
 	if a.localIP != "" {
 		return a.localIP, nil
 	}
 
+	remoteAddr, err := a.conn.RemoteAddr()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get remote addr from cast connection")
+	}
+	remoteIP := net.ParseIP(stripZone(remoteAddr))
+
 	// If we aren't looking for an address on a certain network
-	// interface, then we can use the local address of the connection.
+	// interface, then we can use the local address of the connection,
+	// the system has already picked it to route to the chromecast.
 	if a.iface == "" {
-		var err error
-		a.localIP, err = a.conn.LocalAddr()
-		return a.localIP, errors.Wrap(err, "unable to get local addr from cast connection")
+		localAddr, err := a.conn.LocalAddr()
+		if err != nil {
+			return "", errors.Wrap(err, "unable to get local addr from cast connection")
+		}
+		a.localIP = stripZone(localAddr)
+		return a.localIP, nil
 	}
 
-	ifs, err := net.Interfaces()
+	iface, err := net.InterfaceByName(a.iface)
 	if err != nil {
-		return "", errors.Wrap(err, "unable to get network interfaces")
-	}
-	var foundIface net.Interface
-	for _, i := range ifs {
-		if i.Name == a.iface {
-			foundIface = i
-			break
-		}
-	}
-	if foundIface.Name == "" {
 		return "", fmt.Errorf("no network interface with name %q exists", a.iface)
 	}
-	addrs, err := foundIface.Addrs()
+	addrs, err := iface.Addrs()
 	if err != nil {
 		return "", err
 	}
+	ip := chooseLocalIP(addrs, remoteIP)
+	if ip == nil {
+		return "", fmt.Errorf("no address on network interface %q can reach %s", a.iface, remoteAddr)
+	}
+	a.localIP = ip.String()
+	return a.localIP, nil
+}
+
+// chooseLocalIP returns the address from addrs that is best used to reach
+// remote. An address on the same subnet is preferred, then one of the same
+// address family that isn't link-local.
+func chooseLocalIP(addrs []net.Addr, remote net.IP) net.IP {
+	var sameFamily, linkLocal net.IP
 	for _, addr := range addrs {
-		if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-			// TODO(grasparv): Fallback to ipv6 if ipv4 fails? Or maybe do the other
-			// way around? I am unsure if chromecast supports ipv6???
-			if ipnet.IP.To4() != nil {
-				a.localIP = ipnet.IP.String()
-				return a.localIP, nil
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || (ipnet.IP.IsLoopback() && !remote.IsLoopback()) {
+			continue
+		}
+		if (ipnet.IP.To4() == nil) != (remote.To4() == nil) {
+			continue
+		}
+		switch {
+		case ipnet.Contains(remote):
+			return ipnet.IP
+		case ipnet.IP.IsLinkLocalUnicast():
+			if linkLocal == nil {
+				linkLocal = ipnet.IP
 			}
+		case sameFamily == nil:
+			sameFamily = ipnet.IP
 		}
 	}
-	return "", fmt.Errorf("Failed to get local ip address")
+	if sameFamily != nil {
+		return sameFamily
+	}
+	return linkLocal
+}
+
+// stripZone removes the zone from an IPv6 address, ie: 'fe80::1%eth0'. The
+// zone only means something on this machine, so it can't be in a url.
+func stripZone(addr string) string {
+	if i := strings.LastIndex(addr, "%"); i >= 0 {
+		return addr[:i]
+	}
+	return addr
 }
 
 func (a *Application) startStreamingServer() error {
@@ -838,48 +1077,9 @@ func (a *Application) startStreamingServer() error {
 	a.serverPort = listener.Addr().(*net.TCPAddr).Port
 	a.log("found available port :%d", a.serverPort)
 
-	a.httpServer = &http.Server{}
-
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Check to see if we have a 'filename' and if it is one of the ones that have
-		// already been validated and is useable.
-		filename := r.URL.Query().Get("media_file")
-		canServe := false
-		for _, fn := range a.mediaFilenames {
-			if fn == filename {
-				canServe = true
-			}
-		}
-
-		a.playedItems[filename] = PlayedItem{ContentID: filename, Started: time.Now().Unix()}
-		a.writePlayedItems()
-
-		// Check to see if this is a live streaming video and we need to use an
-		// infinite range request / response. This comes from media that is either
-		// live or currently being transcoded to a different media format.
-		liveStreaming := false
-		if ls := r.URL.Query().Get("live_streaming"); ls == "true" {
-			liveStreaming = true
-		}
-
-		a.log("canServe=%t, liveStreaming=%t, filename=%s", canServe, liveStreaming, filename)
-		if canServe {
-			if !liveStreaming {
-				http.ServeFile(w, r, filename)
-			} else {
-				a.serveLiveStreaming(w, r, filename)
-			}
-		} else {
-			http.Error(w, "Invalid file", 400)
-		}
-		a.log("method=%s, headers=%v, reponse_headers=%v", r.Method, r.Header, w.Header())
-		pi := a.playedItems[filename]
-
-		// TODO(grasparv): make this a pointer?
-		pi.Finished = time.Now().Unix()
-		a.playedItems[filename] = pi
-		a.writePlayedItems()
-	})
+	mux := http.NewServeMux()
+	mux.HandleFunc(mediaPathPrefix, a.serveMedia)
+	a.httpServer = &http.Server{Handler: mux}
 
 	go func() {
 		a.log("media server listening on %d", a.serverPort)
@@ -891,29 +1091,137 @@ func (a *Application) startStreamingServer() error {
 	return nil
 }
 
-func (a *Application) serveLiveStreaming(w http.ResponseWriter, r *http.Request, filename string) {
-	cmd := exec.Command(
-		"ffmpeg",
-		"-re", // encode at 1x playback speed, to not burn the CPU
-		"-i", filename,
-		"-vcodec", "h264",
-		"-acodec", "aac",
-		"-ac", "2", // chromecasts don't support more than two audio channels
+func (a *Application) serveMedia(w http.ResponseWriter, r *http.Request) {
+	if a.pinMediaClient {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if host != a.deviceAddr {
+			a.log("refusing to serve media to %s, only %s is allowed", r.RemoteAddr, a.deviceAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Check to see if the token is one that has been registered for this
+	// session, if it is then the file has already been validated and is useable.
+	m, name, err := a.servedMedia.lookup(r.URL.Path)
+	if err != nil {
+		a.log("unable to serve %s: %v", r.URL.Path, err)
+		http.Error(w, "Invalid file", http.StatusNotFound)
+		return
+	}
+	filename := m.filename
+
+	// Media held in memory has no file to add to the played items.
+	if m.data != nil {
+		a.serveMemory(w, r, m)
+		return
+	}
+
+	// HLS segments are requested continuously while the media plays, so
+	// only the playlist request marks the media as started. The next items
+	// in the queue are prefetched once, not on every range request.
+	segment, isSegment := hlsSegmentIndex(name)
+	isSegment = isSegment && m.hls && name != m.name
+	if name == m.name && m.markStarted() {
+		a.prefetchAfter(m)
+		a.recordPlayed(filename, func(pi *PlayedItem) {
+			*pi = PlayedItem{ContentID: filename, Started: time.Now().Unix()}
+		})
+	}
+
+	// Check to see if this is a live streaming video and we need to use an
+	// infinite range request / response. This comes from media that is either
+	// live or currently being transcoded to a different media format.
+	a.log("liveStreaming=%t, hls=%t, filename=%s", m.transcode, m.hls, filename)
+	switch {
+	case m.image:
+		a.serveImage(w, r, m)
+	case m.input == liveInputStdin && !m.transcode:
+		a.serveStdin(w, r, m)
+	case m.remote && !m.transcode:
+		a.serveRemote(w, r, m, name)
+	case !m.transcode:
+		a.serveFile(w, r, filename)
+	case isSegment:
+		a.serveHLSSegment(w, r, m, segment)
+	case m.hls:
+		a.serveHLSPlaylist(w, r, filename)
+	default:
+		a.serveLiveStreaming(w, r, m)
+	}
+	a.log("method=%s, headers=%v, reponse_headers=%v", r.Method, r.Header, w.Header())
+	if now := time.Now(); m.finishedDue(now) {
+		a.recordPlayed(filename, func(pi *PlayedItem) {
+			pi.Finished = now.Unix()
+		})
+	}
+}
+
+func (a *Application) serveFile(w http.ResponseWriter, r *http.Request, filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		http.Error(w, "Unable to open file", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Unable to stat file", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, fileInfo.Name(), fileInfo.ModTime(), f)
+}
+
+func (a *Application) serveLiveStreaming(w http.ResponseWriter, r *http.Request, m *servedMedia) {
+	filename := m.filename
+
+	// If the media has been transcoded before it can be served from the
+	// cache, otherwise the transcoded output is also written to the cache.
+	var cacheKey string
+	var cacheFile *os.File
+	if a.transcodeCache.cacheable(m) {
+		if key, err := a.transcodeCache.key(m); err != nil {
+			a.log("unable to get transcode cache key for %q: %v", filename, err)
+		} else if cached, ok := a.transcodeCache.lookup(key); ok {
+			a.log("serving %q from transcode cache", filename)
+			a.serveFile(w, r, cached)
+			return
+		} else if f, ok, err := a.transcodeCache.create(key); err != nil {
+			a.log("unable to write %q to transcode cache: %v", filename, err)
+		} else if ok {
+			cacheKey, cacheFile = key, f
+		}
+	}
+
+	args := a.ffmpegInputArgs(m)
+	args = append(args, m.profile.codecArgs()...)
+	args = append(args,
 		"-f", "mp4",
 		"-movflags", "frag_keyframe+faststart",
 		"-strict", "-experimental",
 		"pipe:1",
 	)
-
-	cmd.Stdout = w
-	if a.debug {
-		cmd.Stderr = os.Stderr
+	var stdout io.Writer = w
+	if cacheFile != nil {
+		stdout = io.MultiWriter(w, cacheFile)
+	}
+	var stdin io.Reader
+	if m.input == liveInputStdin {
+		stdin = m.stdin.reader(r.Context())
 	}
 
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Transfer-Encoding", "chunked")
 
-	if err := cmd.Run(); err != nil {
+	// ffmpeg is stopped as soon as the chromecast closes the connection.
+	err := a.transcoder.run(r.Context(), filename, args, stdin, stdout)
+	if cacheFile != nil {
+		// Only a complete transcode is added to the cache, if the chromecast
+		// stopped reading part way through the output is incomplete.
+		a.transcodeCache.commit(cacheKey, cacheFile, err == nil)
+	}
+	if err != nil && err != r.Context().Err() {
 		log.WithField("package", "application").WithFields(logrus.Fields{
 			"filename": filename,
 		}).WithError(err).Error("error transcoding")
@@ -988,6 +1296,22 @@ func (a *Application) sendMediaRecv(payload cast.Payload) error {
 	return err
 }
 
+// sendMediaLoad sends a LOAD or QUEUE_LOAD, and starts waiting for the media
+// session it starts to finish.
+func (a *Application) sendMediaLoad(payload cast.Payload) error {
+	if a.application == nil {
+		return ErrApplicationNotSet
+	}
+	// NOTE: This isn't concurrent safe, but it doesn't need to be at the moment!
+	a.mediaFinished = make(chan bool, 1)
+	a.mediaSessionId = 0
+	// The request id has to be known before the reply can arrive.
+	requestID += 1
+	a.mediaRequestId = requestID
+	payload.SetRequestId(requestID)
+	return a.conn.Send(requestID, payload, defaultSender, a.application.TransportId, namespaceMedia)
+}
+
 func (a *Application) sendAndWaitDefaultConn(payload cast.Payload) (*pb.CastMessage, error) {
 	return a.sendAndWait(payload, defaultSender, defaultRecv, namespaceConn)
 }
@@ -0,0 +1,95 @@
+package application
+
+import (
+	"net"
+	"testing"
+)
+
+func TestChooseLocalIP(t *testing.T) {
+	addrs := func(cidrs ...string) []net.Addr {
+		var addrs []net.Addr
+		for _, cidr := range cidrs {
+			ip, ipnet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ipnet.IP = ip
+			addrs = append(addrs, ipnet)
+		}
+		return addrs
+	}
+
+	tests := []struct {
+		name   string
+		addrs  []net.Addr
+		remote string
+		want   string
+	}{
+		{
+			name:   "same subnet",
+			addrs:  addrs("127.0.0.1/8", "10.0.0.2/24", "192.168.1.2/24", "fe80::2/64"),
+			remote: "192.168.1.20",
+			want:   "192.168.1.2",
+		},
+		{
+			name:   "same family",
+			addrs:  addrs("127.0.0.1/8", "fe80::2/64", "10.0.0.2/24"),
+			remote: "192.168.1.20",
+			want:   "10.0.0.2",
+		},
+		{
+			name:   "ipv6 link-local subnet",
+			addrs:  addrs("10.0.0.2/24", "2001:db8::2/64", "fe80::2/64"),
+			remote: "fe80::20",
+			want:   "fe80::2",
+		},
+		{
+			name:   "global ipv6 before link-local",
+			addrs:  addrs("fe80::2/64", "2001:db8::2/64"),
+			remote: "2001:db8:1::20",
+			want:   "2001:db8::2",
+		},
+		{
+			name:   "only link-local",
+			addrs:  addrs("fe80::2/64", "fe80::3/64"),
+			remote: "2001:db8:1::20",
+			want:   "fe80::2",
+		},
+		{
+			name:   "loopback for loopback",
+			addrs:  addrs("127.0.0.1/8", "10.0.0.2/24"),
+			remote: "127.0.0.1",
+			want:   "127.0.0.1",
+		},
+		{
+			name:   "no address of the family",
+			addrs:  addrs("127.0.0.1/8", "fe80::2/64"),
+			remote: "192.168.1.20",
+		},
+		{
+			name:   "not an ip network",
+			addrs:  []net.Addr{&net.IPAddr{IP: net.ParseIP("192.168.1.2")}},
+			remote: "192.168.1.20",
+		},
+	}
+	for _, test := range tests {
+		got := chooseLocalIP(test.addrs, net.ParseIP(test.remote))
+		if (got == nil && test.want != "") || (got != nil && got.String() != test.want) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestStripZone(t *testing.T) {
+	tests := map[string]string{
+		"fe80::1%eth0": "fe80::1",
+		"2001:db8::1":  "2001:db8::1",
+		"192.168.1.2":  "192.168.1.2",
+		"":             "",
+	}
+	for addr, want := range tests {
+		if got := stripZone(addr); got != want {
+			t.Errorf("%q: expected %q, got %q", addr, want, got)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// Number of bytes read from the start of a file to detect its content-type.
+	sniffLen = 512
+
+	remoteContentTypeTimeout = time.Second * 5
+)
+
+var (
+	// Content-types that the default media receiver is able to play.
+	// https://developers.google.com/cast/docs/media
+	castableContentTypes = map[string]bool{
+		"image/jpeg":                    true,
+		"image/gif":                     true,
+		"image/bmp":                     true,
+		"image/png":                     true,
+		"image/webp":                    true,
+		"video/mp4":                     true,
+		"audio/mp4":                     true,
+		"video/webm":                    true,
+		"audio/webm":                    true,
+		"audio/mp3":                     true,
+		"audio/mpeg":                    true,
+		"audio/aac":                     true,
+		"audio/flac":                    true,
+		"audio/wav":                     true,
+		"audio/ogg":                     true,
+		"application/x-mpegURL":         true,
+		"application/vnd.apple.mpegurl": true,
+	}
+
+	// Content-types that can't be played by the chromecast, but can be
+	// transcoded with ffmpeg into something that can.
+	transcodableContentTypes = map[string]bool{
+		"video/x-matroska": true,
+		"video/x-msvideo":  true,
+		"video/quicktime":  true,
+		"video/mp2t":       true,
+	}
+)
+
+// sniffContentType detects the content-type of media from the first
+// bytes of its data, returning an empty string if it can't be determined.
+func sniffContentType(b []byte) string {
+	switch {
+	case len(b) >= 12 && bytes.Equal(b[4:8], []byte("ftyp")):
+		switch string(b[8:12]) {
+		case "M4A ", "M4B ", "M4P ":
+			return "audio/mp4"
+		case "heic", "heix", "heim", "heis", "hevc", "mif1", "msf1":
+			return "image/heic"
+		case "qt  ":
+			return "video/quicktime"
+		}
+		return "video/mp4"
+	case bytes.HasPrefix(b, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		// Matroska and WebM share the same EBML header, the DocType
+		// element near the start tells them apart.
+		if bytes.Contains(b, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	case bytes.HasPrefix(b, []byte("ID3")):
+		return "audio/mp3"
+	case bytes.HasPrefix(b, []byte("fLaC")):
+		return "audio/flac"
+	case len(b) >= 12 && bytes.HasPrefix(b, []byte("RIFF")):
+		switch string(b[8:12]) {
+		case "WAVE":
+			return "audio/wav"
+		case "AVI ":
+			return "video/x-msvideo"
+		case "WEBP":
+			return "image/webp"
+		}
+	case bytes.HasPrefix(b, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(b, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(b, []byte("GIF87a")), bytes.HasPrefix(b, []byte("GIF89a")):
+		return "image/gif"
+	case bytes.HasPrefix(b, []byte("II*\x00")), bytes.HasPrefix(b, []byte("MM\x00*")):
+		return "image/tiff"
+	case bytes.HasPrefix(b, []byte("BM")) && len(b) >= 14:
+		return "image/bmp"
+	case bytes.HasPrefix(b, []byte("#EXTM3U")):
+		return "application/x-mpegURL"
+	case len(b) > 188 && b[0] == 0x47 && b[188] == 0x47:
+		return "video/mp2t"
+	case len(b) >= 2 && b[0] == 0xFF && b[1]&0xF6 == 0xF0:
+		// ADTS header, raw AAC audio.
+		return "audio/aac"
+	case len(b) >= 2 && b[0] == 0xFF && b[1]&0xE0 == 0xE0 && b[1]&0x06 != 0:
+		// MPEG audio frame sync without an ID3 tag.
+		return "audio/mp3"
+	}
+	return ""
+}
+
+// sniffFileContentType reads the start of a local file to detect its
+// content-type, returning an empty string if it can't be determined.
+func sniffFileContentType(filename string) string {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	b := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	b = b[:n]
+
+	// ID3 tags can be prepended to more than just mp3 files, ie: flac and
+	// aac, so skip over the tag and look at what comes after it.
+	if n >= 10 && bytes.HasPrefix(b, []byte("ID3")) {
+		// The tag size is a 28 bit 'syncsafe' integer.
+		size := int64(b[6])<<21 | int64(b[7])<<14 | int64(b[8])<<7 | int64(b[9])
+		after := make([]byte, sniffLen)
+		if n, err := f.ReadAt(after, 10+size); err == nil || err == io.EOF {
+			if ct := sniffContentType(after[:n]); ct != "" {
+				return ct
+			}
+		}
+	}
+	return sniffContentType(b)
+}
+
+// remoteContentType asks the server hosting the url for the content-type
+// of the media, returning an empty string if it can't be determined.
+func remoteContentType(url string, headers http.Header, client *http.Client) string {
+	ctx, cancel := context.WithTimeout(context.Background(), remoteContentTypeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return ""
+	}
+	req = req.WithContext(ctx)
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// extensionContentType returns the content-type for a filename or url
+// based only on its extension.
+func extensionContentType(filename string) (string, error) {
+	// URL's can contain url parameters, and path.Ext doesn't
+	// handle it nicely (`.jpg?xxxx....` isn't the extension).
+	// Split the URL by ? and use the left side for extension.
+	if strings.Contains(filename, "://") && strings.Contains(filename, "?") {
+		parts := strings.Split(filename, "?")
+		filename = parts[0]
+	}
+
+	// https://developers.google.com/cast/docs/media
+	switch ext := strings.ToLower(path.Ext(filename)); ext {
+	case ".jpg", ".jpeg":
+		return "image/jpeg", nil
+	case ".gif":
+		return "image/gif", nil
+	case ".bmp":
+		return "image/bmp", nil
+	case ".png":
+		return "image/png", nil
+	case ".webp":
+		return "image/webp", nil
+	case ".mp4", ".m4a", ".m4p":
+		return "video/mp4", nil
+	case ".webm":
+		return "video/webm", nil
+	case ".mp3":
+		return "audio/mp3", nil
+	case ".flac":
+		return "audio/flac", nil
+	case ".wav":
+		return "audio/wav", nil
+	case ".m3u8":
+		return "application/x-mpegURL", nil
+	default:
+		return "", fmt.Errorf("unknown file extension %q", ext)
+	}
+}
+
+func isURL(filenameOrUrl string) bool {
+	return strings.HasPrefix(filenameOrUrl, "http://") || strings.HasPrefix(filenameOrUrl, "https://")
+}
+
+// detectContentType returns the content-type of a local file or url,
+// preferring what the file or server says over the file extension. The
+// result is cached, as it is asked for several times for each item loaded.
+func (a *Application) detectContentType(filenameOrUrl string) string {
+	a.contentTypesMu.Lock()
+	ct, ok := a.contentTypes[filenameOrUrl]
+	a.contentTypesMu.Unlock()
+	if ok {
+		return ct
+	}
+	ct = a.detectContentTypeUncached(filenameOrUrl)
+	a.contentTypesMu.Lock()
+	a.contentTypes[filenameOrUrl] = ct
+	a.contentTypesMu.Unlock()
+	return ct
+}
+
+func (a *Application) detectContentTypeUncached(filenameOrUrl string) string {
+	var ct string
+	if isURL(filenameOrUrl) {
+		client := http.DefaultClient
+		if a.proxyClient != nil {
+			client = a.proxyClient
+		}
+		ct = remoteContentType(filenameOrUrl, a.proxyHeaders, client)
+	} else {
+		ct = sniffFileContentType(filenameOrUrl)
+	}
+	if castableContentTypes[ct] || transcodableContentTypes[ct] {
+		return ct
+	}
+	ct, _ = extensionContentType(filenameOrUrl)
+	return ct
+}
@@ -0,0 +1,94 @@
+package application
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"mp4", "\x00\x00\x00\x20ftypisom\x00\x00\x02\x00", "video/mp4"},
+		{"m4a", "\x00\x00\x00\x20ftypM4A \x00\x00\x02\x00", "audio/mp4"},
+		{"heic", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00", "image/heic"},
+		{"quicktime", "\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00", "video/quicktime"},
+		{"webm", "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\x82\x84webm", "video/webm"},
+		{"matroska", "\x1a\x45\xdf\xa3\xa3\x42\x86\x81\x01\x42\x82\x88matroska", "video/x-matroska"},
+		{"id3", "ID3\x04\x00\x00\x00\x00\x00\x00", "audio/mp3"},
+		{"mpeg frame sync", "\xff\xfb\x90\x64", "audio/mp3"},
+		{"adts", "\xff\xf1\x50\x80", "audio/aac"},
+		{"flac", "fLaC\x00\x00\x00\x22", "audio/flac"},
+		{"wav", "RIFF\x24\x00\x00\x00WAVEfmt ", "audio/wav"},
+		{"avi", "RIFF\x24\x00\x00\x00AVI LIST", "video/x-msvideo"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", "image/webp"},
+		{"unknown riff", "RIFF\x24\x00\x00\x00CDDAfmt ", ""},
+		{"ogg", "OggS\x00\x02\x00\x00", "audio/ogg"},
+		{"jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF", "image/jpeg"},
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR", "image/png"},
+		{"gif87a", "GIF87a\x01\x00", "image/gif"},
+		{"gif89a", "GIF89a\x01\x00", "image/gif"},
+		{"tiff little endian", "II*\x00\x08\x00\x00\x00", "image/tiff"},
+		{"tiff big endian", "MM\x00*\x00\x00\x00\x08", "image/tiff"},
+		{"bmp", "BM\x36\x00\x0c\x00\x00\x00\x00\x00\x36\x00\x00\x00", "image/bmp"},
+		{"hls", "#EXTM3U\n#EXT-X-VERSION:3\n", "application/x-mpegURL"},
+		{"mpeg-ts", "\x47" + strings.Repeat("\x00", 187) + "\x47\x00", "video/mp2t"},
+		{"text", "hello world", ""},
+		{"short ftyp", "\x00\x00\x00\x20fty", ""},
+		{"empty", "", ""},
+	}
+	for _, test := range tests {
+		if got := sniffContentType([]byte(test.data)); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestSniffFileContentTypeSkipsID3(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A 16 byte ID3 tag in front of flac audio.
+	filename := filepath.Join(dir, "tagged.flac")
+	data := "ID3\x04\x00\x00\x00\x00\x00\x10" + strings.Repeat("\x00", 16) + "fLaC\x00\x00\x00\x22"
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := sniffFileContentType(filename); got != "audio/flac" {
+		t.Errorf("expected audio/flac, got %q", got)
+	}
+}
+
+func TestDetectContentTypeIsCached(t *testing.T) {
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	}))
+	defer s.Close()
+
+	a := NewApplication("", false, true, WithStore(storage.NewMemoryStore()))
+	url := s.URL + "/live/stream"
+	if !a.PlayableMediaType(url) || !a.knownFileType(url) || !a.isHLSPlaylist(url) {
+		t.Errorf("expected %s to be a playable HLS playlist", url)
+	}
+	if _, err := a.possibleContentType(url); err != nil {
+		t.Error(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("expected 1 request for the content-type, got %d", n)
+	}
+}
@@ -7,6 +7,7 @@ var (
 	ErrMediaNotYetInitialised = errors.New("media not yet initialised")
 	ErrNoMediaNext            = errors.New("media not yet initialised, there is nothing to go to next")
 	ErrNoMediaPause           = errors.New("media not yet initialised, there is nothing to pause")
+	ErrNoMediaQueue           = errors.New("media not yet initialised, there is no queue")
 	ErrNoMediaPrevious        = errors.New("media not yet initialised, there is nothing previous")
 	ErrNoMediaSkip            = errors.New("media not yet initialised, there is nothing to skip")
 	ErrNoMediaStop            = errors.New("media not yet initialised, there is nothing to stop")
@@ -0,0 +1,91 @@
+package application
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+// playedItemsKey is the storage key of the played items.
+const playedItemsKey = "application"
+
+// PlayedItem records when local media was last played. Started and Finished
+// are unix timestamps, Finished is zero if the media never finished.
+type PlayedItem struct {
+	ContentID string `json:"content_id"`
+	Started   int64  `json:"started"`
+	Finished  int64  `json:"finished"`
+}
+
+// StartedAt returns when the media was started.
+func (p PlayedItem) StartedAt() time.Time {
+	return unixTime(p.Started)
+}
+
+// FinishedAt returns when the media finished, or the zero time if it never
+// did.
+func (p PlayedItem) FinishedAt() time.Time {
+	return unixTime(p.Finished)
+}
+
+// LastPlayed returns when the media was last started or finished.
+func (p PlayedItem) LastPlayed() time.Time {
+	if p.Finished > p.Started {
+		return p.FinishedAt()
+	}
+	return p.StartedAt()
+}
+
+func unixTime(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0)
+}
+
+// LoadPlayedItems returns the played items kept in store, by content id.
+func LoadPlayedItems(store storage.Store) (map[string]PlayedItem, error) {
+	playedItems := map[string]PlayedItem{}
+	b, err := store.Load(playedItemsKey)
+	if err != nil || len(b) == 0 {
+		return playedItems, err
+	}
+	if err := json.Unmarshal(b, &playedItems); err != nil {
+		return nil, errors.Wrap(err, "unable to parse played items")
+	}
+	return playedItems, nil
+}
+
+// PrunePlayedItems removes the played items kept in store that were last
+// played before t, and returns how many were removed.
+func PrunePlayedItems(store storage.Store, t time.Time) (int, error) {
+	removed := 0
+	err := updatePlayedItems(store, func(playedItems map[string]PlayedItem) {
+		removed = 0
+		for k, p := range playedItems {
+			if p.LastPlayed().Before(t) {
+				delete(playedItems, k)
+				removed++
+			}
+		}
+	})
+	return removed, err
+}
+
+// updatePlayedItems changes the played items kept in store with f, without
+// losing changes made by other processes.
+func updatePlayedItems(store storage.Store, f func(playedItems map[string]PlayedItem)) error {
+	return store.Update(playedItemsKey, func(b []byte) ([]byte, error) {
+		playedItems := map[string]PlayedItem{}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &playedItems); err != nil {
+				return nil, errors.Wrap(err, "unable to parse played items")
+			}
+		}
+		f(playedItems)
+		return json.Marshal(playedItems)
+	})
+}
@@ -0,0 +1,142 @@
+package application
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/grasparv/go-chromecast/probe"
+)
+
+// TranscodeMode is how media that the chromecast can't play is transcoded
+// before being served to it.
+type TranscodeMode string
+
+const (
+	// TranscodeModeMP4 transcodes media into a single fragmented mp4
+	// stream. This is cheap to start but the media isn't seekable.
+	TranscodeModeMP4 TranscodeMode = "mp4"
+	// TranscodeModeHLS serves a HLS playlist for the media, the segments
+	// are transcoded on demand from the requested offset. This allows seeking.
+	TranscodeModeHLS TranscodeMode = "hls"
+)
+
+const (
+	// Duration in seconds of each HLS segment.
+	hlsSegmentDuration = 6
+
+	hlsSegmentPrefix = "segment-"
+	hlsSegmentSuffix = ".ts"
+)
+
+// ParseTranscodeMode returns the TranscodeMode for the given name.
+func ParseTranscodeMode(mode string) (TranscodeMode, error) {
+	switch m := TranscodeMode(strings.ToLower(mode)); m {
+	case TranscodeModeMP4, TranscodeModeHLS:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown transcode mode %q, expected %q or %q", mode, TranscodeModeMP4, TranscodeModeHLS)
+	}
+}
+
+// WithTranscodeMode sets how media that needs transcoding is served.
+func WithTranscodeMode(mode TranscodeMode) ApplicationOption {
+	return func(a *Application) {
+		a.transcodeMode = mode
+	}
+}
+
+// hlsSegmentName returns the name of the HLS segment at index.
+func hlsSegmentName(index int) string {
+	return fmt.Sprintf("%s%d%s", hlsSegmentPrefix, index, hlsSegmentSuffix)
+}
+
+// hlsSegmentIndex returns the index of the HLS segment with the given
+// name, and whether the name was a valid segment name.
+func hlsSegmentIndex(name string) (int, bool) {
+	if !strings.HasPrefix(name, hlsSegmentPrefix) || !strings.HasSuffix(name, hlsSegmentSuffix) {
+		return 0, false
+	}
+	index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, hlsSegmentPrefix), hlsSegmentSuffix))
+	if err != nil || index < 0 {
+		return 0, false
+	}
+	return index, true
+}
+
+// hlsPlaylist generates a VOD playlist for media of the given duration,
+// split into segments of hlsSegmentDuration.
+func hlsPlaylist(duration float64) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "#EXTM3U")
+	fmt.Fprintln(&b, "#EXT-X-VERSION:3")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", hlsSegmentDuration)
+	fmt.Fprintln(&b, "#EXT-X-MEDIA-SEQUENCE:0")
+	fmt.Fprintln(&b, "#EXT-X-PLAYLIST-TYPE:VOD")
+	segments := int(math.Ceil(duration / hlsSegmentDuration))
+	for i := 0; i < segments; i++ {
+		segmentDuration := math.Min(hlsSegmentDuration, duration-float64(i*hlsSegmentDuration))
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", segmentDuration)
+		fmt.Fprintln(&b, hlsSegmentName(i))
+	}
+	fmt.Fprintln(&b, "#EXT-X-ENDLIST")
+	return b.Bytes()
+}
+
+func (a *Application) serveHLSPlaylist(w http.ResponseWriter, r *http.Request, filename string) {
+	info, err := probe.Probe(filename, a.ffmpegHeaderArgs(filename)...)
+	if err != nil {
+		a.log("unable to create hls playlist: %v", err)
+		http.Error(w, "Unable to probe media", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/x-mpegURL")
+	w.Write(hlsPlaylist(info.Duration))
+}
+
+// hlsSegmentArgs returns the ffmpeg arguments that transcode the segment at
+// index. Segments start at an arbitrary offset rather than on a keyframe, so
+// the video is always re-encoded to start each segment with one, copying it
+// would leave artefacts or stall playback at every segment boundary.
+func hlsSegmentArgs(m *servedMedia, headerArgs []string, index int) []string {
+	offset := index * hlsSegmentDuration
+	args := []string{
+		"-ss", strconv.Itoa(offset), // seek on the input, this is fast and good enough for segments
+	}
+	args = append(args, headerArgs...)
+	args = append(args,
+		"-i", m.filename,
+		"-t", strconv.Itoa(hlsSegmentDuration),
+	)
+	profile := m.profile
+	profile.copyVideo = false
+	args = append(args, profile.codecArgs()...)
+	return append(args,
+		"-output_ts_offset", strconv.Itoa(offset), // keep timestamps continuous across segments
+		"-f", "mpegts",
+		"pipe:1",
+	)
+}
+
+func (a *Application) serveHLSSegment(w http.ResponseWriter, r *http.Request, m *servedMedia, index int) {
+	filename := m.filename
+	args := hlsSegmentArgs(m, a.ffmpegHeaderArgs(filename), index)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "video/MP2T")
+
+	// The chromecast cancels segment requests when seeking, which
+	// stops the transcode of the segment.
+	if err := a.transcoder.run(r.Context(), filename, args, nil, w); err != nil && err != r.Context().Err() {
+		log.WithField("package", "application").WithFields(log.Fields{
+			"filename": filename,
+			"segment":  index,
+		}).WithError(err).Error("error transcoding hls segment")
+	}
+}
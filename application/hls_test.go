@@ -0,0 +1,67 @@
+package application
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHLSPlaylist(t *testing.T) {
+	want := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:6.000,
+segment-0.ts
+#EXTINF:6.000,
+segment-1.ts
+#EXTINF:2.500,
+segment-2.ts
+#EXT-X-ENDLIST
+`
+	if got := string(hlsPlaylist(14.5)); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestHLSSegmentIndex(t *testing.T) {
+	tests := map[string]int{
+		"segment-0.ts":  0,
+		"segment-12.ts": 12,
+		"segment--1.ts": -1,
+		"segment-a.ts":  -1,
+		"segment-1.mp4": -1,
+		"film.m3u8":     -1,
+	}
+	for name, want := range tests {
+		index, ok := hlsSegmentIndex(name)
+		if ok != (want >= 0) || (ok && index != want) {
+			t.Errorf("%s: expected %d, got %d (%v)", name, want, index, ok)
+		}
+	}
+	if index, ok := hlsSegmentIndex(hlsSegmentName(7)); !ok || index != 7 {
+		t.Errorf("expected segment 7, got %d (%v)", index, ok)
+	}
+}
+
+func TestHLSSegmentArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile transcodeProfile
+		want    string
+	}{
+		{"full transcode", fullTranscode, "-vcodec h264 -pix_fmt yuv420p -acodec aac -ac 2"},
+		// Copying the video would start segments on non-keyframes.
+		{"remux", transcodeProfile{copyVideo: true, copyAudio: true}, "-vcodec h264 -pix_fmt yuv420p -acodec copy"},
+		{"transcode audio", transcodeProfile{copyVideo: true}, "-vcodec h264 -pix_fmt yuv420p -acodec aac -ac 2"},
+		{"audio only", transcodeProfile{dropVideo: true, copyAudio: true}, "-vn -acodec copy"},
+	}
+	for _, test := range tests {
+		m := &servedMedia{filename: "/videos/film.mkv", profile: test.profile}
+		got := strings.Join(hlsSegmentArgs(m, []string{"-headers", "x"}, 2), " ")
+		want := "-ss 12 -headers x -i /videos/film.mkv -t 6 " + test.want + " -output_ts_offset 12 -f mpegts pipe:1"
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", test.name, want, got)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/grasparv/go-chromecast/probe"
+)
+
+const (
+	imageCacheExt = ".jpg"
+	// The image cache only holds images sized for the screen, so there
+	// is no need for it to be large.
+	imageCacheMaxSize = 256 << 20
+
+	imageJPEGQuality = 90
+
+	// Used when the resolution of the device isn't known, ie: for audio
+	// devices that can still show images on a paired screen.
+	defaultImageWidth  = 1920
+	defaultImageHeight = 1080
+)
+
+// Content-types of images that the chromecast can't show, but that can be
+// converted into JPEG with ffmpeg.
+var convertibleImageContentTypes = map[string]bool{
+	"image/heic": true,
+	"image/tiff": true,
+}
+
+// WithImageProcessing resizes images to fit the screen of the device, turns
+// them the right way up based on their EXIF orientation and converts HEIC and
+// TIFF images into JPEG before they are served. If maxWidth or maxHeight are
+// 0 the resolution of the device model is used. Processed images are kept in
+// cacheDir, if it is set.
+func WithImageProcessing(maxWidth, maxHeight int, cacheDir string) ApplicationOption {
+	return func(a *Application) {
+		a.images = &imageProcessor{
+			maxWidth:  maxWidth,
+			maxHeight: maxHeight,
+			cacheDir:  cacheDir,
+		}
+	}
+}
+
+type imageProcessor struct {
+	maxWidth  int
+	maxHeight int
+	cacheDir  string
+}
+
+// size returns the largest size images should be served at for the
+// device model.
+func (p *imageProcessor) size(model string) (int, int) {
+	if p.maxWidth > 0 && p.maxHeight > 0 {
+		return p.maxWidth, p.maxHeight
+	}
+	caps := probe.CapabilitiesForModel(model)
+	if caps.MaxWidth > 0 && caps.MaxHeight > 0 {
+		return caps.MaxWidth, caps.MaxHeight
+	}
+	return defaultImageWidth, defaultImageHeight
+}
+
+// imageContentType returns the content-type of a local image file, or an
+// empty string if it isn't an image.
+func imageContentType(filename string) string {
+	ct := sniffFileContentType(filename)
+	if ct == "" {
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".heic", ".heif":
+			ct = "image/heic"
+		case ".tif", ".tiff":
+			ct = "image/tiff"
+		default:
+			ct, _ = extensionContentType(filename)
+		}
+	}
+	if strings.HasPrefix(ct, "image/") {
+		return ct
+	}
+	return ""
+}
+
+// needsProcessing returns whether the image has to be processed before the
+// chromecast is able to show it, or show it the right way up.
+func (p *imageProcessor) needsProcessing(filename, contentType, model string) bool {
+	if convertibleImageContentTypes[contentType] {
+		return true
+	}
+	// Animated gifs would lose their animation, and there are no decoders
+	// for the other formats in the standard library.
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return false
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return false
+	}
+	maxWidth, maxHeight := p.size(model)
+	if config.Width > maxWidth || config.Height > maxHeight {
+		return true
+	}
+	if contentType != "image/jpeg" {
+		return false
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	return jpegOrientation(f) != orientationNormal
+}
+
+// key returns the cache key for the image processed to fit maxWidth x
+// maxHeight, the key changes when the file is modified.
+func (p *imageProcessor) key(filename string, maxWidth, maxHeight int) (string, error) {
+	fileInfo, err := os.Stat(filename)
+	if err != nil {
+		return "", err
+	}
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s:%d:%d:%dx%d", absFilename, fileInfo.Size(), fileInfo.ModTime().UnixNano(), maxWidth, maxHeight)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lookup returns the path of the cached processed image if it exists.
+func (p *imageProcessor) lookup(key string) (string, bool) {
+	if p.cacheDir == "" {
+		return "", false
+	}
+	cached := filepath.Join(p.cacheDir, key+imageCacheExt)
+	if _, err := os.Stat(cached); err != nil {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(cached, now, now)
+	return cached, true
+}
+
+// store adds the processed image to the cache.
+func (p *imageProcessor) store(key string, b []byte) error {
+	if p.cacheDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(p.cacheDir, 0755); err != nil {
+		return errors.Wrap(err, "unable to create image cache directory")
+	}
+	f, err := ioutil.TempFile(p.cacheDir, key+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "unable to create image cache file")
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(p.cacheDir, key+imageCacheExt))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "unable to write image cache file")
+	}
+	evictLRU(p.cacheDir, imageCacheExt, imageCacheMaxSize)
+	return nil
+}
+
+// newServedImage returns the media item for an image that is processed
+// before it is served, the processed image is always a JPEG.
+func newServedImage(filename string) *servedMedia {
+	m := newServedMedia(filename, false, false, fullTranscode)
+	m.image = true
+	m.name = strings.TrimSuffix(m.name, filepath.Ext(m.name)) + imageCacheExt
+	return m
+}
+
+// processImage decodes the image, turns it the right way up, scales it down
+// to fit maxWidth x maxHeight and encodes it as a JPEG.
+func (a *Application) processImage(ctx context.Context, filename string, maxWidth, maxHeight int) ([]byte, error) {
+	contentType := imageContentType(filename)
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var img image.Image
+	orientation := orientationNormal
+	switch {
+	case convertibleImageContentTypes[contentType]:
+		if contentType == "image/tiff" {
+			orientation = tiffOrientation(f)
+		}
+		// There are no decoders for these formats in the standard
+		// library, so ffmpeg converts them into a PNG first.
+		var converted bytes.Buffer
+		args := []string{"-i", filename, "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "pipe:1"}
+		if err := a.transcoder.run(ctx, filename, args, nil, &converted); err != nil {
+			return nil, errors.Wrapf(err, "unable to convert %q", filename)
+		}
+		if img, err = png.Decode(&converted); err != nil {
+			return nil, errors.Wrapf(err, "unable to decode converted %q", filename)
+		}
+	default:
+		if contentType == "image/jpeg" {
+			orientation = jpegOrientation(f)
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+		if img, _, err = image.Decode(f); err != nil {
+			return nil, errors.Wrapf(err, "unable to decode %q", filename)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, fitImage(img, orientation, maxWidth, maxHeight), &jpeg.Options{Quality: imageJPEGQuality}); err != nil {
+		return nil, errors.Wrap(err, "unable to encode jpeg")
+	}
+	return b.Bytes(), nil
+}
+
+func (a *Application) serveImage(w http.ResponseWriter, r *http.Request, m *servedMedia) {
+	maxWidth, maxHeight := a.images.size(a.deviceModel)
+	key, err := a.images.key(m.filename, maxWidth, maxHeight)
+	if err != nil {
+		http.Error(w, "Unable to stat file", http.StatusInternalServerError)
+		return
+	}
+	if cached, ok := a.images.lookup(key); ok {
+		a.log("serving %q from image cache", m.filename)
+		a.serveFile(w, r, cached)
+		return
+	}
+
+	start := time.Now()
+	b, err := a.processImage(r.Context(), m.filename, maxWidth, maxHeight)
+	if err != nil {
+		a.log("unable to process image: %v", err)
+		http.Error(w, "Unable to process image", http.StatusInternalServerError)
+		return
+	}
+	a.log("processed %q to fit %dx%d in %s", m.filename, maxWidth, maxHeight, time.Since(start))
+	if err := a.images.store(key, b); err != nil {
+		a.log("unable to cache processed image: %v", err)
+	}
+	http.ServeContent(w, r, m.name, start, bytes.NewReader(b))
+}
@@ -0,0 +1,220 @@
+package application
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"io"
+)
+
+const (
+	// EXIF tag holding the orientation of the image.
+	exifOrientationTag = 0x0112
+
+	// Orientation of an image that is already the right way up.
+	orientationNormal = 1
+)
+
+// jpegOrientation returns the EXIF orientation of a JPEG image, between 1
+// and 8, or orientationNormal if it doesn't have one.
+func jpegOrientation(r io.Reader) int {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return orientationNormal
+	}
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(br, marker[:]); err != nil || marker[0] != 0xFF {
+			return orientationNormal
+		}
+		// The EXIF data comes before the image data, so stop once the
+		// start of scan is reached.
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return orientationNormal
+		}
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return orientationNormal
+		}
+		if marker[1] != 0xE1 {
+			if _, err := br.Discard(length); err != nil {
+				return orientationNormal
+			}
+			continue
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return orientationNormal
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(bytes.NewReader(segment[6:]))
+		}
+	}
+}
+
+// tiffOrientation returns the orientation tag from the first IFD of TIFF
+// structured data, this is both the format of EXIF data and TIFF files.
+func tiffOrientation(r io.ReaderAt) int {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return orientationNormal
+	}
+	var order binary.ByteOrder
+	switch string(header[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return orientationNormal
+	}
+	offset := int64(order.Uint32(header[4:]))
+	var count [2]byte
+	if _, err := r.ReadAt(count[:], offset); err != nil {
+		return orientationNormal
+	}
+	entries := make([]byte, int(order.Uint16(count[:]))*12)
+	if _, err := r.ReadAt(entries, offset+2); err != nil {
+		return orientationNormal
+	}
+	for entry := 0; entry+12 <= len(entries); entry += 12 {
+		if order.Uint16(entries[entry:]) != exifOrientationTag {
+			continue
+		}
+		// The orientation is a SHORT stored inline in the value field.
+		if v := int(order.Uint16(entries[entry+8:])); v >= 1 && v <= 8 {
+			return v
+		}
+		break
+	}
+	return orientationNormal
+}
+
+// swapsAxes returns whether applying the orientation swaps the width and
+// height of the image.
+func swapsAxes(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
+
+// toRGBA converts any image into an RGBA image with its origin at 0,0.
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// fitSize returns the size that w x h needs to be scaled down to so it fits
+// in maxWidth x maxHeight, keeping the aspect ratio. Images are never scaled up.
+func fitSize(w, h, maxWidth, maxHeight int) (int, int) {
+	if w <= maxWidth && h <= maxHeight {
+		return w, h
+	}
+	if w*maxHeight > h*maxWidth {
+		return maxWidth, max(1, h*maxWidth/w)
+	}
+	return max(1, w*maxHeight/h), maxHeight
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// downscale resizes src to w x h by averaging the source pixels that each
+// destination pixel covers. This is only suitable for making images smaller.
+func downscale(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[off])
+					g += uint64(src.Pix[off+1])
+					b += uint64(src.Pix[off+2])
+					a += uint64(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := dst.PixOffset(x, y)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient rotates and flips src so that it is the right way up, given its
+// EXIF orientation.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= orientationNormal || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if swapsAxes(orientation) {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Find which source pixel ends up at x,y.
+			var sx, sy int
+			switch orientation {
+			case 2: // flipped horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // flipped vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs rotating 90 clockwise
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs rotating 90 anti-clockwise
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// fitImage makes the image the right way up and scales it down so it
+// fits in maxWidth x maxHeight.
+func fitImage(img image.Image, orientation, maxWidth, maxHeight int) *image.RGBA {
+	rgba := toRGBA(img)
+	w, h := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	// The limits apply to the image once it has been rotated.
+	var fw, fh int
+	if swapsAxes(orientation) {
+		fw, fh = fitSize(w, h, maxHeight, maxWidth)
+	} else {
+		fw, fh = fitSize(w, h, maxWidth, maxHeight)
+	}
+	if fw != w || fh != h {
+		rgba = downscale(rgba, fw, fh)
+	}
+	return orient(rgba, orientation)
+}
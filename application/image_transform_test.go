@@ -0,0 +1,199 @@
+package application
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// testPixels is a 3x2 image, each pixel has a different red value.
+//
+//	A B C
+//	D E F
+var testPixels = [][]uint8{
+	{'A', 'B', 'C'},
+	{'D', 'E', 'F'},
+}
+
+func newTestImage(rows [][]uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, v := range row {
+			img.SetRGBA(x, y, color.RGBA{R: v, A: 0xFF})
+		}
+	}
+	return img
+}
+
+func testImageRows(img *image.RGBA) [][]uint8 {
+	b := img.Bounds()
+	rows := make([][]uint8, b.Dy())
+	for y := range rows {
+		rows[y] = make([]uint8, b.Dx())
+		for x := range rows[y] {
+			rows[y][x] = img.RGBAAt(b.Min.X+x, b.Min.Y+y).R
+		}
+	}
+	return rows
+}
+
+func TestOrient(t *testing.T) {
+	tests := map[int][]string{
+		0: {"ABC", "DEF"},
+		1: {"ABC", "DEF"},
+		2: {"CBA", "FED"},
+		3: {"FED", "CBA"},
+		4: {"DEF", "ABC"},
+		5: {"AD", "BE", "CF"},
+		6: {"DA", "EB", "FC"},
+		7: {"FC", "EB", "DA"},
+		8: {"CF", "BE", "AD"},
+		9: {"ABC", "DEF"},
+	}
+	for orientation, want := range tests {
+		rows := testImageRows(orient(newTestImage(testPixels), orientation))
+		got := make([]string, len(rows))
+		for i, row := range rows {
+			got[i] = string(row)
+		}
+		if len(got) != len(want) {
+			t.Errorf("orientation %d: expected %q, got %q", orientation, want, got)
+			continue
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("orientation %d: expected %q, got %q", orientation, want, got)
+				break
+			}
+		}
+	}
+}
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		w, h, maxWidth, maxHeight int
+		fw, fh                    int
+	}{
+		{1920, 1080, 1920, 1080, 1920, 1080},
+		{800, 600, 1920, 1080, 800, 600},
+		{4000, 3000, 1920, 1080, 1440, 1080},
+		{4000, 1000, 1920, 1080, 1920, 480},
+		{3000, 4000, 1920, 1080, 810, 1080},
+		{3840, 2160, 1920, 1080, 1920, 1080},
+		{10000, 10, 100, 100, 100, 1},
+		{10, 10000, 100, 100, 1, 100},
+	}
+	for _, test := range tests {
+		fw, fh := fitSize(test.w, test.h, test.maxWidth, test.maxHeight)
+		if fw != test.fw || fh != test.fh {
+			t.Errorf("fitSize(%d, %d, %d, %d): expected %dx%d, got %dx%d",
+				test.w, test.h, test.maxWidth, test.maxHeight, test.fw, test.fh, fw, fh)
+		}
+		if fw > test.maxWidth || fh > test.maxHeight {
+			t.Errorf("fitSize(%d, %d, %d, %d): %dx%d is out of bounds",
+				test.w, test.h, test.maxWidth, test.maxHeight, fw, fh)
+		}
+	}
+}
+
+func TestFitImage(t *testing.T) {
+	tests := []struct {
+		orientation int
+		w, h        int
+	}{
+		{1, 100, 50},
+		{3, 100, 50},
+		// Rotated portrait, the limits apply once it's the right way up.
+		{6, 50, 100},
+		{8, 50, 100},
+	}
+	src := image.NewRGBA(image.Rect(10, 10, 410, 210))
+	for _, test := range tests {
+		b := fitImage(src, test.orientation, 100, 100).Bounds()
+		if b.Min != (image.Point{}) || b.Dx() != test.w || b.Dy() != test.h {
+			t.Errorf("orientation %d: expected 0,0-%dx%d, got %v", test.orientation, test.w, test.h, b)
+		}
+	}
+
+	// Each pixel of the downscaled image is the average of those it covers.
+	rows := testImageRows(downscale(newTestImage([][]uint8{
+		{0, 100, 10, 10},
+		{200, 100, 20, 40},
+	}), 2, 1))
+	if rows[0][0] != 100 || rows[0][1] != 20 {
+		t.Errorf("expected [100 20], got %v", rows[0])
+	}
+}
+
+// exifJPEG returns a small JPEG with an EXIF orientation tag stored using
+// the given byte order.
+func exifJPEG(t *testing.T, order binary.ByteOrder, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))
+	// An IFD with an unrelated tag before the orientation, SHORT values
+	// are stored inline.
+	type entry struct {
+		Tag, Type   uint16
+		Count       uint32
+		Value, Zero uint16
+	}
+	binary.Write(&tiff, order, uint16(2))
+	binary.Write(&tiff, order, entry{Tag: 0x0128, Type: 3, Count: 1, Value: 2})
+	binary.Write(&tiff, order, entry{Tag: exifOrientationTag, Type: 3, Count: 1, Value: orientation})
+	binary.Write(&tiff, order, uint32(0))
+
+	var img bytes.Buffer
+	if err := jpeg.Encode(&img, newTestImage(testPixels), nil); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	b.Write(img.Bytes()[:2])
+	b.Write([]byte{0xFF, 0xE1})
+	binary.Write(&b, binary.BigEndian, uint16(2+6+tiff.Len()))
+	b.WriteString("Exif\x00\x00")
+	b.Write(tiff.Bytes())
+	b.Write(img.Bytes()[2:])
+	return b.Bytes()
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for orientation := 1; orientation <= 8; orientation++ {
+			data := exifJPEG(t, order, uint16(orientation))
+			if got := jpegOrientation(bytes.NewReader(data)); got != orientation {
+				t.Errorf("%v: expected orientation %d, got %d", order, orientation, got)
+			}
+			// The EXIF data doesn't stop the image from decoding.
+			if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+				t.Errorf("%v: %v", order, err)
+			}
+		}
+		if got := jpegOrientation(bytes.NewReader(exifJPEG(t, order, 9))); got != orientationNormal {
+			t.Errorf("%v: expected an invalid orientation to be normal, got %d", order, got)
+		}
+	}
+
+	var plain bytes.Buffer
+	if err := jpeg.Encode(&plain, newTestImage(testPixels), nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"without exif": plain.Bytes(),
+		"truncated":    exifJPEG(t, binary.BigEndian, 6)[:20],
+		"not a jpeg":   []byte("\x89PNG\r\n\x1a\n"),
+		"empty":        nil,
+	} {
+		if got := jpegOrientation(bytes.NewReader(data)); got != orientationNormal {
+			t.Errorf("%s: expected orientation %d, got %d", name, orientationNormal, got)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package application
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// liveInput is a source of media that isn't a file that can be served
+// directly or seeked, ie: stdin or a camera stream.
+type liveInput int
+
+const (
+	liveInputNone liveInput = iota
+	liveInputStdin
+	liveInputFFmpeg
+)
+
+// stdinFilename is the filename used to load media from stdin.
+const stdinFilename = "-"
+
+// LoadFFmpegInput plays any input that ffmpeg can read, ie: 'rtsp://camera/stream'.
+// An ffmpeg input format can be given as a prefix, ie: 'lavfi:testsrc' is
+// read with '-f lavfi -i testsrc'. The input is always transcoded.
+func (a *Application) LoadFFmpegInput(input string) error {
+	mi, err := a.serveLiveInput(input, liveInputFFmpeg, "", true)
+	if err != nil {
+		return errors.Wrapf(err, "unable to serve ffmpeg input %q", input)
+	}
+	return a.loadMediaItem(mi, false)
+}
+
+// serveLiveInput registers a live input with the streaming server. Stdin is
+// only passed through as-is if a content-type is given and transcode is off,
+// otherwise ffmpeg is used to turn it into something the chromecast can play.
+func (a *Application) serveLiveInput(input string, kind liveInput, contentType string, transcode bool) (mediaItem, error) {
+	if !transcode && contentType == "" {
+		return mediaItem{}, errors.New("unknown content-type for live input, either specify a content-type or set transcode to true")
+	}
+	if kind == liveInputFFmpeg {
+		transcode = true
+	}
+
+	contentTypeToUse := contentType
+	if transcode {
+		contentTypeToUse = fullTranscode.contentType()
+	}
+
+	// Live inputs can't be seeked, so they are never served as HLS.
+	served := newServedMedia("live", transcode, false, fullTranscode)
+	served.filename = input
+	served.input = kind
+	if kind == liveInputStdin {
+		served.stdin = newStdinBuffer(os.Stdin)
+	}
+	if err := a.servedMedia.register(served); err != nil {
+		return mediaItem{}, err
+	}
+
+	mediaItems := []mediaItem{{
+		filename:    input,
+		contentType: contentTypeToUse,
+		transcode:   transcode,
+		served:      served,
+	}}
+	if err := a.serveMediaItems(mediaItems); err != nil {
+		return mediaItem{}, err
+	}
+	return mediaItems[0], nil
+}
+
+// ffmpegInputArgs returns the ffmpeg arguments used to read the media.
+func (a *Application) ffmpegInputArgs(m *servedMedia) []string {
+	switch m.input {
+	case liveInputStdin:
+		return []string{"-i", "pipe:0"}
+	case liveInputFFmpeg:
+		if format, source, ok := splitFFmpegInput(m.filename); ok {
+			args := []string{"-f", format, "-i", source}
+			// Generated inputs are produced as fast as possible unless
+			// they are read at their native frame rate.
+			if format == "lavfi" {
+				args = append([]string{"-re"}, args...)
+			}
+			return args
+		}
+		return []string{"-i", m.filename}
+	}
+
+	args := []string{
+		"-re", // encode at 1x playback speed, to not burn the CPU
+	}
+	args = append(args, a.ffmpegHeaderArgs(m.filename)...)
+	return append(args, "-i", m.filename)
+}
+
+// splitFFmpegInput splits an input in the form 'format:source' into the ffmpeg
+// input format and source. Urls, ie: 'rtsp://...', are not split.
+func splitFFmpegInput(input string) (string, string, bool) {
+	if strings.Contains(input, "://") {
+		return "", "", false
+	}
+	parts := strings.SplitN(input, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.ContainsAny(parts[0], `/\.`) {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// stdinBuffer keeps a copy of stdin in a temporary file as it is read, stdin
+// can only be read once but the chromecast requests the media more than once,
+// ie: when probing it or when the media is reloaded.
+type stdinBuffer struct {
+	src  io.Reader
+	once sync.Once
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	file *os.File
+	size int64
+	// done is set once src has been read completely or failed, err is
+	// the error it failed with.
+	done bool
+	err  error
+}
+
+func newStdinBuffer(src io.Reader) *stdinBuffer {
+	b := &stdinBuffer{src: src}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// start begins copying src into the buffer, this is only done for the
+// first request.
+func (b *stdinBuffer) start() {
+	b.once.Do(func() {
+		f, err := ioutil.TempFile("", "go-chromecast-stdin")
+		b.mu.Lock()
+		b.file = f
+		if err != nil {
+			b.done, b.err = true, errors.Wrap(err, "unable to buffer stdin")
+		}
+		b.mu.Unlock()
+		if err == nil {
+			go b.copy(f)
+		}
+	})
+}
+
+func (b *stdinBuffer) copy(f *os.File) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := b.src.Read(buf)
+		b.mu.Lock()
+		if n > 0 {
+			if _, werr := f.WriteAt(buf[:n], b.size); werr != nil && err == nil {
+				err = errors.Wrap(werr, "unable to buffer stdin")
+			} else {
+				b.size += int64(n)
+			}
+		}
+		if err != nil {
+			b.done = true
+			if err != io.EOF {
+				b.err = err
+			}
+		}
+		b.cond.Broadcast()
+		b.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// complete returns the buffered stdin if it has been read completely.
+func (b *stdinBuffer) complete() (*io.SectionReader, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.done || b.err != nil {
+		return nil, false
+	}
+	return io.NewSectionReader(b.file, 0, b.size), true
+}
+
+// reader returns a reader of stdin from the start, it waits for more of
+// stdin to be read until it is done or ctx is.
+func (b *stdinBuffer) reader(ctx context.Context) io.Reader {
+	b.start()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		b.cond.Broadcast()
+		b.mu.Unlock()
+	}()
+	return &stdinReader{b: b, ctx: ctx}
+}
+
+// close removes the buffered stdin.
+func (b *stdinBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+	}
+	b.done = true
+	if b.err == nil {
+		b.err = errors.New("stdin buffer is closed")
+	}
+	b.cond.Broadcast()
+}
+
+type stdinReader struct {
+	b      *stdinBuffer
+	ctx    context.Context
+	offset int64
+}
+
+func (r *stdinReader) Read(p []byte) (int, error) {
+	b := r.b
+	b.mu.Lock()
+	for r.offset >= b.size && !b.done && r.ctx.Err() == nil {
+		b.cond.Wait()
+	}
+	size, done, err, file := b.size, b.done, b.err, b.file
+	b.mu.Unlock()
+
+	switch {
+	case r.ctx.Err() != nil:
+		return 0, r.ctx.Err()
+	case r.offset < size:
+		if int64(len(p)) > size-r.offset {
+			p = p[:size-r.offset]
+		}
+		n, err := file.ReadAt(p, r.offset)
+		r.offset += int64(n)
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	case done && err != nil:
+		return 0, err
+	}
+	return 0, io.EOF
+}
+
+// serveStdin serves stdin as it is read, every request gets all of it from
+// the start. Once stdin has been read completely, range requests are
+// supported as well.
+func (a *Application) serveStdin(w http.ResponseWriter, r *http.Request, m *servedMedia) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if content, ok := m.stdin.complete(); ok {
+		http.ServeContent(w, r, m.name, m.modTime, content)
+		return
+	}
+
+	w.Header().Set("Transfer-Encoding", "chunked")
+	if _, err := io.Copy(w, m.stdin.reader(r.Context())); err != nil && err != r.Context().Err() {
+		a.log("error serving stdin: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package application
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+func TestServeStdin(t *testing.T) {
+	stdin, stdinWriter := io.Pipe()
+	a := NewApplication("", false, false, WithStore(storage.NewMemoryStore()))
+	m := newServedMedia("live", false, false, fullTranscode)
+	m.filename = stdinFilename
+	m.input = liveInputStdin
+	m.stdin = newStdinBuffer(stdin)
+	if err := a.servedMedia.register(m); err != nil {
+		t.Fatal(err)
+	}
+	defer a.servedMedia.expire()
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, m.path(), nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		a.serveMedia(rec, req)
+		return rec
+	}
+
+	// A request made while stdin is still being read gets it from the
+	// start, ranges can't be served yet.
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- get("bytes=6-") }()
+	stdinWriter.Write([]byte("hello "))
+	stdinWriter.Write([]byte("world"))
+	stdinWriter.Close()
+	if rec := <-done; rec.Code != http.StatusOK || rec.Body.String() != "hello world" {
+		t.Errorf("expected all of stdin, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Once stdin is read completely it is served from the buffer.
+	if rec := get(""); rec.Code != http.StatusOK || rec.Body.String() != "hello world" {
+		t.Errorf("expected stdin to be served again, got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := get("bytes=6-"); rec.Code != http.StatusPartialContent || rec.Body.String() != "world" {
+		t.Errorf("expected the range of stdin, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestStdinBufferClose(t *testing.T) {
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	b := newStdinBuffer(stdin)
+	r := b.reader(context.Background())
+	stdinWriter.Write([]byte("partial"))
+
+	buf := make([]byte, 16)
+	if n, err := r.Read(buf); err != nil || string(buf[:n]) != "partial" {
+		t.Fatalf("expected the data read so far, got %q (%v)", buf[:n], err)
+	}
+	// Readers waiting for more of stdin are stopped when the buffer is closed.
+	b.close()
+	if _, err := r.Read(buf); err == nil || err == io.EOF {
+		t.Errorf("expected an error reading a closed buffer, got %v", err)
+	}
+	if _, ok := b.complete(); ok {
+		t.Errorf("expected a closed buffer not to be complete")
+	}
+}
@@ -0,0 +1,200 @@
+package application
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// mediaPathPrefix is the path the streaming server serves registered
+	// media under, ie: /media/<token>/<name>.
+	mediaPathPrefix = "/media/"
+
+	// Number of random bytes used for a media token, hex encoded this
+	// results in a 32 character token.
+	mediaTokenSize = 16
+
+	// playedUpdateInterval is how often the time media was last requested
+	// is written to the played items while it is being served.
+	playedUpdateInterval = 10 * time.Second
+)
+
+// servedMedia is a single media item that the streaming server
+// is allowed to serve.
+type servedMedia struct {
+	token     string
+	filename  string
+	name      string
+	transcode bool
+	// hls is set when the media is transcoded on demand into HLS segments
+	// rather than a single fragmented mp4 stream.
+	hls bool
+	// profile is how ffmpeg should transcode the media.
+	profile transcodeProfile
+	// remote is set when filename is a url that is proxied through
+	// the streaming server.
+	remote bool
+	// input is set when the media isn't a file, but is read from stdin
+	// or any other input that ffmpeg supports.
+	input liveInput
+	// stdin is the buffered stdin, when the input is stdin.
+	stdin *stdinBuffer
+	// image is set when the image is resized, rotated or converted to
+	// JPEG before it is served.
+	image bool
+	// data is set when the media is held in memory rather than in a file,
+	// modTime is when it was registered.
+	data    []byte
+	modTime time.Time
+
+	// resources are the urls listed in the proxied HLS playlists of remote
+	// media, by the name they are served under. Only these and the media
+	// url itself are proxied.
+	resourcesMu   sync.Mutex
+	resources     map[string]string
+	resourceNames map[string]string
+
+	// played tracks what has been written to the played items for the
+	// media, so it isn't rewritten on every request.
+	playedMu       sync.Mutex
+	started        bool
+	finishedLogged time.Time
+}
+
+// markStarted returns true for the first request of the media, later
+// requests, ie: range requests, are part of the same playback.
+func (m *servedMedia) markStarted() bool {
+	m.playedMu.Lock()
+	defer m.playedMu.Unlock()
+	if m.started {
+		return false
+	}
+	m.started = true
+	return true
+}
+
+// finishedDue returns whether the finished time of the media should be
+// written to the played items, it is written at most every playedUpdateInterval.
+func (m *servedMedia) finishedDue(now time.Time) bool {
+	m.playedMu.Lock()
+	defer m.playedMu.Unlock()
+	if now.Sub(m.finishedLogged) < playedUpdateInterval {
+		return false
+	}
+	m.finishedLogged = now
+	return true
+}
+
+// path returns the path, relative to the streaming server, that the
+// media item can be requested from.
+func (m *servedMedia) path() string {
+	return mediaPathPrefix + m.token + "/" + url.PathEscape(m.name)
+}
+
+// mediaRegistry maps random per-session tokens to the media files that
+// go-chromecast has validated and will serve. Tokens are used so the local
+// file paths are never exposed to the network, and so they can't be guessed
+// by anyone else on the network.
+type mediaRegistry struct {
+	mu    sync.Mutex
+	items map[string]*servedMedia
+}
+
+func newMediaRegistry() *mediaRegistry {
+	return &mediaRegistry{items: map[string]*servedMedia{}}
+}
+
+// newServedMedia returns the media item for filename, the name it is served
+// under is based on the filename and how it is transcoded.
+func newServedMedia(filename string, transcode, hls bool, profile transcodeProfile) *servedMedia {
+	name := filepath.Base(filename)
+	remote := isURL(filename)
+	if remote {
+		name = "media"
+		if u, err := url.Parse(filename); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+			name = path.Base(u.Path)
+		}
+	}
+	// Transcoded media is always served as mp4 or a HLS playlist, so make
+	// sure the name reflects that for any receiver that cares about the extension.
+	if transcode && hls {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".m3u8"
+	} else if transcode {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".mp4"
+	}
+
+	return &servedMedia{
+		filename:  filename,
+		name:      name,
+		transcode: transcode,
+		hls:       transcode && hls,
+		profile:   profile,
+		remote:    remote,
+	}
+}
+
+// register adds the media to the registry under a newly generated token.
+func (r *mediaRegistry) register(m *servedMedia) error {
+	b := make([]byte, mediaTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return errors.Wrap(err, "unable to generate media token")
+	}
+	m.token = hex.EncodeToString(b)
+
+	r.mu.Lock()
+	r.items[m.token] = m
+	r.mu.Unlock()
+	return nil
+}
+
+// lookup returns the media registered for the request path, and the
+// requested name. The path is expected to be in the form /media/<token>/<name>,
+// where name is either the name of the media or one of its HLS segments. For
+// proxied remote media the name can also be one of the resources listed in
+// the playlists that have been proxied.
+func (r *mediaRegistry) lookup(requestPath string) (*servedMedia, string, error) {
+	if !strings.HasPrefix(requestPath, mediaPathPrefix) {
+		return nil, "", fmt.Errorf("invalid media path %q", requestPath)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(requestPath, mediaPathPrefix), "/", 2)
+	if len(parts) != 2 {
+		return nil, "", fmt.Errorf("invalid media path %q", requestPath)
+	}
+
+	r.mu.Lock()
+	m, ok := r.items[parts[0]]
+	r.mu.Unlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unknown media token %q", parts[0])
+	}
+	if parts[1] != m.name {
+		_, isSegment := hlsSegmentIndex(parts[1])
+		_, isResource := m.resourceURL(parts[1])
+		if !(m.hls && isSegment) && !(m.remote && isResource) {
+			return nil, "", fmt.Errorf("media name %q does not match token", parts[1])
+		}
+	}
+	return m, parts[1], nil
+}
+
+// expire removes all registered tokens, any subsequent requests for
+// previously served media will fail.
+func (r *mediaRegistry) expire() {
+	r.mu.Lock()
+	for _, m := range r.items {
+		if m.stdin != nil {
+			m.stdin.close()
+		}
+	}
+	r.items = map[string]*servedMedia{}
+	r.mu.Unlock()
+}
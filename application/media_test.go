@@ -0,0 +1,131 @@
+package application
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+func TestMediaRegistry(t *testing.T) {
+	r := newMediaRegistry()
+	song := newServedMedia("/music/My Song.flac", false, false, fullTranscode)
+	video := newServedMedia("/videos/film.mkv", true, true, fullTranscode)
+	for _, m := range []*servedMedia{song, video} {
+		if err := r.register(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(song.token) || song.token == video.token {
+		t.Fatalf("expected unique 32 character hex tokens, got %q and %q", song.token, video.token)
+	}
+	if want := "/media/" + song.token + "/My%20Song.flac"; song.path() != want {
+		t.Errorf("expected path %q, got %q", want, song.path())
+	}
+	if video.name != "film.m3u8" {
+		t.Errorf("expected HLS media to be named film.m3u8, got %q", video.name)
+	}
+
+	tests := []struct {
+		path string
+		want *servedMedia
+		name string
+	}{
+		{"/media/" + song.token + "/My Song.flac", song, "My Song.flac"},
+		{"/media/" + video.token + "/film.m3u8", video, "film.m3u8"},
+		{"/media/" + video.token + "/" + hlsSegmentName(3), video, hlsSegmentName(3)},
+		// Segments only exist for HLS media.
+		{"/media/" + song.token + "/" + hlsSegmentName(3), nil, ""},
+		{"/media/" + song.token + "/other.flac", nil, ""},
+		{"/media/" + song.token, nil, ""},
+		{"/media/0123456789abcdef0123456789abcdef/My Song.flac", nil, ""},
+		{"/music/My Song.flac", nil, ""},
+	}
+	for _, test := range tests {
+		m, name, err := r.lookup(test.path)
+		if m != test.want || name != test.name || (err == nil) != (test.want != nil) {
+			t.Errorf("%s: expected %v %q, got %v %q (%v)", test.path, test.want, test.name, m, name, err)
+		}
+	}
+
+	r.expire()
+	if _, _, err := r.lookup("/media/" + song.token + "/My Song.flac"); err == nil {
+		t.Errorf("expected expired tokens to be unknown")
+	}
+}
+
+// countingStore counts the updates of the played items.
+type countingStore struct {
+	storage.Store
+	updates int
+}
+
+func (s *countingStore) Update(key string, f func(value []byte) ([]byte, error)) error {
+	if key == playedItemsKey {
+		s.updates++
+	}
+	return s.Store.Update(key, f)
+}
+
+func TestServeMediaRecordsPlayedOnce(t *testing.T) {
+	f, err := ioutil.TempFile("", "go-chromecast-media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("0123456789")
+	f.Close()
+	filename, _ := filepath.Abs(f.Name())
+
+	store := &countingStore{Store: storage.NewMemoryStore()}
+	a := NewApplication("", false, false, WithStore(store))
+	m := newServedMedia(filename, false, false, fullTranscode)
+	if err := a.servedMedia.register(m); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() {
+		req := httptest.NewRequest(http.MethodGet, m.path(), nil)
+		req.Header.Set("Range", "bytes=2-5")
+		rec := httptest.NewRecorder()
+		a.serveMedia(rec, req)
+		if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+			t.Fatalf("expected the range, got %d %q", rec.Code, rec.Body.String())
+		}
+	}
+	get()
+	// Started and finished are written once for the first request.
+	if store.updates != 2 {
+		t.Errorf("expected 2 updates, got %d", store.updates)
+	}
+	played, err := LoadPlayedItems(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := played[filename].Started
+	if started == 0 || played[filename].Finished < started {
+		t.Errorf("expected started and finished to be set, got %+v", played[filename])
+	}
+
+	for i := 0; i < 5; i++ {
+		get()
+	}
+	if store.updates != 2 {
+		t.Errorf("expected range requests not to rewrite the played items, got %d updates", store.updates)
+	}
+
+	// Once the interval has passed the finished time is written again, but
+	// the media is still the same playback.
+	m.finishedLogged = time.Now().Add(-playedUpdateInterval)
+	get()
+	played, _ = LoadPlayedItems(store)
+	if store.updates != 3 || played[filename].Started != started {
+		t.Errorf("expected only finished to be updated, got %d updates and %+v", store.updates, played[filename])
+	}
+}
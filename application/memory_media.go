@@ -0,0 +1,77 @@
+package application
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/grasparv/go-chromecast/cast"
+)
+
+// MemoryMedia is media held in memory rather than in a file, ie: speech
+// that has just been synthesized.
+type MemoryMedia struct {
+	// Name is the name the media is served under, ie: 'speech.mp3'.
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// LoadMemory plays the media held in memory, several items are loaded as a
+// queue. It waits for the media to finish playing.
+func (a *Application) LoadMemory(media []MemoryMedia) error {
+	mediaItems, err := a.serveMemoryMedia(media)
+	if err != nil {
+		return err
+	}
+	if len(mediaItems) == 1 {
+		return a.loadMediaItem(mediaItems[0], false)
+	}
+
+	items := make([]cast.QueueLoadItem, len(mediaItems))
+	for i, mi := range mediaItems {
+		items[i] = cast.QueueLoadItem{
+			Autoplay: true,
+			Media: cast.MediaItem{
+				ContentId:   mi.contentURL,
+				StreamType:  mi.streamType(),
+				ContentType: mi.contentType,
+			},
+		}
+	}
+	return a.queueLoadItems(items)
+}
+
+// serveMemoryMedia registers the media with the streaming server.
+func (a *Application) serveMemoryMedia(media []MemoryMedia) ([]mediaItem, error) {
+	if len(media) == 0 {
+		return nil, errors.New("there is no media to load")
+	}
+	mediaItems := make([]mediaItem, len(media))
+	for i, m := range media {
+		served := &servedMedia{
+			filename: m.Name,
+			name:     m.Name,
+			data:     m.Data,
+			modTime:  time.Now(),
+		}
+		if err := a.servedMedia.register(served); err != nil {
+			return nil, err
+		}
+		mediaItems[i] = mediaItem{
+			filename:    m.Name,
+			contentType: m.ContentType,
+			served:      served,
+		}
+	}
+	if err := a.serveMediaItems(mediaItems); err != nil {
+		return nil, err
+	}
+	return mediaItems, nil
+}
+
+func (a *Application) serveMemory(w http.ResponseWriter, r *http.Request, m *servedMedia) {
+	http.ServeContent(w, r, m.name, m.modTime, bytes.NewReader(m.data))
+}
@@ -0,0 +1,223 @@
+package application
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Largest HLS playlist that is rewritten by the proxy.
+const maxProxiedPlaylistSize = 4 << 20
+
+var (
+	// URI attributes of HLS tags, ie: the key of #EXT-X-KEY.
+	hlsURIAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+	// Characters that are kept from the name of a proxied resource.
+	resourceNameReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+	// Request headers from the chromecast that are passed on when proxying.
+	proxiedRequestHeaders = []string{"Range", "If-Range", "If-Modified-Since", "If-None-Match"}
+	// Response headers from the remote server that are passed on to the chromecast.
+	proxiedResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"}
+)
+
+// WithRemoteProxy makes urls load through the local streaming server instead
+// of passing them directly to the chromecast. This allows playing media from
+// hosts the chromecast can't reach, or that need extra request headers, ie:
+// authorization or cookies. If insecureTLS is set the certificate of the remote
+// server isn't verified.
+func WithRemoteProxy(headers http.Header, insecureTLS bool) ApplicationOption {
+	return func(a *Application) {
+		a.proxyRemote = true
+		a.proxyHeaders = headers
+		a.proxyClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: insecureTLS},
+			},
+		}
+	}
+}
+
+// ParseHeaders parses headers in the form 'Name: value'.
+func ParseHeaders(values []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, v := range values {
+		parts := strings.SplitN(v, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.Errorf("invalid header %q, expected 'Name: value'", v)
+		}
+		headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return headers, nil
+}
+
+// ffmpegHeaderArgs returns the ffmpeg input arguments needed to send the
+// proxy headers when ffmpeg reads from a url.
+func (a *Application) ffmpegHeaderArgs(filename string) []string {
+	if !isURL(filename) || len(a.proxyHeaders) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for name, values := range a.proxyHeaders {
+		for _, v := range values {
+			b.WriteString(name + ": " + v + "\r\n")
+		}
+	}
+	return []string{"-headers", b.String()}
+}
+
+// resourceName returns the name the resource at rawURL is served under for
+// the media, the resource is proxied from then on.
+func (m *servedMedia) resourceName(rawURL string) string {
+	m.resourcesMu.Lock()
+	defer m.resourcesMu.Unlock()
+	if name, ok := m.resourceNames[rawURL]; ok {
+		return name
+	}
+	if m.resources == nil {
+		m.resources = map[string]string{}
+		m.resourceNames = map[string]string{}
+	}
+	base := "resource"
+	if u, err := url.Parse(rawURL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		base = resourceNameReplacer.ReplaceAllString(path.Base(u.Path), "_")
+	}
+	name := fmt.Sprintf("%d-%s", len(m.resources), base)
+	m.resources[name] = rawURL
+	m.resourceNames[rawURL] = name
+	return name
+}
+
+// resourceURL returns the url of the resource served under name.
+func (m *servedMedia) resourceURL(name string) (string, bool) {
+	m.resourcesMu.Lock()
+	defer m.resourcesMu.Unlock()
+	u, ok := m.resources[name]
+	return u, ok
+}
+
+// remoteURL returns the url that the name requested for proxied media
+// refers to, either the media url or a resource listed in one of its
+// playlists.
+func (m *servedMedia) remoteURL(name string) (string, error) {
+	if name == m.name {
+		return m.filename, nil
+	}
+	if u, ok := m.resourceURL(name); ok {
+		return u, nil
+	}
+	return "", fmt.Errorf("%q is not part of the media", name)
+}
+
+// isHLSPlaylistResponse returns whether the proxied response is a HLS
+// playlist, whose urls have to be rewritten to go through the proxy.
+func isHLSPlaylistResponse(resp *http.Response) bool {
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	return strings.Contains(contentType, "mpegurl") || strings.HasSuffix(strings.ToLower(resp.Request.URL.Path), ".m3u8")
+}
+
+// rewriteHLSPlaylist replaces the urls in the playlist, both the segment and
+// variant playlist lines and the URI attributes of tags, with the name
+// returned by name for the absolute url. Relative urls are resolved against
+// the url of the playlist.
+func rewriteHLSPlaylist(playlist []byte, playlistURL *url.URL, name func(rawURL string) string) []byte {
+	rewrite := func(ref string) string {
+		u, err := playlistURL.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return url.PathEscape(name(u.String()))
+	}
+
+	var b bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(playlist))
+	scanner.Buffer(make([]byte, 64*1024), maxProxiedPlaylistSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			line = hlsURIAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+				return `URI="` + rewrite(hlsURIAttribute.FindStringSubmatch(attr)[1]) + `"`
+			})
+		default:
+			line = rewrite(trimmed)
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func (a *Application) serveRemote(w http.ResponseWriter, r *http.Request, m *servedMedia, name string) {
+	remoteURL, err := m.remoteURL(name)
+	if err != nil {
+		http.Error(w, "Invalid url", http.StatusNotFound)
+		return
+	}
+
+	req, err := http.NewRequest(r.Method, remoteURL, nil)
+	if err != nil {
+		http.Error(w, "Invalid url", http.StatusBadRequest)
+		return
+	}
+	req = req.WithContext(r.Context())
+	for name, values := range a.proxyHeaders {
+		req.Header[name] = values
+	}
+	for _, h := range proxiedRequestHeaders {
+		if v := r.Header.Get(h); v != "" {
+			req.Header.Set(h, v)
+		}
+	}
+
+	resp, err := a.proxyClient.Do(req)
+	if err != nil {
+		a.log("unable to proxy %s: %v", remoteURL, err)
+		http.Error(w, "Unable to fetch remote media", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	// HLS playback on the chromecast requires CORS headers, which a lot of
+	// servers don't send.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	// The urls in playlists are rewritten, otherwise absolute urls would
+	// be loaded by the chromecast directly, without the proxy headers.
+	if resp.StatusCode == http.StatusOK && r.Method != http.MethodHead && isHLSPlaylistResponse(resp) {
+		playlist, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProxiedPlaylistSize+1))
+		if err != nil || len(playlist) > maxProxiedPlaylistSize {
+			a.log("unable to proxy playlist %s: %v", remoteURL, err)
+			http.Error(w, "Unable to fetch remote playlist", http.StatusBadGateway)
+			return
+		}
+		playlist = rewriteHLSPlaylist(playlist, resp.Request.URL, m.resourceName)
+		w.Header().Set("Content-Type", "application/x-mpegURL")
+		w.Header().Set("Content-Length", strconv.Itoa(len(playlist)))
+		w.Write(playlist)
+		return
+	}
+
+	for _, h := range proxiedResponseHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		a.log("error proxying %s: %v", remoteURL, err)
+	}
+}
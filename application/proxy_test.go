@@ -0,0 +1,123 @@
+package application
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+func TestRewriteHLSPlaylist(t *testing.T) {
+	playlist := "#EXTM3U\r\n" +
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\",IV=0x1\r\n" +
+		"#EXTINF:6.0,\r\n" +
+		"segment 1.ts\r\n" +
+		"\r\n" +
+		"#EXTINF:6.0,\r\n" +
+		"https://cdn.example.com/b/segment2.ts?sig=1\r\n"
+	base, _ := url.Parse("https://example.com/a/index.m3u8")
+
+	var urls []string
+	got := rewriteHLSPlaylist([]byte(playlist), base, func(rawURL string) string {
+		urls = append(urls, rawURL)
+		return fmt.Sprintf("name %d", len(urls))
+	})
+	want := "#EXTM3U\n" +
+		"#EXT-X-KEY:METHOD=AES-128,URI=\"name%201\",IV=0x1\n" +
+		"#EXTINF:6.0,\n" +
+		"name%202\n" +
+		"\n" +
+		"#EXTINF:6.0,\n" +
+		"name%203\n"
+	if string(got) != want {
+		t.Errorf("expected playlist\n%s\ngot\n%s", want, got)
+	}
+	wantURLs := []string{
+		"https://example.com/a/key.bin",
+		"https://example.com/a/segment%201.ts",
+		"https://cdn.example.com/b/segment2.ts?sig=1",
+	}
+	if strings.Join(urls, " ") != strings.Join(wantURLs, " ") {
+		t.Errorf("expected urls %q, got %q", wantURLs, urls)
+	}
+}
+
+func TestServeRemote(t *testing.T) {
+	var requested []string
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/live/index.m3u8":
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte("#EXTM3U\n#EXTINF:6.0,\nsegment0.ts\n#EXTINF:6.0,\nhttp://" + r.Host + "/other/segment1.ts\n"))
+		case "/live/segment0.ts", "/other/segment1.ts":
+			w.Header().Set("Content-Type", "video/MP2T")
+			w.Write([]byte(r.URL.Path))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer remote.Close()
+
+	headers, err := ParseHeaders([]string{"Authorization: Bearer secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewApplication("", false, false, WithStore(storage.NewMemoryStore()), WithRemoteProxy(headers, false))
+	m := newServedMedia(remote.URL+"/live/index.m3u8", false, false, fullTranscode)
+	if err := a.servedMedia.register(m); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/media/"+m.token+"/"+name, nil)
+		rec := httptest.NewRecorder()
+		a.serveMedia(rec, req)
+		return rec
+	}
+
+	// Paths next to the media aren't proxied until a playlist lists them.
+	for _, name := range []string{"segment0.ts", "..%2Fadmin", "0-segment0.ts"} {
+		if rec := get(name); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", name, rec.Code)
+		}
+	}
+	if len(requested) != 0 {
+		t.Fatalf("expected the remote not to be requested, got %q", requested)
+	}
+
+	rec := get(m.name)
+	if rec.Code != http.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("expected the playlist with CORS headers, got %d %v", rec.Code, rec.Header())
+	}
+	var segments []string
+	for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			segments = append(segments, line)
+		}
+	}
+	if len(segments) != 2 || segments[0] != "0-segment0.ts" || segments[1] != "1-segment1.ts" {
+		t.Fatalf("expected the segments to be rewritten, got %q", rec.Body.String())
+	}
+
+	// Both the relative and absolute segments go through the proxy, with
+	// the headers.
+	for i, want := range []string{"/live/segment0.ts", "/other/segment1.ts"} {
+		if rec := get(segments[i]); rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("%s: expected %q, got %d %q", segments[i], want, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Reloading the playlist keeps the names.
+	if rec := get(m.name); !strings.Contains(rec.Body.String(), "\n1-segment1.ts\n") {
+		t.Errorf("expected the reloaded playlist to keep the names, got %q", rec.Body.String())
+	}
+}
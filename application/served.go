@@ -0,0 +1,124 @@
+package application
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+const (
+	// servedMediaKey is the storage key of the files served under each
+	// media token, so the local file behind a content url on the chromecast
+	// can be found by any go-chromecast process.
+	servedMediaKey = "application/served"
+
+	// servedMediaTTL is how long the file served under a token is kept.
+	servedMediaTTL = 30 * 24 * time.Hour
+)
+
+// ErrUnknownServedMedia is returned when a content url was served by a
+// go-chromecast process, but the file it served isn't known.
+var ErrUnknownServedMedia = errors.New("media was served by another go-chromecast process, and its file is unknown")
+
+// servedFile is the file or url served under a media token.
+type servedFile struct {
+	Filename string `json:"filename"`
+	// Served is when the media was served, as a unix timestamp.
+	Served int64 `json:"served"`
+}
+
+// recordServedMedia stores the file or url served under the token of each
+// media item, failures are logged as playing the media doesn't depend on
+// them. Entries older than servedMediaTTL are removed.
+func (a *Application) recordServedMedia(mediaItems []mediaItem) {
+	if a.cacheDisabled {
+		return
+	}
+	now := time.Now()
+	err := a.cache.Update(servedMediaKey, func(b []byte) ([]byte, error) {
+		served := map[string]servedFile{}
+		if len(b) > 0 {
+			if err := json.Unmarshal(b, &served); err != nil {
+				return nil, errors.Wrap(err, "unable to parse served media")
+			}
+		}
+		for token, f := range served {
+			if now.Sub(unixTime(f.Served)) > servedMediaTTL {
+				delete(served, token)
+			}
+		}
+		for _, mi := range mediaItems {
+			if mi.served != nil && mi.served.input == liveInputNone && mi.served.data == nil {
+				served[mi.served.token] = servedFile{Filename: mi.served.filename, Served: now.Unix()}
+			}
+		}
+		return json.Marshal(served)
+	})
+	if err != nil {
+		logrus.WithField("package", "application").WithError(err).Error("unable to store served media")
+	}
+}
+
+// ServedFilename returns the local file, or the proxied url, that
+// go-chromecast served at the content url of media on the chromecast. Any
+// other content url is returned as it is. ErrUnknownServedMedia is returned
+// if the media was served by a go-chromecast process, but its file isn't
+// known, ie: because the cache is disabled.
+func (a *Application) ServedFilename(contentURL string) (string, error) {
+	token, ok := servedMediaToken(contentURL)
+	if !ok {
+		return contentURL, nil
+	}
+	a.servedMedia.mu.Lock()
+	m, ok := a.servedMedia.items[token]
+	a.servedMedia.mu.Unlock()
+	if ok {
+		return m.filename, nil
+	}
+	if a.cacheDisabled {
+		return "", ErrUnknownServedMedia
+	}
+	return lookupServedFilename(a.cache, token)
+}
+
+func lookupServedFilename(store storage.Store, token string) (string, error) {
+	b, err := store.Load(servedMediaKey)
+	if err != nil {
+		return "", err
+	}
+	served := map[string]servedFile{}
+	if len(b) > 0 {
+		if err := json.Unmarshal(b, &served); err != nil {
+			return "", errors.Wrap(err, "unable to parse served media")
+		}
+	}
+	f, ok := served[token]
+	if !ok {
+		return "", ErrUnknownServedMedia
+	}
+	return f.Filename, nil
+}
+
+// servedMediaToken returns the media token in a content url served by
+// go-chromecast, ie: http://<ip>:<port>/media/<token>/<name>.
+func servedMediaToken(contentURL string) (string, bool) {
+	u, err := url.Parse(contentURL)
+	if err != nil || u.Scheme != "http" || !strings.HasPrefix(u.Path, mediaPathPrefix) {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(u.Path, mediaPathPrefix), "/", 2)
+	if len(parts) != 2 || len(parts[0]) != 2*mediaTokenSize {
+		return "", false
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return "", false
+	}
+	return parts[0], true
+}
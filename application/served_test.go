@@ -0,0 +1,44 @@
+package application
+
+import (
+	"testing"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+func TestServedFilename(t *testing.T) {
+	store := storage.NewMemoryStore()
+	a := NewApplication("", false, false, WithStore(store))
+	served := newServedMedia("/music/song.flac", false, false, fullTranscode)
+	if err := a.servedMedia.register(served); err != nil {
+		t.Fatal(err)
+	}
+	a.recordServedMedia([]mediaItem{{filename: served.filename, served: served}})
+	contentURL := "http://10.0.0.2:34567" + served.path()
+
+	// Another process only knows the file from the store.
+	other := NewApplication("", false, false, WithStore(store))
+	tests := []struct {
+		url     string
+		want    string
+		wantErr error
+	}{
+		{contentURL, "/music/song.flac", nil},
+		{"http://10.0.0.2:34567/media/0123456789abcdef0123456789abcdef/other.mp3", "", ErrUnknownServedMedia},
+		{"https://example.com/media/stream.mp3", "https://example.com/media/stream.mp3", nil},
+		{"http://example.com/podcast.mp3", "http://example.com/podcast.mp3", nil},
+	}
+	for _, app := range []*Application{a, other} {
+		for _, test := range tests {
+			got, err := app.ServedFilename(test.url)
+			if got != test.want || err != test.wantErr {
+				t.Errorf("%s: expected %q (%v), got %q (%v)", test.url, test.want, test.wantErr, got, err)
+			}
+		}
+	}
+
+	disabled := NewApplication("", false, true, WithStore(store))
+	if _, err := disabled.ServedFilename(contentURL); err != ErrUnknownServedMedia {
+		t.Errorf("expected ErrUnknownServedMedia with the cache disabled, got %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package application
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+
+	"github.com/grasparv/go-chromecast/cast"
+	pb "github.com/grasparv/go-chromecast/cast/proto"
+)
+
+// Slideshow plays the images and videos as a queue on the chromecast. Images
+// are shown for duration seconds and videos are played until they end. If
+// repeat is set the slideshow starts again after the last item.
+func (a *Application) Slideshow(filenames []string, duration int, repeat bool) error {
+	// Images are never transcoded, but videos the chromecast can't play are.
+	mediaItems, err := a.loadAndServeFiles(filenames, "", true)
+	if err != nil {
+		return errors.Wrap(err, "unable to load and serve files")
+	}
+
+	if err := a.ensureIsDefaultMediaReceiver(); err != nil {
+		return err
+	}
+
+	items := make([]cast.QueueLoadItem, len(mediaItems))
+	for i, mi := range mediaItems {
+		items[i] = cast.QueueLoadItem{
+			Autoplay: true,
+			Media: cast.MediaItem{
+				ContentId:   mi.contentURL,
+				StreamType:  mi.streamType(),
+				ContentType: mi.contentType,
+			},
+		}
+		if mi.isImage() {
+			items[i].PlaybackDuration = duration
+		}
+	}
+
+	var repeatMode string
+	if repeat {
+		repeatMode = "REPEAT_ALL"
+	} else {
+		repeatMode = "REPEAT_OFF"
+	}
+
+	// The message funcs are called from a single goroutine that must not
+	// block once the slideshow is over.
+	statuses := make(chan cast.Media, 16)
+	done := make(chan struct{})
+	defer close(done)
+	a.AddMessageFunc(func(msg *pb.CastMessage) {
+		payload := []byte(*msg.PayloadUtf8)
+		if messageType, _ := jsonparser.GetString(payload, "type"); messageType != "MEDIA_STATUS" {
+			return
+		}
+		var resp cast.MediaStatusResponse
+		if err := json.Unmarshal(payload, &resp); err != nil {
+			return
+		}
+		for _, status := range resp.Status {
+			select {
+			case statuses <- status:
+			case <-done:
+				return
+			}
+		}
+	})
+
+	// Send the command to the chromecast
+	if err := a.sendMediaLoad(&cast.QueueLoad{
+		PayloadHeader: cast.QueueLoadHeader,
+		CurrentTime:   0,
+		StartIndex:    0,
+		RepeatMode:    repeatMode,
+		Items:         items,
+	}); err != nil {
+		return errors.Wrap(err, "unable to load slideshow")
+	}
+
+	return a.runSlideshow(mediaItems, time.Second*time.Duration(duration), repeat, statuses)
+}
+
+// runSlideshow advances the slideshow as the chromecast reports which item
+// is playing. The default media receiver doesn't move on from an image by
+// itself, so each image is skipped once it has been shown for duration.
+// Videos are left to play until they end, the receiver then starts the next
+// item in the queue itself.
+func (a *Application) runSlideshow(mediaItems []mediaItem, duration time.Duration, repeat bool, statuses <-chan cast.Media) error {
+	contentIndex := make(map[string]int, len(mediaItems))
+	for i, mi := range mediaItems {
+		contentIndex[mi.contentURL] = i
+	}
+
+	// The receiver assigns its own ids to queue items, they are matched
+	// to the media items by their content id when it is included in the status.
+	itemIndex := map[int]int{}
+	currentItemID, index, mediaSessionID := 0, -1, 0
+	timer := time.NewTimer(duration)
+	timer.Stop()
+	for {
+		select {
+		case status := <-statuses:
+			if i, ok := contentIndex[status.Media.ContentId]; ok && status.CurrentItemId != 0 {
+				itemIndex[status.CurrentItemId] = i
+			}
+			if status.CurrentItemId == 0 || status.CurrentItemId == currentItemID {
+				continue
+			}
+
+			// A different item has started playing.
+			currentItemID = status.CurrentItemId
+			if i, ok := itemIndex[currentItemID]; ok {
+				index = i
+			} else {
+				// Without the content id assume the queue moved on by one.
+				index = (index + 1) % len(mediaItems)
+			}
+			a.log("slideshow is showing item %d/%d", index+1, len(mediaItems))
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			if mediaItems[index].isImage() {
+				timer.Reset(duration)
+			}
+			mediaSessionID = status.MediaSessionId
+		case <-timer.C:
+			// The last image has been shown long enough, leave it on the
+			// screen rather than going back to the idle screen.
+			if index == len(mediaItems)-1 && !repeat {
+				return nil
+			}
+			if err := a.sendMediaRecv(&cast.QueueUpdate{
+				PayloadHeader:  cast.QueueUpdateHeader,
+				MediaSessionId: mediaSessionID,
+				Jump:           1,
+			}); err != nil {
+				return errors.Wrap(err, "unable to show the next item")
+			}
+		// Media has finished playing
+		case <-a.mediaFinished:
+			return nil
+		}
+	}
+}
+
+func (mi mediaItem) isImage() bool {
+	return strings.HasPrefix(mi.contentType, "image/")
+}
@@ -0,0 +1,83 @@
+package application
+
+import (
+	"fmt"
+
+	"github.com/grasparv/go-chromecast/probe"
+)
+
+// transcodeProfile is how ffmpeg should treat the streams of a media file
+// when it is being transcoded.
+type transcodeProfile struct {
+	copyVideo bool
+	copyAudio bool
+	// dropVideo removes the video stream, used for audio-only devices.
+	dropVideo bool
+	// maxWidth, maxHeight and h264Level limit re-encoded video to what the
+	// device can play, 0 doesn't limit it.
+	maxWidth  int
+	maxHeight int
+	h264Level int
+}
+
+// fullTranscode re-encodes both audio and video, this is what is used when
+// nothing is known about the media file.
+var fullTranscode = transcodeProfile{}
+
+func profileForDecision(decision probe.Decision, caps probe.Capabilities) transcodeProfile {
+	p := transcodeProfile{
+		dropVideo: !caps.Video,
+		maxWidth:  caps.MaxWidth,
+		maxHeight: caps.MaxHeight,
+		h264Level: caps.H264Level,
+	}
+	switch decision {
+	case probe.Remux:
+		p.copyVideo = true
+		p.copyAudio = true
+	case probe.TranscodeAudio:
+		p.copyVideo = true
+	}
+	return p
+}
+
+// codecArgs returns the ffmpeg codec arguments for the profile.
+func (p transcodeProfile) codecArgs() []string {
+	var args []string
+	switch {
+	case p.dropVideo:
+		args = append(args, "-vn")
+	case p.copyVideo:
+		args = append(args, "-vcodec", "copy")
+	default:
+		args = append(args, "-vcodec", "h264", "-pix_fmt", "yuv420p")
+		if p.maxWidth > 0 && p.maxHeight > 0 {
+			// Only ever scale down, keeping the aspect ratio and the even
+			// dimensions h264 needs.
+			args = append(args, "-vf", fmt.Sprintf(
+				"scale='min(%d,iw)':'min(%d,ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2",
+				p.maxWidth, p.maxHeight))
+		}
+		if p.h264Level > 0 {
+			args = append(args, "-profile:v", "high", "-level", fmt.Sprintf("%d.%d", p.h264Level/10, p.h264Level%10))
+		}
+	}
+	if p.copyAudio {
+		args = append(args, "-acodec", "copy")
+	} else {
+		args = append(args,
+			"-acodec", "aac",
+			"-ac", "2", // chromecasts don't support more than two audio channels
+		)
+	}
+	return args
+}
+
+// contentType returns the content-type of the transcoded media when it
+// is served as a single mp4 stream.
+func (p transcodeProfile) contentType() string {
+	if p.dropVideo {
+		return "audio/mp4"
+	}
+	return "video/mp4"
+}
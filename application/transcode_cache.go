@@ -0,0 +1,263 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Number of bytes hashed from the start and end of a file to build
+	// its cache key. Hashing the whole file would take too long for video.
+	transcodeCacheHashLen = 1 << 20
+
+	transcodeCacheExt = ".mp4"
+)
+
+// WithTranscodeCache stores transcoded media in dir so it doesn't need to be
+// transcoded again the next time it is played. The least recently used media
+// is removed once the cache grows over maxSize bytes. The next prefetch items
+// in the queue are transcoded in the background while the current one plays.
+func WithTranscodeCache(dir string, maxSize int64, prefetch int) ApplicationOption {
+	return func(a *Application) {
+		a.transcodeCache = &transcodeCache{
+			dir:        dir,
+			maxSize:    maxSize,
+			prefetch:   prefetch,
+			inProgress: map[string]bool{},
+		}
+	}
+}
+
+// transcodeCache is an on-disk cache of transcoded media, keyed by a hash
+// of the media file and the transcode profile used.
+type transcodeCache struct {
+	dir      string
+	maxSize  int64
+	prefetch int
+
+	mu         sync.Mutex
+	inProgress map[string]bool
+}
+
+// cacheable returns whether the transcoded output of the media can be
+// cached, only local files transcoded into a single mp4 can be. Urls the
+// chromecast loads directly aren't served, so m can be nil.
+func (c *transcodeCache) cacheable(m *servedMedia) bool {
+	return c != nil && m != nil && m.transcode && !m.hls && !m.remote && m.input == liveInputNone
+}
+
+// key returns the cache key for the media, the key changes if either the
+// contents of the file or the transcode profile change.
+func (c *transcodeCache) key(m *servedMedia) (string, error) {
+	f, err := os.Open(m.filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%+v:", fileInfo.Size(), m.profile)
+	if _, err := io.CopyN(h, f, transcodeCacheHashLen); err != nil && err != io.EOF {
+		return "", err
+	}
+	// The end is hashed from where the start left off for files smaller
+	// than twice the hashed length, so no part of them is skipped.
+	if rest := fileInfo.Size() - transcodeCacheHashLen; rest > 0 {
+		if rest > transcodeCacheHashLen {
+			rest = transcodeCacheHashLen
+		}
+		if _, err := f.Seek(-rest, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *transcodeCache) path(key string) string {
+	return filepath.Join(c.dir, key+transcodeCacheExt)
+}
+
+// lookup returns the path of the cached transcoded media if it exists. The
+// modification time is updated to mark it as recently used.
+func (c *transcodeCache) lookup(key string) (string, bool) {
+	p := c.path(key)
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return p, true
+}
+
+// create returns a temporary file to write transcoded media into. The file
+// is only added to the cache once commit is called. If the media is already
+// being written to the cache false is returned.
+func (c *transcodeCache) create(key string) (*os.File, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inProgress[key] {
+		return nil, false, nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return nil, false, errors.Wrap(err, "unable to create transcode cache directory")
+	}
+	f, err := ioutil.TempFile(c.dir, key+".*.tmp")
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to create transcode cache file")
+	}
+	c.inProgress[key] = true
+	return f, true, nil
+}
+
+// commit adds the temporary file to the cache if ok is set, otherwise
+// the file is removed.
+func (c *transcodeCache) commit(key string, f *os.File, ok bool) {
+	f.Close()
+	c.mu.Lock()
+	delete(c.inProgress, key)
+	c.mu.Unlock()
+
+	if !ok {
+		os.Remove(f.Name())
+		return
+	}
+	if err := os.Rename(f.Name(), c.path(key)); err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	c.evict()
+}
+
+// evict removes the least recently used media until the cache is no
+// larger than maxSize.
+func (c *transcodeCache) evict() {
+	evictLRU(c.dir, transcodeCacheExt, c.maxSize)
+}
+
+// evictLRU removes the least recently used files with the extension ext
+// from dir, until they take up no more than maxSize bytes. Files are marked
+// as used by updating their modification time.
+func evictLRU(dir, ext string, maxSize int64) {
+	if maxSize <= 0 {
+		return
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var total int64
+	cached := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ext) {
+			continue
+		}
+		cached = append(cached, f)
+		total += f.Size()
+	}
+
+	sort.Slice(cached, func(i, j int) bool { return cached[i].ModTime().Before(cached[j].ModTime()) })
+	for _, f := range cached {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err == nil {
+			total -= f.Size()
+		}
+	}
+}
+
+// pretranscode transcodes the media into the cache as fast as possible,
+// it is used for media that will be played next.
+func (c *transcodeCache) pretranscode(t *transcoder, m *servedMedia, inputArgs []string) error {
+	key, err := c.key(m)
+	if err != nil {
+		return err
+	}
+	if _, ok := c.lookup(key); ok {
+		return nil
+	}
+	f, ok, err := c.create(key)
+	if err != nil || !ok {
+		return err
+	}
+
+	args := append([]string{}, inputArgs...)
+	args = append(args, m.profile.codecArgs()...)
+	args = append(args,
+		"-f", "mp4",
+		"-movflags", "frag_keyframe+faststart",
+		"-strict", "-experimental",
+		"pipe:1",
+	)
+	// The transcoder kills the process when the application is closed.
+	err = t.run(context.Background(), m.filename, args, nil, f)
+	c.commit(key, f, err == nil)
+	return errors.Wrapf(err, "unable to pretranscode %q", m.filename)
+}
+
+// prefetchAfter pre-transcodes the items in the queue that come after the
+// media that has just started playing.
+func (a *Application) prefetchAfter(m *servedMedia) {
+	c := a.transcodeCache
+	if c == nil || c.prefetch <= 0 {
+		return
+	}
+	next := c.prefetchItems(a.queue, m)
+	if len(next) == 0 {
+		return
+	}
+
+	// Transcode one item at a time so the currently playing media
+	// isn't starved of CPU.
+	go func() {
+		for _, n := range next {
+			// Read the input at full speed, rather than at playback speed.
+			inputArgs := []string{"-i", n.filename}
+			if err := c.pretranscode(a.transcoder, n, inputArgs); err != nil {
+				a.log("unable to pretranscode %q: %v", n.filename, err)
+			}
+		}
+	}()
+}
+
+// prefetchItems returns up to prefetch cacheable items that come after m
+// in the queue.
+func (c *transcodeCache) prefetchItems(queue []*servedMedia, m *servedMedia) []*servedMedia {
+	var next []*servedMedia
+	for i, q := range queue {
+		if q != m {
+			continue
+		}
+		for _, n := range queue[i+1:] {
+			if len(next) == c.prefetch {
+				break
+			}
+			if c.cacheable(n) {
+				next = append(next, n)
+			}
+		}
+		break
+	}
+	return next
+}
@@ -0,0 +1,141 @@
+package application
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTranscodeCacheKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := &transcodeCache{dir: dir}
+	filename := filepath.Join(dir, "film.mkv")
+	key := func(data []byte, profile transcodeProfile) string {
+		if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		m := newServedMedia(filename, true, false, profile)
+		k, err := c.key(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	change := func(data []byte, i int) []byte {
+		changed := append([]byte{}, data...)
+		changed[i]++
+		return changed
+	}
+
+	data := bytes.Repeat([]byte{1}, 3*transcodeCacheHashLen)
+	base := key(data, fullTranscode)
+	if key(data, fullTranscode) != base {
+		t.Errorf("expected the key to be the same for the same file")
+	}
+	// Only the start and end of the file are hashed.
+	if key(change(data, len(data)/2), fullTranscode) != base {
+		t.Errorf("expected the middle of the file not to change the key")
+	}
+
+	tests := map[string]string{
+		"size":    key(data[1:], fullTranscode),
+		"first":   key(change(data, 0), fullTranscode),
+		"last":    key(change(data, len(data)-1), fullTranscode),
+		"profile": key(data, transcodeProfile{copyAudio: true}),
+		"limits":  key(data, transcodeProfile{maxWidth: 1280, maxHeight: 720}),
+	}
+	for name, k := range tests {
+		if k == base {
+			t.Errorf("%s: expected a different key", name)
+		}
+	}
+
+	// Small files are hashed completely.
+	small := bytes.Repeat([]byte{1}, transcodeCacheHashLen+10)
+	if key(small, fullTranscode) == key(change(small, transcodeCacheHashLen+5), fullTranscode) {
+		t.Errorf("expected any change of a small file to change the key")
+	}
+
+	if _, err := c.key(newServedMedia(filepath.Join(dir, "missing.mkv"), true, false, fullTranscode)); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	files := []struct {
+		name string
+		used time.Time
+	}{
+		{"oldest.mp4", now.Add(-3 * time.Hour)},
+		{"old.mp4", now.Add(-2 * time.Hour)},
+		{"new.mp4", now.Add(-time.Hour)},
+		// Files being written and other files are never removed.
+		{"partial.mp4.123.tmp", now.Add(-4 * time.Hour)},
+		{"other.txt", now.Add(-4 * time.Hour)},
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, f.name)
+		if err := ioutil.WriteFile(p, make([]byte, 10), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(p, f.used, f.used)
+	}
+	remaining := func() []string {
+		var names []string
+		infos, _ := ioutil.ReadDir(dir)
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		return names
+	}
+
+	// A size of 0 doesn't limit the cache.
+	evictLRU(dir, transcodeCacheExt, 0)
+	if len(remaining()) != len(files) {
+		t.Errorf("expected nothing to be removed, got %q", remaining())
+	}
+
+	evictLRU(dir, transcodeCacheExt, 15)
+	want := []string{"new.mp4", "other.txt", "partial.mp4.123.tmp"}
+	if got := remaining(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("expected %q to remain, got %q", want, got)
+	}
+}
+
+func TestPrefetchItems(t *testing.T) {
+	transcoded := func(name string) *servedMedia {
+		return newServedMedia("/videos/"+name, true, false, fullTranscode)
+	}
+	current := transcoded("1.mkv")
+	direct := newServedMedia("/videos/2.mp4", false, false, fullTranscode)
+	hls := newServedMedia("/videos/3.mkv", true, true, fullTranscode)
+	next, after, last := transcoded("4.mkv"), transcoded("5.mkv"), transcoded("6.mkv")
+	queue := []*servedMedia{transcoded("0.mkv"), current, direct, hls, nil, next, after, last}
+
+	c := &transcodeCache{prefetch: 2}
+	got := c.prefetchItems(queue, current)
+	if len(got) != 2 || got[0] != next || got[1] != after {
+		t.Errorf("expected the next 2 cacheable items, got %v", got)
+	}
+	if got := c.prefetchItems(queue, last); len(got) != 0 {
+		t.Errorf("expected nothing after the last item, got %v", got)
+	}
+	if got := c.prefetchItems(queue, transcoded("other.mkv")); len(got) != 0 {
+		t.Errorf("expected nothing for media that isn't queued, got %v", got)
+	}
+}
@@ -0,0 +1,32 @@
+package application
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/grasparv/go-chromecast/probe"
+)
+
+func TestCodecArgs(t *testing.T) {
+	caps := probe.CapabilitiesForModel("Chromecast")
+	tests := []struct {
+		name    string
+		profile transcodeProfile
+		want    string
+	}{
+		{"unknown device", fullTranscode, "-vcodec h264 -pix_fmt yuv420p -acodec aac -ac 2"},
+		{
+			"full transcode",
+			profileForDecision(probe.TranscodeFull, caps),
+			"-vcodec h264 -pix_fmt yuv420p -vf scale='min(1920,iw)':'min(1080,ih)':force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2 -profile:v high -level 4.1 -acodec aac -ac 2",
+		},
+		{"remux", profileForDecision(probe.Remux, caps), "-vcodec copy -acodec copy"},
+		{"transcode audio", profileForDecision(probe.TranscodeAudio, caps), "-vcodec copy -acodec aac -ac 2"},
+		{"audio only device", profileForDecision(probe.TranscodeFull, probe.CapabilitiesForModel("Google Home")), "-vn -acodec aac -ac 2"},
+	}
+	for _, test := range tests {
+		if got := strings.Join(test.profile.codecArgs(), " "); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package application
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultMaxTranscodes = 2
+
+	// Number of ffmpeg log lines kept to report when a transcode fails.
+	transcoderErrorLines = 10
+
+	// How often the progress of a running transcode is logged.
+	transcodeProgressInterval = 10 * time.Second
+)
+
+// ErrTranscoderClosed is returned when a transcode is started after the
+// application has been closed.
+var ErrTranscoderClosed = errors.New("transcoder has been closed")
+
+// WithMaxTranscodes caps the number of ffmpeg processes that can run at the
+// same time, additional transcodes wait until one finishes.
+func WithMaxTranscodes(max int) ApplicationOption {
+	return func(a *Application) {
+		a.maxTranscodes = max
+	}
+}
+
+// transcodeProgress is the progress of a running ffmpeg process.
+type transcodeProgress struct {
+	Filename string
+	Started  time.Time
+	// Position is how far into the media ffmpeg has transcoded.
+	Position time.Duration
+	// Speed is how fast the transcode runs compared to playback speed.
+	Speed string
+}
+
+// transcode is a single running ffmpeg process.
+type transcode struct {
+	cancel   context.CancelFunc
+	progress transcodeProgress
+	// reported is when the progress was last logged.
+	reported time.Time
+}
+
+// transcoder manages the ffmpeg processes started by the application. Each
+// process is tied to a context, normally the one of the http request, so it
+// is killed as soon as the chromecast goes away.
+type transcoder struct {
+	slots chan struct{}
+	debug bool
+	log   func(message string, args ...interface{})
+
+	mu      sync.Mutex
+	running map[*transcode]bool
+	closed  bool
+}
+
+func newTranscoder(maxConcurrent int, debug bool, log func(string, ...interface{})) *transcoder {
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxTranscodes
+	}
+	return &transcoder{
+		slots:   make(chan struct{}, maxConcurrent),
+		debug:   debug,
+		log:     log,
+		running: map[*transcode]bool{},
+	}
+}
+
+// run starts ffmpeg with args and waits for it to exit. ffmpeg is killed
+// if ctx is done before it has finished.
+func (t *transcoder) run(ctx context.Context, filename string, args []string, stdin io.Reader, stdout io.Writer) error {
+	// Wait for a free slot, giving up if the client goes away first.
+	select {
+	case t.slots <- struct{}{}:
+		defer func() { <-t.slots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	now := time.Now()
+	tc := &transcode{
+		cancel:   cancel,
+		progress: transcodeProgress{Filename: filename, Started: now},
+		reported: now,
+	}
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return ErrTranscoderClosed
+	}
+	t.running[tc] = true
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.running, tc)
+		t.mu.Unlock()
+	}()
+
+	// Progress is written to stderr along with any errors, so stderr is
+	// always read rather than only when debugging.
+	args = append([]string{"-hide_banner", "-nostats", "-progress", "pipe:2"}, args...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return errors.Wrap(err, "unable to get ffmpeg stderr")
+	}
+
+	t.log("starting ffmpeg for %q: %s", filename, strings.Join(args, " "))
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "unable to start ffmpeg")
+	}
+	// All of stderr has to be read before waiting for ffmpeg to exit.
+	lastLines := t.readStderr(tc, stderr)
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			t.log("stopped ffmpeg for %q: %v", filename, ctx.Err())
+			return ctx.Err()
+		}
+		return errors.Wrapf(err, "ffmpeg failed: %s", strings.Join(lastLines, "; "))
+	}
+	t.log("finished ffmpeg for %q", filename)
+	return nil
+}
+
+// readStderr parses the progress reported by ffmpeg until stderr is closed,
+// and returns the last log lines to report if ffmpeg failed.
+func (t *transcoder) readStderr(tc *transcode, stderr io.Reader) []string {
+	var lines []string
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if key, value, ok := progressField(line); ok {
+			t.updateProgress(tc, key, value)
+			continue
+		}
+		if t.debug {
+			fmt.Fprintln(os.Stderr, line)
+		}
+		lines = append(lines, line)
+		if len(lines) > transcoderErrorLines {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
+
+// progressField returns the key and value of a '-progress' output line.
+func progressField(line string) (string, string, bool) {
+	parts := strings.SplitN(line, "=", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	switch parts[0] {
+	case "frame", "fps", "bitrate", "total_size", "out_time_us", "out_time_ms", "out_time",
+		"dup_frames", "drop_frames", "speed", "progress":
+		return parts[0], strings.TrimSpace(parts[1]), true
+	}
+	// Per stream quality values, ie: 'stream_0_0_q=28.0'.
+	if strings.HasPrefix(parts[0], "stream_") {
+		return parts[0], strings.TrimSpace(parts[1]), true
+	}
+	return "", "", false
+}
+
+func (t *transcoder) updateProgress(tc *transcode, key, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch key {
+	case "out_time_us":
+		if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+			tc.progress.Position = time.Duration(us) * time.Microsecond
+		}
+	case "speed":
+		tc.progress.Speed = value
+	case "progress":
+		t.log("transcoding %q: position=%s speed=%s", tc.progress.Filename, tc.progress.Position, tc.progress.Speed)
+		// Long transcodes are reported at intervals even when not
+		// debugging, so it is clear they are still making progress.
+		if now := time.Now(); now.Sub(tc.reported) >= transcodeProgressInterval {
+			tc.reported = now
+			logrus.WithField("package", "application").WithFields(logrus.Fields{
+				"filename": tc.progress.Filename,
+				"position": tc.progress.Position.Round(time.Second),
+				"speed":    tc.progress.Speed,
+			}).Info("transcoding")
+		}
+	}
+}
+
+// close kills all running transcodes, and stops any new ones from starting.
+func (t *transcoder) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for tc := range t.running {
+		tc.cancel()
+	}
+}
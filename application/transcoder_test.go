@@ -0,0 +1,44 @@
+package application
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTranscodeProgressIsReported(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	tr := newTranscoder(1, false, func(string, ...interface{}) {})
+	tc := &transcode{
+		progress: transcodeProgress{Filename: "movie.mkv"},
+		reported: time.Now(),
+	}
+	update := func() {
+		for _, line := range []string{"out_time_us=61500000", "speed=2.5x", "progress=continue"} {
+			key, value, ok := progressField(line)
+			if !ok {
+				t.Fatalf("expected %q to be a progress field", line)
+			}
+			tr.updateProgress(tc, key, value)
+		}
+	}
+
+	update()
+	if len(hook.Entries) != 0 {
+		t.Fatalf("expected no progress to be reported before the interval, got %v", hook.Entries)
+	}
+
+	tc.reported = time.Now().Add(-transcodeProgressInterval)
+	update()
+	entry := hook.LastEntry()
+	if len(hook.Entries) != 1 || entry.Level != logrus.InfoLevel {
+		t.Fatalf("expected the progress to be reported once, got %v", hook.Entries)
+	}
+	if entry.Data["filename"] != "movie.mkv" || entry.Data["position"] != 62*time.Second || entry.Data["speed"] != "2.5x" {
+		t.Errorf("unexpected progress %v", entry.Data)
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -60,6 +60,11 @@ func (c *Connection) LocalAddr() (addr string, err error) {
 	return host, err
 }
 
+func (c *Connection) RemoteAddr() (addr string, err error) {
+	host, _, err := net.SplitHostPort(c.conn.RemoteAddr().String())
+	return host, err
+}
+
 func (c *Connection) log(message string, args ...interface{}) {
 	if c.debug {
 		log.WithField("package", "cast").Debugf(message, args...)
@@ -72,11 +77,14 @@ func (c *Connection) connect(addr string, port int) error {
 		Timeout:   dialerTimeout,
 		KeepAlive: dialerKeepAlive,
 	}
-	c.conn, err = tls.DialWithDialer(dialer, "tcp", fmt.Sprintf("%s:%d", addr, port), &tls.Config{
+	// JoinHostPort brackets IPv6 addresses, a link-local address keeps
+	// its zone so it is dialed on the right interface.
+	hostPort := net.JoinHostPort(addr, strconv.Itoa(port))
+	c.conn, err = tls.DialWithDialer(dialer, "tcp", hostPort, &tls.Config{
 		InsecureSkipVerify: true,
 	})
 	if err != nil {
-		return errors.Wrapf(err, "unable to connect to chromecast at '%s:%d'", addr, port)
+		return errors.Wrapf(err, "unable to connect to chromecast at '%s'", hostPort)
 	}
 	c.connected = true
 	return nil
@@ -15,6 +15,9 @@ var (
 	LoadHeader        = PayloadHeader{Type: "LOAD"}         // Loads an application onto the chromecast
 	QueueLoadHeader   = PayloadHeader{Type: "QUEUE_LOAD"}   // Loads an application onto the chromecast
 	QueueUpdateHeader = PayloadHeader{Type: "QUEUE_UPDATE"} // Loads an application onto the chromecast
+
+	QueueGetItemIdsHeader = PayloadHeader{Type: "QUEUE_GET_ITEM_IDS"} // Gets the ids of the items in the queue
+	QueueGetItemsHeader   = PayloadHeader{Type: "QUEUE_GET_ITEMS"}    // Gets the items in the queue by id
 )
 
 type Payload interface {
@@ -48,7 +51,29 @@ type QueueLoad struct {
 type QueueLoadItem struct {
 	Media            MediaItem `json:"media"`
 	Autoplay         bool      `json:"autoplay"`
-	PlaybackDuration int       `json:"playbackDuration"`
+	PlaybackDuration int       `json:"playbackDuration,omitempty"`
+}
+
+type QueueGetItems struct {
+	PayloadHeader
+	MediaSessionId int   `json:"mediaSessionId"`
+	ItemIds        []int `json:"itemIds,omitempty"`
+}
+
+type QueueItemIdsResponse struct {
+	PayloadHeader
+	ItemIds []int `json:"itemIds"`
+}
+
+type QueueItemsResponse struct {
+	PayloadHeader
+	Items []QueueItem `json:"items"`
+}
+
+type QueueItem struct {
+	ItemId           int       `json:"itemId"`
+	Media            MediaItem `json:"media"`
+	PlaybackDuration int       `json:"playbackDuration,omitempty"`
 }
 
 type MediaHeader struct {
@@ -137,6 +162,7 @@ type Media struct {
 	Volume         Volume  `json:"volume"`
 	CurrentItemId  int     `json:"currentItemId"`
 	LoadingItemId  int     `json:"loadingItemId"`
+	RepeatMode     string  `json:"repeatMode"`
 
 	Media MediaItem `json:"media"`
 }
@@ -0,0 +1,59 @@
+// Copyright © 2018 Jonathan Pentecost <pentecostjonathan@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// announceCmd represents the announce command
+var announceCmd = &cobra.Command{
+	Use:   "announce <filename_or_url>",
+	Short: "Play a sound and go back to what was playing",
+	Long: `Interrupt whatever is playing on the chromecast to play a short sound, ie:
+a doorbell, and go back to what was playing afterwards.
+
+The application that was running is relaunched, or if the default media
+receiver was playing, its media and queue are reloaded at the position they
+were at. With --volume the sound is played at that volume, and the previous
+volume is restored afterwards.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			fmt.Printf("requires exactly one argument, should be the media file to announce\n")
+			return
+		}
+		volume, _ := cmd.Flags().GetFloat32("volume")
+		contentType, _ := cmd.Flags().GetString("content-type")
+
+		app, err := castApplication(cmd, args)
+		if err != nil {
+			fmt.Printf("unable to get cast application: %v\n", err)
+			return
+		}
+		if err := app.Announce(args[0], contentType, volume); err != nil {
+			fmt.Printf("unable to announce: %v\n", err)
+			return
+		}
+		return
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(announceCmd)
+	announceCmd.Flags().Float32("volume", 0, "volume to play the sound at, from 0 to 1; 0 keeps the current volume")
+	announceCmd.Flags().StringP("content-type", "c", "", "content-type to serve the media file as")
+}
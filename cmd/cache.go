@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Inspect and manage the cache",
+	Long: `Inspect and manage the cache, which keeps the found devices and the
+played media in the store selected with --store. The speech synthesized by
+'tts' is kept in files next to the store, 'cache clear' removes it too.`,
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls [prefix]",
+	Short: "List the cached keys, with their sizes and ages",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return fmt.Errorf("requires at most one argument, the prefix of the keys to list")
+		}
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		store, err := openStore(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		entries, err := store.Entries(prefix)
+		if err != nil {
+			fmt.Printf("unable to list the cache: %v\n", err)
+			return nil
+		}
+		now := time.Now()
+		for _, e := range entries {
+			expires := "never"
+			if !e.Expires.IsZero() {
+				expires = formatAge(e.Expires.Sub(now))
+			}
+			fmt.Printf("%s size=%d age=%s expires_in=%s\n", e.Key, len(e.Value), formatAge(now.Sub(e.Updated)), expires)
+		}
+		return nil
+	},
+}
+
+var cacheRmCmd = &cobra.Command{
+	Use:   "rm <key|prefix>",
+	Short: "Remove a key, or all the keys starting with a prefix, from the cache",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("requires exactly one argument, the key or prefix of the keys to remove")
+		}
+		store, err := openStore(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		removed, err := removeCacheEntries(store, args[0])
+		if err != nil {
+			fmt.Printf("unable to remove from the cache: %v\n", err)
+			return nil
+		}
+		if removed == 0 {
+			fmt.Printf("no cache keys match %q\n", args[0])
+			return nil
+		}
+		fmt.Printf("removed %d keys\n", removed)
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove everything from the cache, including the played media and synthesized speech",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openStore(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		removed, err := removeCacheEntries(store, "")
+		if err != nil {
+			fmt.Printf("unable to clear the cache: %v\n", err)
+			return nil
+		}
+		fmt.Printf("removed %d keys\n", removed)
+
+		dir, ok, err := ttsCacheDir(cmd)
+		if err != nil || !ok {
+			return nil
+		}
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			fmt.Printf("unable to clear the speech cache: %v\n", err)
+			return nil
+		}
+		fmt.Printf("removed %d speech files\n", len(files))
+		return nil
+	},
+}
+
+var cacheExportCmd = &cobra.Command{
+	Use:   "export [prefix]",
+	Short: "Export the cache, or the keys starting with a prefix, as JSON",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return fmt.Errorf("requires at most one argument, the prefix of the keys to export")
+		}
+		prefix := ""
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+		output, _ := cmd.Flags().GetString("output")
+		store, err := openStore(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		entries, err := store.Entries(prefix)
+		if err != nil {
+			fmt.Printf("unable to list the cache: %v\n", err)
+			return nil
+		}
+		if entries == nil {
+			entries = []storage.Entry{}
+		}
+		b, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Printf("unable to marshal the cache: %v\n", err)
+			return nil
+		}
+		if err := writeOutput(output, append(b, '\n')); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		return nil
+	},
+}
+
+var cacheImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import keys exported with 'cache export', '-' reads from stdin",
+	Long: `Import keys exported with 'cache export', replacing the keys already in
+the cache. Keys keep their expiry, keys that have expired since they were
+exported are skipped.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("requires exactly one argument, the file to import")
+		}
+		store, err := openStore(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		var b []byte
+		if args[0] == "-" {
+			b, err = ioutil.ReadAll(stdin)
+		} else {
+			b, err = ioutil.ReadFile(args[0])
+		}
+		if err != nil {
+			fmt.Printf("unable to read %q: %v\n", args[0], err)
+			return nil
+		}
+		var entries []storage.Entry
+		if err := json.Unmarshal(b, &entries); err != nil {
+			fmt.Printf("unable to parse %q: %v\n", args[0], err)
+			return nil
+		}
+		imported := 0
+		now := time.Now()
+		for _, e := range entries {
+			var ttl time.Duration
+			if !e.Expires.IsZero() {
+				if ttl = e.Expires.Sub(now); ttl <= 0 {
+					continue
+				}
+			}
+			if err := store.Save(e.Key, e.Value, ttl); err != nil {
+				fmt.Printf("unable to import %q: %v\n", e.Key, err)
+				return nil
+			}
+			imported++
+		}
+		fmt.Printf("imported %d keys\n", imported)
+		return nil
+	},
+}
+
+// removeCacheEntries removes key from the store, or if there is no such key
+// all the keys starting with key, and returns how many were removed.
+func removeCacheEntries(store storage.Store, key string) (int, error) {
+	entries, err := store.Entries(key)
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range entries {
+		if e.Key == key {
+			entries = []storage.Entry{e}
+			break
+		}
+	}
+	for i, e := range entries {
+		if err := store.Delete(e.Key); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
+
+// writeOutput writes b to the file output, or to stdout if output is '-'.
+func writeOutput(output string, b []byte) error {
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return errors.Wrapf(err, "unable to create %q", output)
+		}
+		defer f.Close()
+		w = f
+	}
+	if _, err := w.Write(b); err != nil {
+		return errors.Wrapf(err, "unable to write %q", output)
+	}
+	return nil
+}
+
+// formatAge formats d rounded to a second, or to a minute once it is over
+// an hour.
+func formatAge(d time.Duration) string {
+	if d > time.Hour {
+		return d.Round(time.Minute).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheLsCmd)
+	cacheCmd.AddCommand(cacheRmCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cacheExportCmd)
+	cacheCmd.AddCommand(cacheImportCmd)
+	cacheExportCmd.Flags().StringP("output", "o", "-", "file to write the JSON to, '-' writes to stdout")
+}
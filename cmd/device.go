@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/grasparv/go-chromecast/registry"
+)
+
+// deviceCmd represents the device command
+var deviceCmd = &cobra.Command{
+	Use:   "device",
+	Short: "Manage the devices file",
+	Long: `Manage the devices file, which lists devices that can't be discovered
+with mDNS, ie: on guest VLANs, docker networks and VPNs.
+
+Devices in the file are used directly when selected by --device-name or
+--uuid, and are listed along with the discovered devices everywhere else.`,
+}
+
+var deviceAddCmd = &cobra.Command{
+	Use:   "add <name> <address[:port]>",
+	Short: "Add a device to the devices file",
+	Long: `Add a device to the devices file, replacing any device with the same
+name or uuid. The uuid is taken from --uuid.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("requires exactly two arguments, the name and address of the device")
+		}
+		devices, err := loadRegistry(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+
+		host, port := args[1], 0
+		if h, p, err := net.SplitHostPort(args[1]); err == nil {
+			if port, err = strconv.Atoi(p); err != nil {
+				fmt.Printf("port needs to be a number: %v\n", err)
+				return nil
+			}
+			host = h
+		}
+		uuid, _ := cmd.Flags().GetString("uuid")
+		model, _ := cmd.Flags().GetString("model")
+		group, _ := cmd.Flags().GetBool("group")
+		memberOf, _ := cmd.Flags().GetStringSlice("member-of")
+		d := registry.Device{
+			Name:     args[0],
+			UUID:     uuid,
+			Addr:     host,
+			Port:     port,
+			Model:    model,
+			Group:    group,
+			MemberOf: memberOf,
+		}
+		devices.Add(d)
+		if err := devices.Save(); err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		fmt.Printf("added %s\n", formatCastEntry(d.Entry()))
+		return nil
+	},
+}
+
+var deviceRmCmd = &cobra.Command{
+	Use:   "rm <name|uuid>",
+	Short: "Remove a device from the devices file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("requires exactly one argument, the name or uuid of the device")
+		}
+		devices, err := loadRegistry(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		if !devices.Remove(args[0]) {
+			fmt.Printf("no device %q in the devices file\n", args[0])
+			return nil
+		}
+		if err := devices.Save(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		return nil
+	},
+}
+
+var deviceLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the devices in the devices file",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		devices, err := loadRegistry(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		fmt.Printf("Found %d devices in the devices file\n", len(devices.Devices))
+		for i, d := range devices.Devices {
+			fmt.Printf("%d) %s", i+1, formatCastEntry(d.Entry()))
+			if len(d.MemberOf) > 0 {
+				fmt.Printf(" member_of=%q", d.MemberOf)
+			}
+			fmt.Println()
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deviceCmd)
+	deviceCmd.AddCommand(deviceAddCmd)
+	deviceCmd.AddCommand(deviceRmCmd)
+	deviceCmd.AddCommand(deviceLsCmd)
+	deviceAddCmd.Flags().String("model", "", "device model, ie: 'Chromecast' or 'Google Home Mini'")
+	deviceAddCmd.Flags().Bool("group", false, "the device is a speaker group")
+	deviceAddCmd.Flags().StringSlice("member-of", nil, "names or uuids of the speaker groups the device is a member of")
+}
@@ -0,0 +1,120 @@
+// Copyright © 2018 Jonathan Pentecost <pentecostjonathan@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/grasparv/go-chromecast/application"
+	"github.com/grasparv/go-chromecast/playlist"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export [directory|playlist_file]",
+	Short: "Export the queue on the chromecast, or the media in a directory, to an M3U playlist",
+	Long: `Export the media queued on the chromecast to an M3U playlist. If a
+directory or playlist file is given, the media that the playlist command would
+play from it is exported instead, without connecting to a chromecast.
+
+Local media on the chromecast is exported as the file it was served from,
+which is only known if the go-chromecast that served it ran with the cache
+enabled.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return fmt.Errorf("requires at most one argument, should be the folder or playlist file to export")
+		}
+		output, _ := cmd.Flags().GetString("output")
+
+		var entries []playlist.Entry
+		if len(args) == 1 && playlist.IsPlaylistFile(args[0]) {
+			var err error
+			if entries, err = playlistFileEntries(args[0]); err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+		} else if len(args) == 1 {
+			// Listing a directory only needs the application to check which
+			// files are playable, so it is never connected to a chromecast.
+			iface, _ := cmd.Flags().GetString("iface")
+			debug, _ := cmd.Flags().GetBool("debug")
+			app := application.NewApplication(iface, debug, true)
+			filenames, err := directoryMediaFiles(cmd, app, args[0])
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+			for _, filename := range filenames {
+				entries = append(entries, playlist.Entry{Location: filename})
+			}
+		} else {
+			app, err := castApplication(cmd, args)
+			if err != nil {
+				fmt.Printf("unable to get cast application: %v\n", err)
+				return nil
+			}
+			items, err := app.QueueItems()
+			if err != nil {
+				fmt.Printf("unable to get queue: %v\n", err)
+				return nil
+			}
+			for _, item := range items {
+				// Local media is served by go-chromecast under a url that
+				// only works while it runs, so its file is exported instead.
+				location, err := app.ServedFilename(item.Media.ContentId)
+				if err != nil {
+					fmt.Printf("unable to export %q: %v\n", item.Media.ContentId, err)
+					return nil
+				}
+				title := item.Media.Metadata.Title
+				if title == "" {
+					title = path.Base(location)
+				}
+				entries = append(entries, playlist.Entry{
+					Location: location,
+					Title:    title,
+					Duration: time.Duration(item.Media.Duration * float32(time.Second)),
+				})
+			}
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				fmt.Printf("unable to create %q: %v\n", output, err)
+				return nil
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := playlist.WriteM3U(w, entries); err != nil {
+			fmt.Printf("unable to write playlist: %v\n", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringP("output", "o", "-", "file to write the M3U playlist to, '-' writes to stdout")
+	addCollectionFlags(exportCmd, true)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	castdns "github.com/grasparv/go-chromecast/dns"
+)
+
+// findCastGroup returns the speaker group selected by the device flags, with
+// its members resolved.
+func findCastGroup(cmd *cobra.Command) (castdns.Group, error) {
+	deviceName, _ := cmd.Flags().GetString("device-name")
+	deviceUuid, _ := cmd.Flags().GetString("uuid")
+	device, _ := cmd.Flags().GetString("device")
+
+	dnsEntries, err := discoverCastEntries(cmd)
+	if err != nil {
+		return castdns.Group{}, err
+	}
+	var groups []castdns.CastEntry
+	for _, d := range dnsEntries {
+		if d.IsGroup() {
+			groups = append(groups, d)
+		}
+	}
+	if len(groups) == 0 {
+		return castdns.Group{}, errors.New("no cast groups found")
+	}
+
+	selection := newDeviceSelection(cmd, device, deviceName, deviceUuid)
+	candidates := groups
+	if selection.filtered() {
+		if candidates = selection.match(groups); len(candidates) == 0 {
+			return castdns.Group{}, fmt.Errorf("no cast group matches, found %d cast groups:\n%s", len(groups), formatCastEntries(groups))
+		}
+	}
+	entry, err := selectCastEntry(candidates, selection)
+	if err != nil {
+		return castdns.Group{}, err
+	}
+
+	for _, g := range castdns.ResolveGroups(context.Background(), dnsEntries) {
+		if g.Entry.UUID == entry.UUID {
+			if len(g.Members) == 0 {
+				return g, fmt.Errorf("unable to find the members of cast group %q", entry.DeviceName)
+			}
+			return g, nil
+		}
+	}
+	return castdns.Group{}, fmt.Errorf("unable to find cast group %q", entry.DeviceName)
+}
@@ -0,0 +1,246 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/grasparv/go-chromecast/application"
+)
+
+// historyTimeFormat is how times are shown in the history.
+const historyTimeFormat = "2006-01-02 15:04:05"
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List the played media",
+	Long: `List the local media that has been played, with when it was started and
+finished, most recently started first. The history is what playlist uses to
+continue where it left off.
+
+--since and --until take a date, ie: '2020-01-31', a date and time, ie:
+'2020-01-31 18:00', or an age, ie: '12h' or '7d'.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, _ := cmd.Flags().GetString("dir")
+		since, _ := cmd.Flags().GetString("since")
+		until, _ := cmd.Flags().GetString("until")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+
+		filter := historyFilter{dir: dir}
+		var err error
+		if filter.since, err = parseHistoryTime(since); err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		if filter.until, err = parseHistoryTime(until); err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		store, err := openStore(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		playedItems, err := application.LoadPlayedItems(store)
+		if err != nil {
+			fmt.Printf("unable to load the history: %v\n", err)
+			return nil
+		}
+		b, err := formatHistory(filter.apply(playedItems), format)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		if err := writeOutput(output, b); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+		return nil
+	},
+}
+
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove media from the history that hasn't been played for a while",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		olderThan, _ := cmd.Flags().GetString("older-than")
+		age, err := parseAge(olderThan)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		store, err := openStore(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		removed, err := application.PrunePlayedItems(store, time.Now().Add(-age))
+		if err != nil {
+			fmt.Printf("unable to prune the history: %v\n", err)
+			return nil
+		}
+		fmt.Printf("removed %d items\n", removed)
+		return nil
+	},
+}
+
+// historyFilter selects the played items to list.
+type historyFilter struct {
+	// dir only includes media in the directory or its subdirectories.
+	dir string
+	// since and until only include media last played between them, they
+	// are ignored if zero.
+	since, until time.Time
+}
+
+// apply returns the played items matching the filter, most recently started
+// first.
+func (f historyFilter) apply(playedItems map[string]application.PlayedItem) []application.PlayedItem {
+	var items []application.PlayedItem
+	for _, p := range playedItems {
+		if f.dir != "" && !withinDir(p.ContentID, f.dir) {
+			continue
+		}
+		lastPlayed := p.LastPlayed()
+		if !f.since.IsZero() && lastPlayed.Before(f.since) {
+			continue
+		}
+		if !f.until.IsZero() && !lastPlayed.Before(f.until) {
+			continue
+		}
+		items = append(items, p)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Started != items[j].Started {
+			return items[i].Started > items[j].Started
+		}
+		return items[i].ContentID < items[j].ContentID
+	})
+	return items
+}
+
+// withinDir returns whether filename is in dir or its subdirectories. The
+// history has the filenames as they were given, so both the relative and
+// absolute paths are compared.
+func withinDir(filename, dir string) bool {
+	within := func(filename, dir string) bool {
+		rel, err := filepath.Rel(dir, filename)
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	if within(filepath.Clean(filename), filepath.Clean(dir)) {
+		return true
+	}
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	return err == nil && within(absFilename, absDir)
+}
+
+// formatHistory formats the played items as text, csv or json.
+func formatHistory(items []application.PlayedItem, format string) ([]byte, error) {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(historyTimeFormat)
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "text":
+		for _, p := range items {
+			finished := formatTime(p.FinishedAt())
+			if finished == "" {
+				finished = "-"
+			}
+			fmt.Fprintf(&buf, "%s  %-19s  %s\n", formatTime(p.StartedAt()), finished, p.ContentID)
+		}
+	case "csv":
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"content_id", "started", "finished"})
+		for _, p := range items {
+			w.Write([]string{p.ContentID, formatCSVTime(p.StartedAt()), formatCSVTime(p.FinishedAt())})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, errors.Wrap(err, "unable to write csv")
+		}
+	case "json":
+		if items == nil {
+			items = []application.PlayedItem{}
+		}
+		b, err := json.MarshalIndent(items, "", "  ")
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to marshal the history")
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	default:
+		return nil, errors.Errorf("unknown format %q, use text, csv or json", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// formatCSVTime formats t for spreadsheets, which parse RFC 3339 times.
+func formatCSVTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// parseHistoryTime parses a date, a date and time, or an age which is taken
+// from now. An empty string is the zero time.
+func parseHistoryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", historyTimeFormat, time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%q is not a date, ie: '2020-01-31', or an age, ie: '7d'", s)
+	}
+	return time.Now().Add(-age), nil
+}
+
+// parseAge parses a duration, which can also be in days, ie: '30d'.
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.Errorf("invalid age %q, use a number of days, ie: '30d', or a duration, ie: '12h'", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.Errorf("invalid age %q, use a number of days, ie: '30d', or a duration, ie: '12h'", s)
+	}
+	return d, nil
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyPruneCmd)
+	historyCmd.Flags().String("dir", "", "only list media in this directory or its subdirectories")
+	historyCmd.Flags().String("since", "", "only list media played since this date or age")
+	historyCmd.Flags().String("until", "", "only list media played before this date or age")
+	historyCmd.Flags().String("format", "text", "format to list the media in: text, csv or json")
+	historyCmd.Flags().StringP("output", "o", "-", "file to write the history to, '-' writes to stdout")
+	historyPruneCmd.Flags().String("older-than", "90d", "remove media last played longer ago than this, ie: '30d' or '12h'")
+}
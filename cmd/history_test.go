@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grasparv/go-chromecast/application"
+)
+
+func TestHistoryFilter(t *testing.T) {
+	now := time.Now()
+	playedItems := map[string]application.PlayedItem{}
+	for _, p := range []application.PlayedItem{
+		{ContentID: "/media/music/a.mp3", Started: now.Add(-time.Hour).Unix(), Finished: now.Unix()},
+		{ContentID: "/media/music/b.mp3", Started: now.Add(-48 * time.Hour).Unix()},
+		{ContentID: "/media/musical.mp3", Started: now.Add(-2 * time.Hour).Unix()},
+		{ContentID: "/media/video/c.mkv", Started: now.Add(-30 * time.Minute).Unix()},
+	} {
+		playedItems[p.ContentID] = p
+	}
+
+	tests := []struct {
+		name   string
+		filter historyFilter
+		want   []string
+	}{
+		{"all, most recently started first", historyFilter{}, []string{"/media/video/c.mkv", "/media/music/a.mp3", "/media/musical.mp3", "/media/music/b.mp3"}},
+		{"directory", historyFilter{dir: "/media/music/"}, []string{"/media/music/a.mp3", "/media/music/b.mp3"}},
+		{"since", historyFilter{since: now.Add(-24 * time.Hour)}, []string{"/media/video/c.mkv", "/media/music/a.mp3", "/media/musical.mp3"}},
+		{"until", historyFilter{until: now.Add(-time.Hour)}, []string{"/media/musical.mp3", "/media/music/b.mp3"}},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, p := range test.filter.apply(playedItems) {
+			got = append(got, p.ContentID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30d", 30 * 24 * time.Hour, false},
+		{"12h", 12 * time.Hour, false},
+		{"-1d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parseAge(test.age)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("%q: expected %v (error %v), got %v (%v)", test.age, test.want, test.wantErr, got, err)
+		}
+	}
+}
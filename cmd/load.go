@@ -17,6 +17,8 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/grasparv/go-chromecast/application"
+	"github.com/grasparv/go-chromecast/playlist"
 	"github.com/grasparv/go-chromecast/ui"
 
 	"github.com/sirupsen/logrus"
@@ -33,12 +35,39 @@ chromecast if it is a local file, otherwise it will load the url.
 
 If the media file is an unplayable media type by the chromecast, this
 will attempt to transcode the media file to mp4 using ffmpeg. This requires
-that ffmpeg is installed.`,
+that ffmpeg is installed.
+
+Urls can be proxied through the local streaming server with --proxy, this
+allows playing media the chromecast can't reach or that requires extra
+request headers, ie: --header 'Authorization: Bearer <token>'.
+
+Passing '-' as the filename will stream whatever is piped into go-chromecast,
+and --ffmpeg-input will play any input that ffmpeg can read, ie:
+'rtsp://camera/stream' or 'lavfi:testsrc'. Both are transcoded with ffmpeg.
+
+Loading an M3U, M3U8, PLS or XSPF playlist file queues all of its media.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if len(args) != 1 {
+		ffmpegInput, _ := cmd.Flags().GetString("ffmpeg-input")
+		if ffmpegInput != "" && len(args) != 0 {
+			return fmt.Errorf("no arguments are expected when using --ffmpeg-input")
+		} else if ffmpegInput == "" && len(args) != 1 {
 			return fmt.Errorf("requires exactly one argument, should be the media file to load")
 		}
-		app, err := castApplication(cmd, args)
+
+		var opts []application.ApplicationOption
+		proxy, _ := cmd.Flags().GetBool("proxy")
+		if proxy {
+			headerValues, _ := cmd.Flags().GetStringArray("header")
+			insecure, _ := cmd.Flags().GetBool("insecure")
+			headers, err := application.ParseHeaders(headerValues)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+			opts = append(opts, application.WithRemoteProxy(headers, insecure))
+		}
+
+		app, err := castApplication(cmd, args, opts...)
 		if err != nil {
 			fmt.Printf("unable to get cast application: %v\n", err)
 			return nil
@@ -47,12 +76,25 @@ that ffmpeg is installed.`,
 		contentType, _ := cmd.Flags().GetString("content-type")
 		transcode, _ := cmd.Flags().GetBool("transcode")
 		detach, _ := cmd.Flags().GetBool("detach")
+		load := func() error {
+			if ffmpegInput != "" {
+				return app.LoadFFmpegInput(ffmpegInput)
+			}
+			if playlist.IsPlaylistFile(args[0]) {
+				filenames, err := playlistFileMediaFiles(args[0])
+				if err != nil {
+					return err
+				}
+				return app.QueueLoad(filenames, contentType, transcode, application.DefaultPlaybackDuration)
+			}
+			return app.Load(args[0], contentType, transcode, detach)
+		}
 
 		// Optionally run a UI when playing this media:
 		runWithUI, _ := cmd.Flags().GetBool("with-ui")
 		if runWithUI {
 			go func() {
-				if err := app.Load(args[0], contentType, transcode, detach); err != nil {
+				if err := load(); err != nil {
 					logrus.WithError(err).Fatal("unable to load media")
 				}
 			}()
@@ -65,7 +107,7 @@ that ffmpeg is installed.`,
 		}
 
 		// Otherwise just run in CLI mode:
-		if err := app.Load(args[0], contentType, transcode, detach); err != nil {
+		if err := load(); err != nil {
 			fmt.Printf("unable to load media: %v\n", err)
 			return nil
 		}
@@ -78,4 +120,8 @@ func init() {
 	loadCmd.Flags().Bool("transcode", true, "transcode the media to mp4 if media type is unrecognised")
 	loadCmd.Flags().Bool("detach", false, "detach from waiting until media finished. Only works with url loaded external media")
 	loadCmd.Flags().StringP("content-type", "c", "", "content-type to serve the media file as")
+	loadCmd.Flags().Bool("proxy", false, "proxy urls through the local streaming server instead of loading them directly on the chromecast")
+	loadCmd.Flags().StringArray("header", nil, "extra header to send when proxying a url, ie: 'Authorization: Bearer xyz'. Can be repeated")
+	loadCmd.Flags().Bool("insecure", false, "don't verify the tls certificate of proxied urls")
+	loadCmd.Flags().String("ffmpeg-input", "", "play any input ffmpeg can read instead of a file, ie: 'rtsp://camera/stream' or 'lavfi:testsrc'")
 }
@@ -15,7 +15,12 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	castdns "github.com/grasparv/go-chromecast/dns"
@@ -25,16 +30,79 @@ import (
 var lsCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "List devices",
+	Long: `List the cast devices found on the network.
+
+With --watch the network is browsed until interrupted, and a line is
+printed whenever a device is added, updated or removed. A device is
+updated when its address or TXT fields change, ie: when the 'rs' status
+changes because something starts casting to it.
+
+With --groups the speaker groups are listed along with their members, which
+are asked from the local setup api of each device.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		dnsEntries := castdns.FindCastDNSEntries()
+		if watch, _ := cmd.Flags().GetBool("watch"); watch {
+			ifaceName, _ := cmd.Flags().GetString("iface")
+			iface, err := networkInterface(ifaceName)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+			return watchDevices(iface)
+		}
+		dnsEntries, err := discoverCastEntries(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		if groups, _ := cmd.Flags().GetBool("groups"); groups {
+			listGroups(dnsEntries)
+			return nil
+		}
 		fmt.Printf("Found %d cast devices\n", len(dnsEntries))
 		for i, d := range dnsEntries {
-			fmt.Printf("%d) device=%q device_name=%q address=\"%s:%d\" status=%q uuid=%q\n", i+1, d.Device, d.DeviceName, d.AddrV4, d.Port, d.Status, d.UUID)
+			fmt.Printf("%d) %s\n", i+1, formatCastEntry(d))
 		}
 		return nil
 	},
 }
 
+// listGroups prints the speaker groups in entries, with their members
+// indented below them.
+func listGroups(entries []castdns.CastEntry) {
+	groups := castdns.ResolveGroups(context.Background(), entries)
+	fmt.Printf("Found %d cast groups\n", len(groups))
+	for i, g := range groups {
+		fmt.Printf("%d) %s\n", i+1, formatCastEntry(g.Entry))
+		for _, m := range g.Members {
+			fmt.Printf("   - %s\n", formatCastEntry(m))
+		}
+	}
+}
+
+// watchDevices prints the devices as they change until interrupted.
+func watchDevices(iface *net.Interface) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	events, err := castdns.NewBrowser(iface, 0).Browse(ctx)
+	if err != nil {
+		fmt.Printf("unable to browse for cast devices: %v\n", err)
+		return nil
+	}
+	for e := range events {
+		fmt.Printf("%s %s\n", e.Type, formatCastEntry(e.Entry))
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(lsCmd)
+	lsCmd.Flags().BoolP("watch", "w", false, "keep browsing and print devices as they are added, updated or removed")
+	lsCmd.Flags().Bool("groups", false, "list the speaker groups and their members")
 }
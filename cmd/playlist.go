@@ -17,27 +17,22 @@ package cmd
 import (
 	"bufio"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/grasparv/go-chromecast/application"
+	"github.com/grasparv/go-chromecast/collection"
+	"github.com/grasparv/go-chromecast/playlist"
 	"github.com/grasparv/go-chromecast/ui"
 )
 
-type mediaFile struct {
-	filename        string
-	possibleNumbers []int
-}
-
 // playlistCmd represents the playlist command
 var playlistCmd = &cobra.Command{
-	Use:   "playlist <directory>",
+	Use:   "playlist <directory|playlist_file>",
 	Short: "Load and play media on the chromecast",
 	Long: `Load and play media files on the chromecast, this will
 start a streaming server locally and serve the media file to the
@@ -45,16 +40,23 @@ chromecast.
 
 If the media file is an unplayable media type by the chromecast, this
 will attempt to transcode the media file to mp4 using ffmpeg. This requires
-that ffmpeg is installed.`,
+that ffmpeg is installed.
+
+Media in subdirectories is included with --recursive, and can be filtered
+with --include, --exclude and --type. By default media is played in natural
+order, see --sort for other orders.
+
+Instead of a directory an M3U, M3U8, PLS or XSPF playlist file can be played,
+it can contain both local files and urls.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
-			return fmt.Errorf("requires exactly one argument, should be the folder to play media from")
+			return fmt.Errorf("requires exactly one argument, should be the folder or playlist file to play media from")
 		}
 		if fileInfo, err := os.Stat(args[0]); err != nil {
 			fmt.Printf("unable to find %q: %v\n", args[0], err)
 			return nil
-		} else if !fileInfo.Mode().IsDir() {
-			fmt.Printf("%q is not a directory\n", args[0])
+		} else if !fileInfo.Mode().IsDir() && !playlist.IsPlaylistFile(args[0]) {
+			fmt.Printf("%q is not a directory or playlist file\n", args[0])
 			return nil
 		}
 		app, err := castApplication(cmd, args)
@@ -65,82 +67,13 @@ that ffmpeg is installed.`,
 
 		contentType, _ := cmd.Flags().GetString("content-type")
 		transcode, _ := cmd.Flags().GetBool("transcode")
-		forcePlay, _ := cmd.Flags().GetBool("force-play")
 		continuePlaying, _ := cmd.Flags().GetBool("continue")
 		selection, _ := cmd.Flags().GetBool("select")
-		files, err := ioutil.ReadDir(args[0])
+		filenames, err := playlistMediaFiles(cmd, app, args[0])
 		if err != nil {
-			fmt.Printf("unable to list files from %q: %v", args[0], err)
+			fmt.Printf("%v\n", err)
 			return nil
 		}
-		filesToPlay := make([]mediaFile, 0, len(files))
-		for _, f := range files {
-			if !forcePlay && !app.PlayableMediaType(f.Name()) {
-				continue
-			}
-
-			foundNum := false
-			numPos := 0
-			foundNumbers := []int{}
-			for i, c := range f.Name() {
-				if c < '0' || c > '9' {
-					if foundNum {
-						val, _ := strconv.Atoi(f.Name()[numPos:i])
-						foundNumbers = append(foundNumbers, val)
-					}
-					foundNum = false
-					continue
-				}
-
-				if !foundNum {
-					numPos = i
-					foundNum = true
-				}
-			}
-
-			filesToPlay = append(filesToPlay, mediaFile{
-				filename:        f.Name(),
-				possibleNumbers: foundNumbers,
-			})
-
-		}
-
-		sort.Slice(filesToPlay, func(i, j int) bool {
-			iNum := filesToPlay[i].possibleNumbers
-			jNum := filesToPlay[j].possibleNumbers
-			if len(iNum) == 0 {
-				return false
-			}
-			if len(jNum) == 0 {
-				return true
-			}
-			max := len(iNum)
-			if len(iNum) < len(jNum) {
-				max = len(jNum)
-			}
-			for vi := 0; vi < max; vi++ {
-				if len(iNum) < vi {
-					return false
-				}
-				if len(jNum) < vi {
-					return true
-				}
-				if iNum[vi] == jNum[vi] {
-					continue
-				}
-				if iNum[vi] > jNum[vi] {
-					return false
-				}
-				return true
-			}
-			return true
-		})
-
-		filenames := make([]string, len(filesToPlay))
-		for i, f := range filesToPlay {
-			filename := filepath.Join(args[0], f.filename)
-			filenames[i] = filename
-		}
 
 		indexToPlayFrom := 0
 		if selection {
@@ -204,7 +137,7 @@ that ffmpeg is installed.`,
 		runWithUI, _ := cmd.Flags().GetBool("with-ui")
 		if runWithUI {
 			go func() {
-				if err := app.QueueLoad(filenames[indexToPlayFrom:], contentType, transcode); err != nil {
+				if err := app.QueueLoad(filenames[indexToPlayFrom:], contentType, transcode, application.DefaultPlaybackDuration); err != nil {
 					logrus.WithError(err).Fatal("unable to play playlist on cast application")
 				}
 			}()
@@ -216,7 +149,7 @@ that ffmpeg is installed.`,
 			return ccui.Run()
 		}
 
-		if err := app.QueueLoad(filenames[indexToPlayFrom:], contentType, transcode); err != nil {
+		if err := app.QueueLoad(filenames[indexToPlayFrom:], contentType, transcode, application.DefaultPlaybackDuration); err != nil {
 			fmt.Printf("unable to play playlist on cast application: %v\n", err)
 			return nil
 		}
@@ -229,6 +162,110 @@ func init() {
 	playlistCmd.Flags().Bool("continue", true, "continue playing from the last known media")
 	playlistCmd.Flags().Bool("select", false, "choose which media to start the playlist from")
 	playlistCmd.Flags().Bool("transcode", true, "transcode the media to mp4 if media type is unrecognised")
-	playlistCmd.Flags().Bool("force-play", false, "attempt to play a media type even if it is unrecognised")
 	playlistCmd.Flags().StringP("content-type", "c", "", "content-type to serve the media file as")
+	addCollectionFlags(playlistCmd, true)
+}
+
+// playlistMediaFiles returns the media to play from either a directory or
+// a playlist file.
+func playlistMediaFiles(cmd *cobra.Command, app *application.Application, path string) ([]string, error) {
+	if playlist.IsPlaylistFile(path) {
+		return playlistFileMediaFiles(path)
+	}
+	return directoryMediaFiles(cmd, app, path)
+}
+
+// playlistFileMediaFiles returns the media in a playlist file.
+func playlistFileMediaFiles(path string) ([]string, error) {
+	entries, err := playlistFileEntries(path)
+	if err != nil {
+		return nil, err
+	}
+	return playlist.Locations(entries), nil
+}
+
+// playlistFileEntries returns the entries in a playlist file, local files
+// that no longer exist are skipped.
+func playlistFileEntries(path string) ([]playlist.Entry, error) {
+	entries, err := playlist.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	existing := make([]playlist.Entry, 0, len(entries))
+	for _, e := range entries {
+		if !strings.Contains(e.Location, "://") {
+			if _, err := os.Stat(e.Location); err != nil {
+				fmt.Fprintf(os.Stderr, "skipping %q: %v\n", e.Location, err)
+				continue
+			}
+		}
+		existing = append(existing, e)
+	}
+	return existing, nil
+}
+
+// directoryMediaFiles returns the playable media in a directory, filtered
+// and sorted by the media collection flags.
+func directoryMediaFiles(cmd *cobra.Command, app *application.Application, dir string) ([]string, error) {
+	opts, err := collectionOptions(cmd, app)
+	if err != nil {
+		return nil, err
+	}
+	items, err := collection.Collect(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return collection.Filenames(items), nil
+}
+
+// addCollectionFlags adds the flags used to choose which media in a
+// directory is played, and in what order.
+func addCollectionFlags(cmd *cobra.Command, sortable bool) {
+	cmd.Flags().Bool("force-play", false, "attempt to play a media type even if it is unrecognised")
+	cmd.Flags().BoolP("recursive", "r", false, "include media in subdirectories")
+	cmd.Flags().StringArray("include", nil, "only include files matching the glob, ie: '*.mp3'. Can be repeated")
+	cmd.Flags().StringArray("exclude", nil, "exclude files and directories matching the glob, ie: 'Extras'. Can be repeated")
+	cmd.Flags().StringSlice("type", nil, "only include media of this type: audio, video or image. Can be repeated")
+	if sortable {
+		cmd.Flags().String("sort", string(collection.SortNatural), "order to play media in: natural, mtime, size, tag (disc and track number) or random")
+	}
+	cmd.Flags().Int64("seed", 0, "seed for the random order, the same seed always gives the same order")
+}
+
+// collectionOptions returns the media collection options from the flags
+// added by addCollectionFlags.
+func collectionOptions(cmd *cobra.Command, app *application.Application) (collection.Options, error) {
+	forcePlay, _ := cmd.Flags().GetBool("force-play")
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	include, _ := cmd.Flags().GetStringArray("include")
+	exclude, _ := cmd.Flags().GetStringArray("exclude")
+	typeNames, _ := cmd.Flags().GetStringSlice("type")
+	seed, _ := cmd.Flags().GetInt64("seed")
+
+	opts := collection.Options{
+		Recursive: recursive,
+		Include:   include,
+		Exclude:   exclude,
+		Sort:      collection.SortNatural,
+		Seed:      seed,
+	}
+	if sortName, err := cmd.Flags().GetString("sort"); err == nil {
+		if opts.Sort, err = collection.ParseSortMode(sortName); err != nil {
+			return opts, err
+		}
+	}
+	for _, name := range typeNames {
+		t, err := collection.ParseMediaType(name)
+		if err != nil {
+			return opts, err
+		}
+		opts.Types = append(opts.Types, t)
+	}
+	if !forcePlay {
+		// Playlist files start like HLS playlists, but aren't media.
+		opts.Playable = func(filename string) bool {
+			return !playlist.IsPlaylistFile(filename) && app.PlayableMediaType(filename)
+		}
+	}
+	return opts, nil
 }
@@ -16,9 +16,13 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/grasparv/go-chromecast/registry"
+	"github.com/grasparv/go-chromecast/storage"
 )
 
 var (
@@ -67,11 +71,25 @@ func init() {
 	rootCmd.PersistentFlags().Bool("version", false, "display command version")
 	rootCmd.PersistentFlags().BoolP("debug", "v", false, "debug logging")
 	rootCmd.PersistentFlags().Bool("disable-cache", false, "disable the cache")
+	rootCmd.PersistentFlags().String("store", storage.BackendFile, fmt.Sprintf("where the cache and played media are kept, one of %s", strings.Join(storage.Backends, ", ")))
+	rootCmd.PersistentFlags().String("store-path", "", "file to keep the cache and played media in, the default depends on --store")
+	rootCmd.PersistentFlags().Duration("dns-cache-ttl", 24*time.Hour, "how long found devices are cached for, 0 caches them until they can't be connected to")
 	rootCmd.PersistentFlags().Bool("with-ui", false, "run with a UI")
 	rootCmd.PersistentFlags().StringP("device", "d", "", "chromecast device, ie: 'Chromecast' or 'Google Home Mini'")
 	rootCmd.PersistentFlags().StringP("device-name", "n", "", "chromecast device name")
 	rootCmd.PersistentFlags().StringP("uuid", "u", "", "chromecast device uuid")
+	rootCmd.PersistentFlags().Bool("first", false, "use the first device found when several match, rather than prompting")
+	rootCmd.PersistentFlags().Int("select", 0, "use the device at this position in the list of devices found when several match, rather than prompting")
 	rootCmd.PersistentFlags().StringP("addr", "a", "", "Address of the chromecast device")
 	rootCmd.PersistentFlags().StringP("port", "p", "8009", "Port of the chromecast device if 'addr' is specified")
-	rootCmd.PersistentFlags().StringP("iface", "i", "", "Network interface to use when looking for a local address to use for the http server")
+	rootCmd.PersistentFlags().String("devices-file", registry.DefaultFilename(), "file of devices to use without discovering them, see 'device add'")
+	rootCmd.PersistentFlags().String("dns-server", "", "DNS server to also look for devices on with unicast DNS-SD, ie: '10.0.0.1:53'")
+	rootCmd.PersistentFlags().String("dns-domain", "local.", "domain to look for devices in with unicast DNS-SD, see --dns-server")
+	rootCmd.PersistentFlags().StringP("iface", "i", "", "Network interface to discover devices on, and to take the local address of the http server from")
+	rootCmd.PersistentFlags().String("transcode-mode", "mp4", "how to transcode unplayable media; 'mp4' streams a single file, 'hls' creates segments on demand and allows seeking")
+	rootCmd.PersistentFlags().String("transcode-cache-dir", "", "directory to cache transcoded media in, disabled if empty")
+	rootCmd.PersistentFlags().Int64("transcode-cache-size", 10240, "maximum size in MB of the transcode cache, the least recently used media is removed first")
+	rootCmd.PersistentFlags().Int("pretranscode", 1, "number of upcoming queue items to transcode into the cache in the background")
+	rootCmd.PersistentFlags().Int("max-transcodes", 2, "maximum number of ffmpeg processes running at the same time")
+	rootCmd.PersistentFlags().Bool("pin-media-client", false, "only serve local media to requests coming from the chromecast device")
 }
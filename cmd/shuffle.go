@@ -16,14 +16,14 @@ package cmd
 
 import (
 	"fmt"
-	"io/ioutil"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
-	"time"
 
+	"github.com/grasparv/go-chromecast/application"
+	"github.com/grasparv/go-chromecast/collection"
 	"github.com/grasparv/go-chromecast/picksongs"
+	"github.com/grasparv/go-chromecast/playlist"
 	"github.com/grasparv/go-chromecast/ui"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -31,7 +31,7 @@ import (
 
 // shuffleCmd represents the playlist command
 var shuffleCmd = &cobra.Command{
-	Use:   "shuffle <directory>",
+	Use:   "shuffle <directory|playlist_file>",
 	Short: "Load and play media on the chromecast in random order",
 	Long: `Load and play media files on the chromecast order. This will start a
 	streaming server locally and serve the media file to the chromecast.
@@ -41,13 +41,13 @@ will attempt to transcode the media file to mp4 using ffmpeg. This requires
 that ffmpeg is installed.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
-			return fmt.Errorf("requires exactly one argument, should be the folder to play media from")
+			return fmt.Errorf("requires exactly one argument, should be the folder or playlist file to play media from")
 		}
 		if fileInfo, err := os.Stat(args[0]); err != nil {
 			fmt.Printf("unable to find %q: %v\n", args[0], err)
 			return nil
-		} else if !fileInfo.Mode().IsDir() {
-			fmt.Printf("%q is not a directory\n", args[0])
+		} else if !fileInfo.Mode().IsDir() && !playlist.IsPlaylistFile(args[0]) {
+			fmt.Printf("%q is not a directory or playlist file\n", args[0])
 			return nil
 		}
 		app, err := castApplication(cmd, args)
@@ -58,28 +58,40 @@ that ffmpeg is installed.`,
 
 		contentType, _ := cmd.Flags().GetString("content-type")
 		transcode, _ := cmd.Flags().GetBool("transcode")
-		forcePlay, _ := cmd.Flags().GetBool("force-play")
+		var filesToPlay []string
 		directory := args[0]
-		files, err := ioutil.ReadDir(directory)
-		if err != nil {
-			fmt.Printf("unable to list files from %q: %v", directory, err)
-			return nil
-		}
-		filesToPlay := make([]string, 0, len(files))
-		for _, f := range files {
-			if !forcePlay && !app.PlayableMediaType(f.Name()) {
-				continue
+		if playlist.IsPlaylistFile(args[0]) {
+			// Playlist files contain full paths and urls, so there is
+			// no directory to join them with.
+			directory = ""
+			if filesToPlay, err = playlistFileMediaFiles(args[0]); err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+		} else {
+			opts, err := collectionOptions(cmd, app)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+			items, err := collection.Collect(directory, opts)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+			// Names are relative to the directory, which keeps them short
+			// in the song picker.
+			filesToPlay = make([]string, len(items))
+			for i, item := range items {
+				filesToPlay[i] = item.Name
 			}
-
-			filesToPlay = append(filesToPlay, f.Name())
 		}
 
-		rand.Seed(time.Now().UnixNano())
-
-		sort.Strings(filesToPlay)
+		sort.Slice(filesToPlay, func(i, j int) bool { return collection.NaturalLess(filesToPlay[i], filesToPlay[j]) })
 		queue, remaining := pick.Picksongs(filesToPlay)
 
-		rand.Shuffle(len(remaining), func(i, j int) {
+		seed, _ := cmd.Flags().GetInt64("seed")
+		collection.Shuffle(len(remaining), seed, func(i, j int) {
 			remaining[i], remaining[j] = remaining[j], remaining[i]
 		})
 
@@ -97,7 +109,10 @@ that ffmpeg is installed.`,
 
 		filenames := make([]string, len(filesToPlay))
 		for i, f := range filesToPlay {
-			filename := filepath.Join(directory, f)
+			filename := f
+			if directory != "" {
+				filename = filepath.Join(directory, f)
+			}
 			filenames[i] = filename
 		}
 
@@ -105,7 +120,7 @@ that ffmpeg is installed.`,
 		runWithUI, _ := cmd.Flags().GetBool("with-ui")
 		if runWithUI {
 			go func() {
-				if err := app.QueueLoad(filenames, contentType, transcode); err != nil {
+				if err := app.QueueLoad(filenames, contentType, transcode, application.DefaultPlaybackDuration); err != nil {
 					logrus.WithError(err).Fatal("unable to play playlist on cast application")
 				}
 			}()
@@ -117,7 +132,7 @@ that ffmpeg is installed.`,
 			return ccui.Run()
 		}
 
-		if err := app.QueueLoad(filenames, contentType, transcode); err != nil {
+		if err := app.QueueLoad(filenames, contentType, transcode, application.DefaultPlaybackDuration); err != nil {
 			fmt.Printf("unable to play playlist on cast application: %v\n", err)
 			return nil
 		}
@@ -128,6 +143,6 @@ that ffmpeg is installed.`,
 func init() {
 	rootCmd.AddCommand(shuffleCmd)
 	shuffleCmd.Flags().Bool("transcode", true, "transcode the media to mp4 if media type is unrecognised")
-	shuffleCmd.Flags().Bool("force-play", false, "attempt to play a media type even if it is unrecognised")
 	shuffleCmd.Flags().StringP("content-type", "c", "", "content-type to serve the media file as")
+	addCollectionFlags(shuffleCmd, false)
 }
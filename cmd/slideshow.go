@@ -17,36 +17,113 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+
+	"github.com/grasparv/go-chromecast/application"
+	"github.com/grasparv/go-chromecast/collection"
+	"github.com/grasparv/go-chromecast/playlist"
 )
 
 // slideshowCmd represents the slideshow command
 var slideshowCmd = &cobra.Command{
-	Use:   "slideshow file1 file2 ...",
+	Use:   "slideshow <file_or_directory> ...",
 	Short: "Play a slideshow of photos",
+	Long: `Play a slideshow of photos, and optionally videos, on the chromecast.
+
+Images are shown for --duration seconds and videos are played until they
+end. Directories are expanded into the images and videos they contain,
+see --recursive, --include, --exclude, --type and --sort. --shuffle plays
+everything in a random order.
+
+Unless --process-images=false is given, images are scaled down to the
+resolution of the device, turned the right way up using their EXIF
+orientation, and HEIC and TIFF images are converted to JPEG. Converting
+HEIC and TIFF images requires that ffmpeg is installed.
+
+Background music can be played on a second device with --music, which can
+be a directory, playlist file or audio file, and --music-device-name, ie: a
+speaker next to the TV. Playing the music in a second session on the same
+device isn't supported: a device only plays one media session at a time, so
+starting the music would stop the slideshow.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
-			return fmt.Errorf("requires files to play in slideshow")
+			return fmt.Errorf("requires files or directories to play in slideshow")
 		}
 		for _, arg := range args {
-			if fileInfo, err := os.Stat(arg); err != nil {
+			if _, err := os.Stat(arg); err != nil {
 				fmt.Printf("unable to find %q: %v\n", arg, err)
 				return nil
-			} else if fileInfo.Mode().IsDir() {
-				fmt.Printf("%q is a directory\n", arg)
-				return nil
 			}
 		}
-		app, err := castApplication(cmd, args)
+		music, _ := cmd.Flags().GetString("music")
+		musicDeviceName, _ := cmd.Flags().GetString("music-device-name")
+		if music != "" && musicDeviceName == "" {
+			return fmt.Errorf("--music-device-name is required when playing background music")
+		}
+		if deviceName, _ := cmd.Flags().GetString("device-name"); music != "" && musicDeviceName == deviceName {
+			return fmt.Errorf("--music-device-name has to be a different device than the slideshow, a device only plays one media session at a time")
+		}
+
+		var opts []application.ApplicationOption
+		processImages, _ := cmd.Flags().GetBool("process-images")
+		if processImages {
+			maxWidth, _ := cmd.Flags().GetInt("max-width")
+			maxHeight, _ := cmd.Flags().GetInt("max-height")
+			imageCacheDir, _ := cmd.Flags().GetString("image-cache-dir")
+			opts = append(opts, application.WithImageProcessing(maxWidth, maxHeight, imageCacheDir))
+		}
+		app, err := castApplication(cmd, args, opts...)
 		if err != nil {
 			fmt.Printf("unable to get cast application: %v\n", err)
 			return nil
 		}
 
+		filenames, err := slideshowMediaFiles(cmd, app, args)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return nil
+		}
+		if len(filenames) == 0 {
+			fmt.Printf("no images or videos found to play\n")
+			return nil
+		}
+
+		if music != "" {
+			musicApp, err := connectCastApplication(cmd, "", musicDeviceName, "", "", "")
+			if err != nil {
+				fmt.Printf("unable to get cast application for background music: %v\n", err)
+				return nil
+			}
+			defer musicApp.Close()
+			musicFiles, err := musicMediaFiles(musicApp, music)
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return nil
+			}
+			go func() {
+				if err := musicApp.QueueLoad(musicFiles, "", true, 0); err != nil {
+					fmt.Printf("unable to play background music: %v\n", err)
+				}
+			}()
+			// Stop the music once the slideshow is over. The media session
+			// was started after connecting, so it has to be looked up first.
+			defer func() {
+				if err := musicApp.Update(); err != nil {
+					fmt.Printf("unable to stop background music: %v\n", err)
+					return
+				}
+				// Nothing to stop if the music has already finished.
+				if err := musicApp.StopMedia(); err != nil && err != application.ErrNoMediaStop {
+					fmt.Printf("unable to stop background music: %v\n", err)
+				}
+			}()
+		}
+
 		duration, _ := cmd.Flags().GetInt("duration")
 		repeat, _ := cmd.Flags().GetBool("repeat")
-		if err := app.Slideshow(args, duration, repeat); err != nil {
+		if err := app.Slideshow(filenames, duration, repeat); err != nil {
 			fmt.Printf("unable to play slideshow on cast application: %v\n", err)
 			return nil
 		}
@@ -54,8 +131,85 @@ var slideshowCmd = &cobra.Command{
 	},
 }
 
+// slideshowMediaFiles expands directories in args into the images and
+// videos they contain, and shuffles everything if asked to.
+func slideshowMediaFiles(cmd *cobra.Command, app *application.Application, args []string) ([]string, error) {
+	opts, err := collectionOptions(cmd, app)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Types) == 0 {
+		opts.Types = []collection.MediaType{collection.Image, collection.Video}
+	}
+
+	var filenames []string
+	for _, arg := range args {
+		if fileInfo, err := os.Stat(arg); err != nil {
+			return nil, fmt.Errorf("unable to find %q: %v", arg, err)
+		} else if !fileInfo.IsDir() {
+			filenames = append(filenames, arg)
+			continue
+		}
+		items, err := collection.Collect(arg, opts)
+		if err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, collection.Filenames(items)...)
+	}
+
+	if shuffle, _ := cmd.Flags().GetBool("shuffle"); shuffle {
+		collection.Shuffle(len(filenames), opts.Seed, func(i, j int) {
+			filenames[i], filenames[j] = filenames[j], filenames[i]
+		})
+	}
+	return filenames, nil
+}
+
+// musicMediaFiles returns the audio to play from a directory, including
+// its subdirectories, a playlist file or a single audio file.
+func musicMediaFiles(app *application.Application, path string) ([]string, error) {
+	if playlist.IsPlaylistFile(path) {
+		return playlistFileMediaFiles(path)
+	}
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find %q: %v", path, err)
+	}
+	if !fileInfo.IsDir() {
+		return []string{path}, nil
+	}
+	items, err := collection.Collect(path, collection.Options{
+		Recursive: true,
+		Types:     []collection.MediaType{collection.Audio},
+		Sort:      collection.SortNatural,
+		Playable:  app.PlayableMediaType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return collection.Filenames(items), nil
+}
+
 func init() {
 	rootCmd.AddCommand(slideshowCmd)
-	slideshowCmd.Flags().Int("duration", 10, "duration of each image on screen")
+	slideshowCmd.Flags().Int("duration", 10, "duration of each image on screen, videos are played until they end")
 	slideshowCmd.Flags().Bool("repeat", true, "should the slideshow repeat")
+	slideshowCmd.Flags().Bool("process-images", true, "resize and rotate images for the device, and convert HEIC and TIFF images to JPEG")
+	slideshowCmd.Flags().Int("max-width", 0, "maximum width to resize images to, defaults to the resolution of the device")
+	slideshowCmd.Flags().Int("max-height", 0, "maximum height to resize images to, defaults to the resolution of the device")
+	slideshowCmd.Flags().String("image-cache-dir", defaultImageCacheDir(), "directory to cache processed images in, an empty value disables the cache")
+	slideshowCmd.Flags().Bool("shuffle", false, "play the images and videos in a random order, see --seed")
+	slideshowCmd.Flags().String("music", "", "directory, playlist file or audio file to play as background music")
+	slideshowCmd.Flags().String("music-device-name", "", "name of the device to play the background music on")
+	addCollectionFlags(slideshowCmd, true)
+}
+
+// defaultImageCacheDir returns the directory processed images are cached
+// in, or an empty string if there is no user cache directory.
+func defaultImageCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-chromecast", "images")
 }
@@ -15,78 +15,323 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+
+	"github.com/grasparv/go-chromecast/application"
+	"github.com/grasparv/go-chromecast/storage"
 	"github.com/grasparv/go-chromecast/tts"
 )
 
+// ttsTimeout is how long the engine has to synthesize the speech.
+const ttsTimeout = 30 * time.Second
+
 // ttsCmd represents the tts command
 var ttsCmd = &cobra.Command{
 	Use:   "tts <message>",
 	Short: "text-to-speech",
+	Long: `Turn the message into speech and play it on the device. The message is read
+from stdin if it is '-', or from a file with --file. A long text is split
+between sentences into pieces of at most --max-chunk-length bytes, which are
+played as a queue.
+
+The speech is synthesized by --engine:
+  google     Google Cloud Text-to-Speech, needs --google-service-account
+  espeak-ng  the espeak-ng command, works offline
+  piper      the piper command, works offline and needs the model file as --voice
+  pico2wave  the pico2wave command, works offline
+  command    the command line in --engine-command
+  http       the self-hosted text-to-speech server at --engine-url
+
+The message is SSML markup with --ssml, or it is read from --ssml-file. The
+google and espeak-ng engines support SSML. --gender, --speaking-rate, --pitch
+and --volume-gain change the voice, as far as the engine supports them, and
+'tts voices' lists the voices of the engine.
+
+The speech is cached in the 'tts' directory next to the storage file, so the
+same text is only synthesized once, unless --disable-cache is set. The least
+recently used speech is removed once the cache grows over --cache-size MB,
+'cache clear' removes all of it.
+
+With --announce whatever is playing is interrupted for the speech and restored
+afterwards, see 'announce'.
+
+--engine-command is split on spaces outside of quotes, and these placeholders
+in it are replaced:
+
+  {text}      the message, or the piece of it being synthesized
+  {ssml}      'true' with --ssml or --ssml-file, otherwise 'false'
+  {lang}      --language-code
+  {voice}     --voice, or --language-code if there is none
+  {gender}    --gender
+  {rate}      --speaking-rate, 1 is the normal speed
+  {pitch}     --pitch
+  {gain}      --volume-gain
+  {encoding}  --audio-encoding
+  {output}    a file to write the audio to
+
+The message is written to the command's stdin if it has no {text}, and the
+audio is read from its stdout if it has no {output}, ie:
+
+  --engine-command "mimic3 --voice {voice}"
+
+--engine-url is requested with GET if it has {text}, or else the message is
+POSTed to it. The same placeholders are replaced, except {output}, ie:
+
+  --engine-url "http://localhost:5500/api/tts?voice={voice}&text={text}"`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		if len(args) != 1 || args[0] == "" {
-			fmt.Printf("expected exactly one argument to convert to speech\n")
+		text, err := ttsText(cmd, args)
+		if err != nil {
+			fmt.Printf("%v\n", err)
 			return
 		}
 
-		googleServiceAccount, _ := cmd.Flags().GetString("google-service-account")
-		if googleServiceAccount == "" {
-			fmt.Printf("--google-service-account is required\n")
+		announce, _ := cmd.Flags().GetBool("announce")
+		announceVolume, _ := cmd.Flags().GetFloat32("announce-volume")
+		if announceVolume < 0 || announceVolume > 1 {
+			fmt.Printf("--announce-volume is out of range (0 - 1)\n")
 			return
 		}
 
-		languageCode, _ := cmd.Flags().GetString("language-code")
-
-		b, err := ioutil.ReadFile(googleServiceAccount)
+		engine, err := ttsEngine(cmd)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		if dir, ok, err := ttsCacheDir(cmd); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		} else if ok {
+			cacheSize, _ := cmd.Flags().GetInt64("cache-size")
+			engine = tts.NewCachedEngine(engine, ttsCacheKey(cmd), dir, cacheSize*1024*1024)
+		}
+		req, err := ttsRequest(cmd, "")
 		if err != nil {
-			fmt.Printf("unable to open google service account file: %v\n", err)
+			fmt.Printf("%v\n", err)
 			return
 		}
 
+		// SSML can't be split without breaking its markup.
+		chunks := []string{text}
+		if !req.SSML {
+			maxChunkLength, _ := cmd.Flags().GetInt("max-chunk-length")
+			chunks = tts.Split(text, maxChunkLength)
+		}
+		media := make([]application.MemoryMedia, len(chunks))
+		for i, chunk := range chunks {
+			req.Text = chunk
+			ctx, cancel := context.WithTimeout(context.Background(), ttsTimeout)
+			audio, err := engine.Synthesize(ctx, req)
+			cancel()
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return
+			}
+			media[i] = application.MemoryMedia{
+				Name:        fmt.Sprintf("speech-%d", i+1),
+				ContentType: audio.ContentType,
+				Data:        audio.Data,
+			}
+		}
+
 		app, err := castApplication(cmd, args)
 		if err != nil {
 			fmt.Printf("unable to get cast application: %v\n", err)
 			return
 		}
 
-		data, err := tts.Create(args[0], b, languageCode)
-		if err != nil {
-			fmt.Printf("%v\n", err)
+		if announce {
+			if err := app.AnnounceMemory(media, announceVolume); err != nil {
+				fmt.Printf("unable to announce: %v\n", err)
+			}
+			return
+		}
+		if err := app.LoadMemory(media); err != nil {
+			fmt.Printf("unable to load media to device: %v\n", err)
 			return
 		}
 
-		f, err := ioutil.TempFile("", "go-chromecast-tts")
+		return
+	},
+}
+
+var ttsVoicesCmd = &cobra.Command{
+	Use:   "voices",
+	Short: "List the voices of the text-to-speech engine",
+	Long: `List the voices of the text-to-speech engine for --language-code, or for
+every language if it is empty. The google, espeak-ng and pico2wave engines can
+list their voices.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		engine, err := ttsEngine(cmd)
 		if err != nil {
-			fmt.Printf("unable to create temp file: %v", err)
+			fmt.Printf("%v\n", err)
+			return
+		}
+		lister, ok := engine.(tts.VoiceLister)
+		if !ok {
+			fmt.Printf("the %s engine can't list its voices\n", cmd.Flag("engine").Value)
 			return
 		}
-		defer os.Remove(f.Name())
+		languageCode, _ := cmd.Flags().GetString("language-code")
 
-		if _, err := f.Write(data); err != nil {
-			fmt.Printf("unable to write to temp file: %v\n", err)
+		ctx, cancel := context.WithTimeout(context.Background(), ttsTimeout)
+		defer cancel()
+		voices, err := lister.Voices(ctx, languageCode)
+		if err != nil {
+			fmt.Printf("%v\n", err)
 			return
 		}
-		if err := f.Close(); err != nil {
-			fmt.Printf("unable to close temp file: %v\n", err)
+		if len(voices) == 0 {
+			fmt.Printf("no voices found\n")
 			return
 		}
+		for _, v := range voices {
+			gender := v.Gender
+			if gender == "" {
+				gender = "-"
+			}
+			fmt.Printf("%s languages=%s gender=%s\n", v.Name, strings.Join(v.LanguageCodes, ","), gender)
+		}
+	},
+}
 
-		if err := app.Load(f.Name(), "audio/mp3", false, false); err != nil {
-			fmt.Printf("unable to load media to device: %v\n", err)
-			return
+// ttsEngine returns the engine set by the flags of the tts command.
+func ttsEngine(cmd *cobra.Command) (tts.Engine, error) {
+	engineName, _ := cmd.Flags().GetString("engine")
+	engineCommand, _ := cmd.Flags().GetString("engine-command")
+	engineURL, _ := cmd.Flags().GetString("engine-url")
+	googleServiceAccount, _ := cmd.Flags().GetString("google-service-account")
+
+	config := tts.Config{Command: engineCommand, URL: engineURL}
+	if engineName == tts.EngineGoogle {
+		if googleServiceAccount == "" {
+			return nil, errors.New("--google-service-account is required")
+		}
+		b, err := ioutil.ReadFile(googleServiceAccount)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to open google service account file")
 		}
+		config.GoogleServiceAccountKey = b
+	}
+	return tts.New(engineName, config)
+}
 
-		return
-	},
+// ttsText returns the text to speak, from the message, stdin if the message
+// is '-', or --file or --ssml-file.
+func ttsText(cmd *cobra.Command, args []string) (string, error) {
+	file, _ := cmd.Flags().GetString("file")
+	ssmlFile, _ := cmd.Flags().GetString("ssml-file")
+
+	var b []byte
+	var err error
+	switch {
+	case file != "" && ssmlFile != "":
+		return "", errors.New("expected either --file or --ssml-file")
+	case (file != "" || ssmlFile != "") && len(args) != 0:
+		return "", errors.New("expected either a message or a file")
+	case file != "":
+		b, err = ioutil.ReadFile(file)
+	case ssmlFile != "":
+		b, err = ioutil.ReadFile(ssmlFile)
+	case len(args) != 1:
+		return "", errors.New("expected exactly one argument to convert to speech")
+	case args[0] == "-":
+		b, err = ioutil.ReadAll(stdin)
+	default:
+		b = []byte(args[0])
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read the text")
+	}
+	text := strings.TrimSpace(string(b))
+	if text == "" {
+		return "", errors.New("there is no text to convert to speech")
+	}
+	return text, nil
+}
+
+// ttsCacheDir returns the directory synthesized speech is cached in, the
+// 'tts' directory next to the storage file. ok is false if the cache is
+// disabled, or the storage isn't kept on disk.
+func ttsCacheDir(cmd *cobra.Command) (dir string, ok bool, err error) {
+	disableCache, _ := cmd.Flags().GetBool("disable-cache")
+	backend, _ := cmd.Flags().GetString("store")
+	path, _ := cmd.Flags().GetString("store-path")
+	if disableCache || backend == storage.BackendMemory {
+		return "", false, nil
+	}
+	if path != "" {
+		return filepath.Join(filepath.Dir(path), "tts"), true, nil
+	}
+	if dir, err = storage.DefaultDir(); err != nil {
+		return "", false, err
+	}
+	return filepath.Join(dir, "tts"), true, nil
+}
+
+// ttsCacheKey identifies the engine set by the flags of the tts command in
+// the cache, the request is added to it by the engine.
+func ttsCacheKey(cmd *cobra.Command) string {
+	engineName, _ := cmd.Flags().GetString("engine")
+	engineCommand, _ := cmd.Flags().GetString("engine-command")
+	engineURL, _ := cmd.Flags().GetString("engine-url")
+	return strings.Join([]string{engineName, engineCommand, engineURL}, "\n")
+}
+
+// ttsRequest returns the request to synthesize text with the flags of the
+// tts command.
+func ttsRequest(cmd *cobra.Command, text string) (tts.Request, error) {
+	ssml, _ := cmd.Flags().GetBool("ssml")
+	ssmlFile, _ := cmd.Flags().GetString("ssml-file")
+	languageCode, _ := cmd.Flags().GetString("language-code")
+	voice, _ := cmd.Flags().GetString("voice")
+	gender, _ := cmd.Flags().GetString("gender")
+	speakingRate, _ := cmd.Flags().GetFloat64("speaking-rate")
+	pitch, _ := cmd.Flags().GetFloat64("pitch")
+	volumeGain, _ := cmd.Flags().GetFloat64("volume-gain")
+	encoding, _ := cmd.Flags().GetString("audio-encoding")
+
+	req := tts.Request{
+		Text:         text,
+		SSML:         ssml || ssmlFile != "",
+		LanguageCode: languageCode,
+		Voice:        voice,
+		Gender:       gender,
+		SpeakingRate: speakingRate,
+		Pitch:        pitch,
+		VolumeGain:   volumeGain,
+		Encoding:     encoding,
+	}
+	return req, req.Validate()
 }
 
 func init() {
 	rootCmd.AddCommand(ttsCmd)
-	ttsCmd.Flags().String("google-service-account", "", "google service account JSON file")
-	ttsCmd.Flags().String("language-code", "en-US", "text-to-speech Language Code (de-DE, ja-JP,...)")
+	ttsCmd.AddCommand(ttsVoicesCmd)
+	ttsCmd.PersistentFlags().String("engine", tts.EngineGoogle, fmt.Sprintf("text-to-speech engine, one of %s", strings.Join(tts.Engines, ", ")))
+	ttsCmd.PersistentFlags().String("engine-command", "", "command line run by the 'command' engine")
+	ttsCmd.PersistentFlags().String("engine-url", "", "url of the text-to-speech server used by the 'http' engine")
+	ttsCmd.PersistentFlags().String("google-service-account", "", "google service account JSON file")
+	ttsCmd.PersistentFlags().String("language-code", "en-US", "text-to-speech Language Code (de-DE, ja-JP,...)")
+	ttsCmd.PersistentFlags().Int64("cache-size", 100, "maximum size in MB of the speech cache, the least recently used speech is removed first")
+	ttsCmd.Flags().String("voice", "", "voice to speak with, what it is depends on the engine, ie: the model file for piper, see 'tts voices'")
+	ttsCmd.Flags().Bool("ssml", false, "the message is SSML markup")
+	ttsCmd.Flags().StringP("file", "f", "", "file with the text to speak, instead of the message")
+	ttsCmd.Flags().Int("max-chunk-length", 500, "longest piece of text, in bytes, synthesized at once; longer texts are split between sentences and played as a queue, 0 doesn't split")
+	ttsCmd.Flags().String("ssml-file", "", "file with the SSML markup to speak, instead of the message")
+	ttsCmd.Flags().String("gender", "", "gender of the voice, one of male, female, neutral")
+	ttsCmd.Flags().Float64("speaking-rate", 0, "speed of the speech from 0.25 to 4, ie: 0.8 is slower, 0 is the normal speed")
+	ttsCmd.Flags().Float64("pitch", 0, "change of the pitch in semitones, from -20 to 20")
+	ttsCmd.Flags().Float64("volume-gain", 0, "change of the volume in dB, from -96 to 16")
+	ttsCmd.Flags().Bool("announce", false, "go back to what was playing after the speech")
+	ttsCmd.Flags().Float32("announce-volume", 0, "volume to play the speech at with --announce, from 0 to 1; 0 keeps the current volume")
+	ttsCmd.Flags().String("audio-encoding", "", "audio encoding the engine should create, one of mp3, ogg-opus, wav; only the google engine supports all of them")
 }
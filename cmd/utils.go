@@ -2,11 +2,19 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,7 +22,9 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/grasparv/go-chromecast/application"
 	castdns "github.com/grasparv/go-chromecast/dns"
+	"github.com/grasparv/go-chromecast/registry"
 	"github.com/grasparv/go-chromecast/storage"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func init() {
@@ -23,14 +33,22 @@ func init() {
 }
 
 var (
-	cache = storage.NewStorage()
+	// cache keeps the found devices and played media, it is opened from the
+	// root flags by openStore on first use.
+	cache storage.Store
+
+	// openedApps are the applications that are closed when interrupted.
+	openedAppsMu  sync.Mutex
+	openedApps    []*application.Application
+	closeOnSignal sync.Once
 )
 
 type CachedDNSEntry struct {
-	UUID string `json:"uuid"`
-	Name string `json:"name"`
-	Addr string `json:"addr"`
-	Port int    `json:"port"`
+	UUID   string `json:"uuid"`
+	Name   string `json:"name"`
+	Addr   string `json:"addr"`
+	Port   int    `json:"port"`
+	Device string `json:"device"`
 }
 
 func (e CachedDNSEntry) GetUUID() string {
@@ -49,42 +67,71 @@ func (e CachedDNSEntry) GetPort() int {
 	return e.Port
 }
 
-func castApplication(cmd *cobra.Command, args []string) (*application.Application, error) {
+func (e CachedDNSEntry) GetDevice() string {
+	return e.Device
+}
+
+func castApplication(cmd *cobra.Command, args []string, opts ...application.ApplicationOption) (*application.Application, error) {
 	deviceName, _ := cmd.Flags().GetString("device-name")
 	deviceUuid, _ := cmd.Flags().GetString("uuid")
 	device, _ := cmd.Flags().GetString("device")
-	debug, _ := cmd.Flags().GetBool("debug")
-	disableCache, _ := cmd.Flags().GetBool("disable-cache")
 	addr, _ := cmd.Flags().GetString("addr")
 	port, _ := cmd.Flags().GetString("port")
+	return connectCastApplication(cmd, device, deviceName, deviceUuid, addr, port, opts...)
+}
+
+// connectCastApplication connects to the device matching device, deviceName,
+// deviceUuid or addr, the remaining settings are taken from the root flags.
+func connectCastApplication(cmd *cobra.Command, device, deviceName, deviceUuid, addr, port string, opts ...application.ApplicationOption) (*application.Application, error) {
+	debug, _ := cmd.Flags().GetBool("debug")
+	disableCache, _ := cmd.Flags().GetBool("disable-cache")
 	iface, _ := cmd.Flags().GetString("iface")
+	pinMediaClient, _ := cmd.Flags().GetBool("pin-media-client")
+	transcodeModeName, _ := cmd.Flags().GetString("transcode-mode")
+	transcodeCacheDir, _ := cmd.Flags().GetString("transcode-cache-dir")
+	transcodeCacheSize, _ := cmd.Flags().GetInt64("transcode-cache-size")
+	pretranscode, _ := cmd.Flags().GetInt("pretranscode")
+	maxTranscodes, _ := cmd.Flags().GetInt("max-transcodes")
+
+	dnsCacheTTL, _ := cmd.Flags().GetDuration("dns-cache-ttl")
+
+	transcodeMode, err := application.ParseTranscodeMode(transcodeModeName)
+	if err != nil {
+		return nil, err
+	}
+	store, err := openStore(cmd)
+	if err != nil {
+		return nil, err
+	}
 
 	var entry castdns.CastDNSEntry
+	var selection deviceSelection
+	cached, discovered := false, false
 	// If no address was specified, attempt to determine the address of any
 	// local chromecast devices.
 	if addr == "" {
-		// If a device name or uuid was specified, check the cache for the ip+port
-		found := false
-		if !disableCache && (deviceName != "" || deviceUuid != "") {
-			entry = findCachedCastDNS(deviceName, deviceUuid)
-			found = entry.GetAddr() != ""
-		}
-		if !found {
-			var err error
-			if entry, err = findCastDNS(device, deviceName, deviceUuid); err != nil {
-				return nil, errors.Wrap(err, "unable to find cast dns entry")
-			}
+		devices, err := loadRegistry(cmd)
+		if err != nil {
+			return nil, err
 		}
-		if !disableCache {
-			cachedEntry := CachedDNSEntry{
-				UUID: entry.GetUUID(),
-				Name: entry.GetName(),
-				Addr: entry.GetAddr(),
-				Port: entry.GetPort(),
+		selection = newDeviceSelection(cmd, device, deviceName, deviceUuid)
+		// Devices in the devices file are used without looking for them,
+		// they are on networks where discovery doesn't work.
+		if d, ok := findRegistryDevice(devices, selection); ok {
+			entry = d.Entry()
+			fmt.Fprintf(os.Stderr, "using %s\n", formatCastEntry(d.Entry()))
+		} else {
+			// If a device name or uuid was specified, check the cache for the ip+port
+			if !disableCache && (deviceName != "" || deviceUuid != "") {
+				entry = findCachedCastDNS(store, deviceName, deviceUuid)
+				cached = entry.GetAddr() != ""
+			}
+			if !cached {
+				if entry, err = findCastDNS(cmd, selection); err != nil {
+					return nil, errors.Wrap(err, "unable to find cast dns entry")
+				}
+				discovered = true
 			}
-			cachedEntryJson, _ := json.Marshal(cachedEntry)
-			cache.Save(getCacheKey(cachedEntry.UUID), cachedEntryJson)
-			cache.Save(getCacheKey(cachedEntry.Name), cachedEntryJson)
 		}
 		if debug {
 			fmt.Printf("using device name=%s addr=%s port=%d uuid=%s\n", entry.GetName(), entry.GetAddr(), entry.GetPort(), entry.GetUUID())
@@ -99,26 +146,98 @@ func castApplication(cmd *cobra.Command, args []string) (*application.Applicatio
 			Port: p,
 		}
 	}
-	app := application.NewApplication(iface, debug, disableCache)
-	if err := app.Start(entry); err != nil {
-		// NOTE: currently we delete the dns cache every time we get
-		// an error, this is to make sure that if the device gets a new
-		// ipaddress we will invalidate the cache.
-		cache.Save(getCacheKey(entry.GetUUID()), []byte{})
-		cache.Save(getCacheKey(entry.GetName()), []byte{})
+	opts = append([]application.ApplicationOption{
+		application.WithStore(store),
+		application.WithMediaClientPinning(pinMediaClient),
+		application.WithTranscodeMode(transcodeMode),
+		application.WithMaxTranscodes(maxTranscodes),
+	}, opts...)
+	if transcodeCacheDir != "" {
+		opts = append(opts, application.WithTranscodeCache(transcodeCacheDir, transcodeCacheSize*1024*1024, pretranscode))
+	}
+	app := application.NewApplication(iface, debug, disableCache, opts...)
+	err = app.Start(entry)
+	if err != nil && cached {
+		// The device may have a new address since it was cached, so look
+		// for it again rather than failing. The cached entry is only
+		// replaced once the device has been found.
+		if entry, err = findCastDNS(cmd, selection); err != nil {
+			return nil, errors.Wrap(err, "unable to find cast dns entry")
+		}
+		discovered = true
+		app = application.NewApplication(iface, debug, disableCache, opts...)
+		err = app.Start(entry)
+	}
+	if err != nil {
 		return nil, err
 	}
+	if discovered && !disableCache {
+		cachedEntry := CachedDNSEntry{
+			UUID:   entry.GetUUID(),
+			Name:   entry.GetName(),
+			Addr:   entry.GetAddr(),
+			Port:   entry.GetPort(),
+			Device: entry.GetDevice(),
+		}
+		cachedEntryJson, _ := json.Marshal(cachedEntry)
+		for _, key := range []string{cachedEntry.UUID, cachedEntry.Name} {
+			if err := store.Save(getCacheKey(key), cachedEntryJson, dnsCacheTTL); err != nil {
+				fmt.Fprintf(os.Stderr, "unable to cache cast dns entry: %v\n", err)
+				break
+			}
+		}
+	}
+
+	closeOnInterrupt(app)
 	return app, nil
 }
 
+// closeOnInterrupt closes the application, along with every other opened
+// application, when interrupted. This makes sure no ffmpeg processes are left
+// behind. A single signal handler is installed for all of them.
+func closeOnInterrupt(app *application.Application) {
+	openedAppsMu.Lock()
+	openedApps = append(openedApps, app)
+	openedAppsMu.Unlock()
+
+	closeOnSignal.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			openedAppsMu.Lock()
+			for _, app := range openedApps {
+				app.Close()
+			}
+			openedAppsMu.Unlock()
+			os.Exit(1)
+		}()
+	})
+}
+
 func getCacheKey(suffix string) string {
 	return fmt.Sprintf("cmd/utils/dns/%s", suffix)
 }
 
-func findCachedCastDNS(deviceName, deviceUuid string) castdns.CastDNSEntry {
+// openStore returns the store selected by the root flags.
+func openStore(cmd *cobra.Command) (storage.Store, error) {
+	if cache != nil {
+		return cache, nil
+	}
+	backend, _ := cmd.Flags().GetString("store")
+	path, _ := cmd.Flags().GetString("store-path")
+	store, err := storage.Open(backend, path)
+	if err != nil {
+		return nil, err
+	}
+	cache = store
+	return cache, nil
+}
+
+func findCachedCastDNS(store storage.Store, deviceName, deviceUuid string) castdns.CastDNSEntry {
 	for _, s := range []string{deviceName, deviceUuid} {
 		cacheKey := getCacheKey(s)
-		if b, err := cache.Load(cacheKey); err == nil {
+		if b, err := store.Load(cacheKey); err == nil {
 			cachedEntry := CachedDNSEntry{}
 			if err := json.Unmarshal(b, &cachedEntry); err == nil {
 				return cachedEntry
@@ -128,42 +247,281 @@ func findCachedCastDNS(deviceName, deviceUuid string) castdns.CastDNSEntry {
 	return CachedDNSEntry{}
 }
 
-func findCastDNS(device, deviceName, deviceUuid string) (castdns.CastDNSEntry, error) {
-	dnsEntries := castdns.FindCastDNSEntries()
-	switch l := len(dnsEntries); l {
-	case 0:
-		return castdns.CastEntry{}, errors.New("no cast dns entries found")
-	default:
-		for _, d := range dnsEntries {
-			if (deviceUuid != "" && d.UUID == deviceUuid) || (deviceName != "" && d.DeviceName == deviceName) || (device != "" && d.Device == device) {
-				return d, nil
-			}
-		}
+// networkInterface returns the network interface with the given name, or nil
+// if no name is given.
+func networkInterface(name string) (*net.Interface, error) {
+	if name == "" {
+		return nil, nil
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to find network interface %q", name)
+	}
+	return iface, nil
+}
 
-		if l == 1 {
-			return dnsEntries[0], nil
+// formatCastEntry formats the entry the same way for every command that
+// lists devices.
+func formatCastEntry(d castdns.CastEntry) string {
+	entryType := "device"
+	if d.IsGroup() {
+		entryType = "group"
+	}
+	return fmt.Sprintf("device=%q device_name=%q address=%q status=%q uuid=%q type=%q", d.Device, d.DeviceName, net.JoinHostPort(d.GetAddr(), strconv.Itoa(d.Port)), d.Status, d.UUID, entryType)
+}
+
+// deviceSelection is how a device is picked from the discovered devices.
+type deviceSelection struct {
+	device     string
+	deviceName string
+	deviceUuid string
+	// first picks the first of several matching devices.
+	first bool
+	// index picks the device at this 1-based position in the list of
+	// matching devices, 0 if unset.
+	index int
+}
+
+// newDeviceSelection returns the selection for the given device, name and
+// uuid, with --first and --select taken from the root flags.
+func newDeviceSelection(cmd *cobra.Command, device, deviceName, deviceUuid string) deviceSelection {
+	first, _ := cmd.Flags().GetBool("first")
+	index, _ := cmd.Flags().GetInt("select")
+	return deviceSelection{
+		device:     device,
+		deviceName: deviceName,
+		deviceUuid: deviceUuid,
+		first:      first,
+		index:      index,
+	}
+}
+
+func (s deviceSelection) filtered() bool {
+	return s.device != "" || s.deviceName != "" || s.deviceUuid != ""
+}
+
+// match returns the entries that match the selection. Exact, case-insensitive
+// matches on the device name, model or uuid are preferred. Otherwise the
+// entries whose name or model contain the given value, ignoring case, spaces
+// and punctuation, or whose uuid starts with it are returned.
+func (s deviceSelection) match(entries []castdns.CastEntry) []castdns.CastEntry {
+	var exact, fuzzy []castdns.CastEntry
+	for _, d := range entries {
+		switch {
+		case (s.deviceUuid != "" && strings.EqualFold(d.UUID, s.deviceUuid)) ||
+			(s.deviceName != "" && strings.EqualFold(d.DeviceName, s.deviceName)) ||
+			(s.device != "" && strings.EqualFold(d.Device, s.device)):
+			exact = append(exact, d)
+		case (s.deviceUuid != "" && strings.HasPrefix(strings.ToLower(d.UUID), strings.ToLower(s.deviceUuid))) ||
+			(s.deviceName != "" && fuzzyContains(d.DeviceName, s.deviceName)) ||
+			(s.device != "" && fuzzyContains(d.Device, s.device)):
+			fuzzy = append(fuzzy, d)
 		}
+	}
+	if len(exact) > 0 {
+		return exact
+	}
+	return fuzzy
+}
+
+// fuzzyContains returns whether s contains substr, ignoring case and
+// anything that isn't a letter or digit, ie: 'livingroom' is in
+// 'Living Room Speaker'.
+func fuzzyContains(s, substr string) bool {
+	normalise := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, s)
+	}
+	substr = normalise(substr)
+	return substr != "" && strings.Contains(normalise(s), substr)
+}
+
+// stdin is where prompts are answered from, tests replace it along with
+// isInteractive.
+var stdin io.Reader = os.Stdin
+
+// stderr is where the chosen device is printed.
+var stderr io.Writer = os.Stderr
+
+// isInteractive returns whether stdin is a terminal a user can answer
+// prompts on.
+var isInteractive = func() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
 
-		fmt.Printf("Found %d cast dns entries, select one:\n", l)
-		for i, d := range dnsEntries {
-			fmt.Printf("%d) device=%q device_name=%q address=\"%s:%d\" status=%q uuid=%q\n", i+1, d.Device, d.DeviceName, d.AddrV4, d.Port, d.Status, d.UUID)
+// formatCastEntries lists the entries, one numbered entry per line.
+func formatCastEntries(entries []castdns.CastEntry) string {
+	lines := make([]string, len(entries))
+	for i, d := range entries {
+		lines[i] = fmt.Sprintf("%d) %s", i+1, formatCastEntry(d))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// loadRegistry loads the devices file given by the root flags.
+func loadRegistry(cmd *cobra.Command) (*registry.Registry, error) {
+	devicesFile, _ := cmd.Flags().GetString("devices-file")
+	return registry.Load(devicesFile)
+}
+
+// findRegistryDevice returns the device in the devices file with the
+// selected uuid, or failing that the selected name or model. Several devices
+// can be the same model, they are only picked from with the same prompt as
+// discovered devices.
+func findRegistryDevice(devices *registry.Registry, selection deviceSelection) (registry.Device, bool) {
+	for _, s := range []string{selection.deviceUuid, selection.deviceName} {
+		if s == "" {
+			continue
 		}
-		reader := bufio.NewReader(os.Stdin)
-		for {
-			fmt.Printf("Enter selection: ")
-			text, err := reader.ReadString('\n')
-			if err != nil {
-				fmt.Printf("error reading console: %v\n", err)
-				continue
+		if d, ok := devices.Find(s); ok {
+			return d, true
+		}
+	}
+	if selection.device != "" {
+		var found []registry.Device
+		for _, d := range devices.Devices {
+			if strings.EqualFold(d.Model, selection.device) {
+				found = append(found, d)
 			}
-			i, err := strconv.Atoi(strings.TrimSpace(text))
+		}
+		if len(found) == 1 {
+			return found[0], true
+		}
+	}
+	return registry.Device{}, false
+}
+
+// resolveTimeout is the longest any resolver is waited for.
+const resolveTimeout = 10 * time.Second
+
+// newResolvers returns the resolvers devices are discovered with, mDNS and
+// unicast DNS-SD if a dns server is given. Tests replace it to discover
+// fake devices.
+var newResolvers = func(iface *net.Interface, dnsServer, dnsDomain string) []castdns.Resolver {
+	resolvers := []castdns.Resolver{&castdns.MDNSResolver{Iface: iface}}
+	if dnsServer != "" {
+		resolvers = append(resolvers, &castdns.UnicastResolver{Server: dnsServer, Domain: dnsDomain})
+	}
+	return resolvers
+}
+
+// discoverCastEntries returns the devices found with mDNS, and with unicast
+// DNS-SD if a dns server was given, merged with the devices file.
+func discoverCastEntries(cmd *cobra.Command) ([]castdns.CastEntry, error) {
+	ifaceName, _ := cmd.Flags().GetString("iface")
+	dnsServer, _ := cmd.Flags().GetString("dns-server")
+	dnsDomain, _ := cmd.Flags().GetString("dns-domain")
+
+	iface, err := networkInterface(ifaceName)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := loadRegistry(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// The resolvers are run at the same time, since mDNS waits for
+	// a few seconds for devices to answer.
+	resolvers := newResolvers(iface, dnsServer, dnsDomain)
+	results := make([][]castdns.CastEntry, len(resolvers))
+	var wg sync.WaitGroup
+	for i, r := range resolvers {
+		wg.Add(1)
+		go func(i int, r castdns.Resolver) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+			defer cancel()
+			entries, err := r.Resolve(ctx)
 			if err != nil {
-				continue
-			} else if i < 1 || i > l {
-				continue
+				fmt.Fprintf(os.Stderr, "unable to look up cast devices: %v\n", err)
 			}
-			return dnsEntries[i-1], nil
+			results[i] = entries
+		}(i, r)
+	}
+	wg.Wait()
+
+	var dnsEntries []castdns.CastEntry
+	for _, entries := range results {
+		for _, e := range entries {
+			found := false
+			for _, d := range dnsEntries {
+				if e.UUID != "" && d.UUID == e.UUID {
+					found = true
+					break
+				}
+			}
+			if !found {
+				dnsEntries = append(dnsEntries, e)
+			}
+		}
+	}
+	return devices.Merge(dnsEntries), nil
+}
+
+func findCastDNS(cmd *cobra.Command, selection deviceSelection) (castdns.CastDNSEntry, error) {
+	dnsEntries, err := discoverCastEntries(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(dnsEntries) == 0 {
+		return castdns.CastEntry{}, errors.New("no cast dns entries found")
+	}
+
+	candidates := dnsEntries
+	if selection.filtered() {
+		candidates = selection.match(dnsEntries)
+		if len(candidates) == 0 {
+			return castdns.CastEntry{}, fmt.Errorf("no cast device matches, found %d cast devices:\n%s", len(dnsEntries), formatCastEntries(dnsEntries))
+		}
+	}
+
+	entry, err := selectCastEntry(candidates, selection)
+	if err != nil {
+		return castdns.CastEntry{}, err
+	}
+	// Printed to stderr so scripts can log which device was used without
+	// it mixing with the output of the command.
+	fmt.Fprintf(stderr, "using %s\n", formatCastEntry(entry))
+	return entry, nil
+}
+
+// selectCastEntry picks one of the candidates, the user is only prompted if
+// there is more than one, no --first or --select was given and stdin is a
+// terminal.
+func selectCastEntry(candidates []castdns.CastEntry, selection deviceSelection) (castdns.CastEntry, error) {
+	l := len(candidates)
+	switch {
+	case selection.index != 0:
+		if selection.index < 1 || selection.index > l {
+			return castdns.CastEntry{}, fmt.Errorf("--select %d is out of range, found %d cast devices:\n%s", selection.index, l, formatCastEntries(candidates))
+		}
+		return candidates[selection.index-1], nil
+	case l == 1 || selection.first:
+		return candidates[0], nil
+	case !isInteractive():
+		return castdns.CastEntry{}, fmt.Errorf("found %d cast devices, pick one with --first, --select, --device-name or --uuid:\n%s", l, formatCastEntries(candidates))
+	}
+
+	fmt.Printf("Found %d cast dns entries, select one:\n", l)
+	fmt.Println(formatCastEntries(candidates))
+	reader := bufio.NewReader(stdin)
+	for {
+		fmt.Printf("Enter selection: ")
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			return castdns.CastEntry{}, errors.Wrap(err, "error reading console")
+		}
+		i, err := strconv.Atoi(strings.TrimSpace(text))
+		if err != nil {
+			continue
+		} else if i < 1 || i > l {
+			continue
 		}
+		return candidates[i-1], nil
 	}
-	return castdns.CastEntry{}, errors.New("no cast dns entries found")
 }
@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	castdns "github.com/grasparv/go-chromecast/dns"
+	"github.com/grasparv/go-chromecast/dns/dnstest"
+	"github.com/grasparv/go-chromecast/registry"
+	"github.com/grasparv/go-chromecast/storage"
+)
+
+var testEntries = []castdns.CastEntry{
+	{DeviceName: "Living Room Speaker", Device: "Google Home Mini", UUID: "b87d86bed423a6feb8b91a7d2778b55c"},
+	{DeviceName: "Living Room TV", Device: "Chromecast", UUID: "b380c5847b3182e4fb2eb0d0e270bf16"},
+	{DeviceName: "Kitchen", Device: "Google Home Mini", UUID: "c1d2e3f4"},
+}
+
+// newTestCommand returns a command with the root flags that device discovery
+// reads, using an empty devices file in a temporary directory.
+func newTestCommand(t *testing.T) (*cobra.Command, string) {
+	dir, err := ioutil.TempDir("", "go-chromecast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().String("device", "", "")
+	cmd.Flags().String("device-name", "", "")
+	cmd.Flags().String("uuid", "", "")
+	cmd.Flags().String("iface", "", "")
+	cmd.Flags().String("dns-server", "", "")
+	cmd.Flags().String("dns-domain", "local.", "")
+	cmd.Flags().String("devices-file", filepath.Join(dir, "devices.json"), "")
+	cmd.Flags().Bool("first", false, "")
+	cmd.Flags().Int("select", 0, "")
+	return cmd, dir
+}
+
+// withResolvers makes discovery find the given entries until the returned
+// function is called.
+func withResolvers(entries ...castdns.CastEntry) func() {
+	original := newResolvers
+	newResolvers = func(*net.Interface, string, string) []castdns.Resolver {
+		return []castdns.Resolver{castdns.StaticResolver(entries)}
+	}
+	return func() { newResolvers = original }
+}
+
+// withStdin makes prompts read input, as if stdin was a terminal if
+// interactive is set, until the returned function is called.
+func withStdin(input string, interactive bool) func() {
+	originalStdin, originalInteractive := stdin, isInteractive
+	stdin = strings.NewReader(input)
+	isInteractive = func() bool { return interactive }
+	return func() { stdin, isInteractive = originalStdin, originalInteractive }
+}
+
+func deviceNames(entries []castdns.CastEntry) []string {
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.DeviceName
+	}
+	return names
+}
+
+func TestDeviceSelectionMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection deviceSelection
+		want      []string
+	}{
+		{"exact name ignoring case", deviceSelection{deviceName: "living room tv"}, []string{"Living Room TV"}},
+		{"fuzzy name", deviceSelection{deviceName: "livingroom"}, []string{"Living Room Speaker", "Living Room TV"}},
+		{"exact model preferred", deviceSelection{device: "chromecast"}, []string{"Living Room TV"}},
+		{"fuzzy model", deviceSelection{device: "home-mini"}, []string{"Living Room Speaker", "Kitchen"}},
+		{"uuid prefix", deviceSelection{deviceUuid: "B38"}, []string{"Living Room TV"}},
+		{"no match", deviceSelection{deviceName: "garage"}, []string{}},
+	}
+	for _, test := range tests {
+		got := deviceNames(test.selection.match(testEntries))
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestFuzzyContains(t *testing.T) {
+	tests := []struct {
+		s, substr string
+		want      bool
+	}{
+		{"Living Room Speaker", "livingroom", true},
+		{"Living Room Speaker", "ROOM-speaker", true},
+		{"Google Home Mini", "home mini", true},
+		{"Kitchen", "kitchen 2", false},
+		// Nothing is left of a value without letters or digits.
+		{"Kitchen", "--", false},
+		{"Kitchen", "", false},
+	}
+	for _, test := range tests {
+		if got := fuzzyContains(test.s, test.substr); got != test.want {
+			t.Errorf("%q in %q: expected %v, got %v", test.substr, test.s, test.want, got)
+		}
+	}
+}
+
+func TestNewDeviceSelection(t *testing.T) {
+	cmd, dir := newTestCommand(t)
+	defer os.RemoveAll(dir)
+	cmd.Flags().Set("first", "true")
+	cmd.Flags().Set("select", "2")
+
+	got := newDeviceSelection(cmd, "Chromecast", "TV", "b38")
+	want := deviceSelection{device: "Chromecast", deviceName: "TV", deviceUuid: "b38", first: true, index: 2}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if !got.filtered() || (deviceSelection{first: true}).filtered() {
+		t.Errorf("expected only a device, name or uuid to filter the devices")
+	}
+}
+
+func TestSelectCastEntry(t *testing.T) {
+	tests := []struct {
+		name        string
+		candidates  []castdns.CastEntry
+		selection   deviceSelection
+		input       string
+		interactive bool
+		want        string
+		wantErr     string
+	}{
+		{name: "single", candidates: testEntries[:1], want: "Living Room Speaker"},
+		{name: "first", candidates: testEntries, selection: deviceSelection{first: true}, want: "Living Room Speaker"},
+		{name: "select", candidates: testEntries, selection: deviceSelection{index: 3}, want: "Kitchen"},
+		{name: "select out of range", candidates: testEntries, selection: deviceSelection{index: 4}, wantErr: "--select 4 is out of range"},
+		{name: "not interactive", candidates: testEntries, wantErr: "found 3 cast devices, pick one"},
+		{name: "prompt", candidates: testEntries, input: "5\nliving\n2\n", interactive: true, want: "Living Room TV"},
+		{name: "prompt closed", candidates: testEntries, input: "", interactive: true, wantErr: "error reading console"},
+	}
+	for _, test := range tests {
+		restore := withStdin(test.input, test.interactive)
+		got, err := selectCastEntry(test.candidates, test.selection)
+		restore()
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if got.DeviceName != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got.DeviceName)
+		}
+	}
+}
+
+func TestFindCastDNS(t *testing.T) {
+	defer withResolvers(testEntries...)()
+	defer withStdin("", false)()
+	cmd, dir := newTestCommand(t)
+	defer os.RemoveAll(dir)
+
+	var chosen strings.Builder
+	originalStderr := stderr
+	stderr = &chosen
+	defer func() { stderr = originalStderr }()
+
+	entry, err := findCastDNS(cmd, deviceSelection{deviceName: "kitchen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.GetName() != "Kitchen" {
+		t.Errorf("expected %q, got %q", "Kitchen", entry.GetName())
+	}
+	// The chosen device is printed for scripts to log.
+	if !strings.HasPrefix(chosen.String(), "using ") || !strings.Contains(chosen.String(), `device_name="Kitchen"`) {
+		t.Errorf("expected the chosen device on stderr, got %q", chosen.String())
+	}
+
+	// Several matches can't be picked from without a terminal, the
+	// candidates are listed instead.
+	if _, err := findCastDNS(cmd, deviceSelection{deviceName: "living"}); err == nil || !strings.Contains(err.Error(), "1) device=") || !strings.Contains(err.Error(), "Living Room TV") {
+		t.Errorf("expected an error listing the candidates, got %v", err)
+	}
+	entry, err = findCastDNS(cmd, deviceSelection{deviceName: "living", index: 2})
+	if err != nil || entry.GetName() != "Living Room TV" {
+		t.Errorf("expected --select to pick from the matches, got %q (%v)", entry.GetName(), err)
+	}
+
+	if _, err := findCastDNS(cmd, deviceSelection{deviceName: "garage"}); err == nil || !strings.Contains(err.Error(), "no cast device matches") {
+		t.Errorf("expected no match error, got %v", err)
+	}
+
+	// Devices in the devices file are found along with the discovered ones.
+	devicesFile, _ := cmd.Flags().GetString("devices-file")
+	devices, err := registry.Load(devicesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices.Add(registry.Device{Name: "Garage", Addr: "10.8.0.12"})
+	if err := devices.Save(); err != nil {
+		t.Fatal(err)
+	}
+	entry, err = findCastDNS(cmd, deviceSelection{deviceName: "garage"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.GetName() != "Garage" || entry.GetAddr() != "10.8.0.12" || entry.GetPort() != castdns.DefaultPort {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestFindRegistryDevice(t *testing.T) {
+	devices := &registry.Registry{Devices: []registry.Device{
+		{Name: "Garage", UUID: "a1b2c3", Addr: "10.8.0.12", Model: "Chromecast"},
+		{Name: "Cabin", Addr: "10.8.0.13", Model: "Google Home Mini"},
+		{Name: "Office", Addr: "10.8.0.14", Model: "Google Home Mini"},
+	}}
+	tests := []struct {
+		name      string
+		selection deviceSelection
+		want      string
+	}{
+		{"uuid", deviceSelection{deviceUuid: "A1B2C3"}, "Garage"},
+		{"uuid before name", deviceSelection{deviceUuid: "a1b2c3", deviceName: "cabin"}, "Garage"},
+		{"name", deviceSelection{deviceName: "cabin"}, "Cabin"},
+		{"model", deviceSelection{device: "chromecast"}, "Garage"},
+		{"name before model", deviceSelection{deviceName: "office", device: "chromecast"}, "Office"},
+		{"several of the model", deviceSelection{device: "Google Home Mini"}, ""},
+		{"fuzzy model", deviceSelection{device: "cast"}, ""},
+		{"no match", deviceSelection{deviceName: "kitchen"}, ""},
+		{"nothing selected", deviceSelection{}, ""},
+	}
+	for _, test := range tests {
+		d, ok := findRegistryDevice(devices, test.selection)
+		if ok != (test.want != "") || d.Name != test.want {
+			t.Errorf("%s: expected %q, got %q, %v", test.name, test.want, d.Name, ok)
+		}
+	}
+}
+
+func TestFindCastDNSNoDevices(t *testing.T) {
+	defer withResolvers()()
+	cmd, dir := newTestCommand(t)
+	defer os.RemoveAll(dir)
+
+	if _, err := findCastDNS(cmd, deviceSelection{}); err == nil {
+		t.Errorf("expected an error when no devices are found")
+	}
+}
+
+func TestFindCastDNSWithAdvertiser(t *testing.T) {
+	defer withStdin("", false)()
+	id := fmt.Sprintf("test%x", time.Now().UnixNano())
+	a, err := dnstest.NewAdvertiser(nil, dnstest.Service{ID: id, Model: "Chromecast", Name: "Advertised TV"})
+	if err != nil {
+		t.Skipf("mdns is not available: %v", err)
+	}
+	defer a.Close()
+	cmd, dir := newTestCommand(t)
+	defer os.RemoveAll(dir)
+
+	entry, err := findCastDNS(cmd, deviceSelection{deviceUuid: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.GetName() != "Advertised TV" || entry.GetAddr() != "127.0.0.1" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestFindCachedCastDNS(t *testing.T) {
+	store := storage.NewMemoryStore()
+	cachedEntry := CachedDNSEntry{UUID: "c1d2e3f4", Name: "Kitchen", Addr: "192.168.0.52", Port: 8009}
+	b, _ := json.Marshal(cachedEntry)
+	store.Save(getCacheKey(cachedEntry.UUID), b, 0)
+	store.Save(getCacheKey(cachedEntry.Name), b, 0)
+
+	if entry := findCachedCastDNS(store, "Kitchen", ""); entry.GetAddr() != "192.168.0.52" {
+		t.Errorf("expected the cached entry by name, got %+v", entry)
+	}
+	if entry := findCachedCastDNS(store, "", "c1d2e3f4"); entry.GetAddr() != "192.168.0.52" {
+		t.Errorf("expected the cached entry by uuid, got %+v", entry)
+	}
+	if entry := findCachedCastDNS(store, "Garage", ""); entry.GetAddr() != "" {
+		t.Errorf("expected no cached entry, got %+v", entry)
+	}
+}
@@ -15,8 +15,10 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -25,8 +27,23 @@ import (
 var volumeCmd = &cobra.Command{
 	Use:   "volume [<0.00 - 1.00>]",
 	Short: "Get or set volume",
-	Long:  "Get or set volume (float in range from 0 to 1)",
+	Long: `Get or set volume (float in range from 0 to 1)
+
+The volume of a speaker group applies to the group as a whole. Without a
+volume, the volume of the group is followed by the volume of each member,
+and when run in a terminal each member is prompted for a new volume. With
+--members a given volume is set on each member rather than on the group.
+--member only adjusts the named member.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		members, _ := cmd.Flags().GetBool("members")
+		member, _ := cmd.Flags().GetString("member")
+		if members || member != "" {
+			if err := groupVolume(cmd, args, member); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+			return
+		}
+
 		app, err := castApplication(cmd, args)
 		if err != nil {
 			fmt.Printf("unable to get cast application: %v\n", err)
@@ -53,10 +70,101 @@ var volumeCmd = &cobra.Command{
 
 		fmt.Printf("%0.2f\n", castVolume.Level)
 
+		// The members of a group have volumes of their own, list them or
+		// offer to adjust them.
+		if app.IsGroup() && len(args) == 0 {
+			if err := groupVolume(cmd, args, ""); err != nil {
+				fmt.Printf("%v\n", err)
+			}
+		}
 		return
 	},
 }
 
+// groupVolume gets or sets the volume of each member of a speaker group, or
+// only of the member matching the given name.
+func groupVolume(cmd *cobra.Command, args []string, member string) error {
+	var newVolume *float32
+	if len(args) == 1 && args[0] != "" {
+		v, err := strconv.ParseFloat(args[0], 32)
+		if err != nil {
+			return fmt.Errorf("invalid volume: %v", err)
+		}
+		volume := float32(v)
+		newVolume = &volume
+	}
+
+	group, err := findCastGroup(cmd)
+	if err != nil {
+		return err
+	}
+	members := group.Members
+	if member != "" {
+		if members = (deviceSelection{deviceName: member}).match(group.Members); len(members) != 1 {
+			return fmt.Errorf("found %d members of %q matching %q:\n%s", len(members), group.Entry.DeviceName, member, formatCastEntries(group.Members))
+		}
+	}
+
+	prompt := newVolume == nil && isInteractive()
+	reader := bufio.NewReader(stdin)
+	for _, m := range members {
+		app, err := connectCastApplication(cmd, "", "", "", m.GetAddr(), strconv.Itoa(m.Port))
+		if err != nil {
+			fmt.Printf("unable to get cast application for %q: %v\n", m.DeviceName, err)
+			continue
+		}
+		volume := newVolume
+		if prompt {
+			var current float32
+			if err := app.Update(); err == nil {
+				_, _, castVolume := app.Status()
+				current = castVolume.Level
+			}
+			if volume, err = promptVolume(reader, m.DeviceName, current); err != nil {
+				app.Close()
+				return err
+			}
+		}
+		if volume != nil {
+			if err := app.SetVolume(*volume); err != nil {
+				fmt.Printf("failed to set volume of %q: %v\n", m.DeviceName, err)
+			}
+		}
+		if err := app.Update(); err != nil {
+			fmt.Printf("unable to update cast info of %q: %v\n", m.DeviceName, err)
+		} else {
+			_, _, castVolume := app.Status()
+			fmt.Printf("%q %0.2f\n", m.DeviceName, castVolume.Level)
+		}
+		app.Close()
+	}
+	return nil
+}
+
+// promptVolume asks for the new volume of a group member, nil is returned
+// if the volume should be left as it is.
+func promptVolume(reader *bufio.Reader, name string, current float32) (*float32, error) {
+	for {
+		fmt.Printf("Volume of %q [%0.2f]: ", name, current)
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("error reading console: %v", err)
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, nil
+		}
+		v, err := strconv.ParseFloat(text, 32)
+		if err != nil || v < 0 || v > 1 {
+			continue
+		}
+		volume := float32(v)
+		return &volume, nil
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(volumeCmd)
+	volumeCmd.Flags().Bool("members", false, "get or set the volume of each member of a speaker group")
+	volumeCmd.Flags().String("member", "", "only get or set the volume of the speaker group member with this name")
 }
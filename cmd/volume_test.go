@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPromptVolume(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{name: "volume", input: "0.25\n", want: "0.25"},
+		{name: "keep the current volume", input: "\n", want: "unchanged"},
+		{name: "invalid volumes are asked again", input: "loud\n1.5\n-1\n 0.5 \n", want: "0.50"},
+		{name: "closed", input: "", wantErr: true},
+	}
+	for _, test := range tests {
+		volume, err := promptVolume(bufio.NewReader(strings.NewReader(test.input)), "Kitchen", 0.4)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		got := "unchanged"
+		if volume != nil {
+			got = fmt.Sprintf("%0.2f", *volume)
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: expected %s, got %s (%v)", test.name, test.want, got, err)
+		}
+	}
+}
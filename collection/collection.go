@@ -0,0 +1,203 @@
+// Package collection builds ordered lists of media files from directories,
+// with optional recursion, filtering and sorting.
+package collection
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MediaType is the broad kind of media in a file.
+type MediaType string
+
+const (
+	Audio MediaType = "audio"
+	Video MediaType = "video"
+	Image MediaType = "image"
+)
+
+var extensionTypes = map[string]MediaType{
+	".aac":  Audio,
+	".flac": Audio,
+	".m4a":  Audio,
+	".mp3":  Audio,
+	".oga":  Audio,
+	".ogg":  Audio,
+	".opus": Audio,
+	".wav":  Audio,
+	".wma":  Audio,
+	".avi":  Video,
+	".m4v":  Video,
+	".mkv":  Video,
+	".mov":  Video,
+	".mp4":  Video,
+	".mpeg": Video,
+	".mpg":  Video,
+	".ts":   Video,
+	".webm": Video,
+	".wmv":  Video,
+	".bmp":  Image,
+	".gif":  Image,
+	".heic": Image,
+	".heif": Image,
+	".jpeg": Image,
+	".jpg":  Image,
+	".png":  Image,
+	".tif":  Image,
+	".tiff": Image,
+	".webp": Image,
+}
+
+// ParseMediaType returns the MediaType for the given name.
+func ParseMediaType(name string) (MediaType, error) {
+	switch t := MediaType(strings.ToLower(name)); t {
+	case Audio, Video, Image:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown media type %q, expected %q, %q or %q", name, Audio, Video, Image)
+	}
+}
+
+// TypeOf returns the MediaType of a file based on its extension, or an
+// empty string if it isn't known.
+func TypeOf(filename string) MediaType {
+	return extensionTypes[strings.ToLower(filepath.Ext(filename))]
+}
+
+// Item is a media file in a collection.
+type Item struct {
+	// Filename is the path of the file, it is the directory that was
+	// collected joined with Name.
+	Filename string
+	// Name is the path of the file relative to the collected directory.
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Type    MediaType
+}
+
+// Options control which files are collected and in what order.
+type Options struct {
+	// Recursive includes the files in all subdirectories.
+	Recursive bool
+	// Include and Exclude are glob patterns, see filepath.Match, matched
+	// against both the file name and its path relative to the collected
+	// directory. If Include is set only matching files are collected.
+	Include []string
+	Exclude []string
+	// Types limits the collection to these types of media, if empty any
+	// media type is collected.
+	Types []MediaType
+	Sort  SortMode
+	// Seed is used for SortRandom, 0 picks a different order every time.
+	Seed int64
+	// Playable reports whether a file can be played, if nil every file
+	// that passes the other filters is collected.
+	Playable func(filename string) bool
+}
+
+// Collect returns the media files in dir that match opts, in the order
+// given by opts.Sort. Symlinks to files are followed, symlinks to
+// directories are not to avoid loops.
+func Collect(dir string, opts Options) ([]Item, error) {
+	// filepath.Walk doesn't follow a symlinked root, so walk its target
+	// while keeping the filenames under dir.
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list files from %q", dir)
+	}
+
+	var items []Item
+	err = filepath.Walk(root, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(root, filename)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if filename == root {
+				return nil
+			}
+			if !opts.Recursive || matchAny(opts.Exclude, name) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			// Broken symlinks are skipped like any other file that
+			// can't be played.
+			if info, err = os.Stat(filename); err != nil || info.IsDir() {
+				return nil
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		item := Item{
+			Filename: filepath.Join(dir, name),
+			Name:     name,
+			Size:     info.Size(),
+			ModTime:  info.ModTime(),
+			Type:     TypeOf(filename),
+		}
+		if opts.matches(item) {
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to list files from %q", dir)
+	}
+	sortItems(items, opts.Sort, opts.Seed)
+	return items, nil
+}
+
+func (opts Options) matches(item Item) bool {
+	if len(opts.Include) > 0 && !matchAny(opts.Include, item.Name) {
+		return false
+	}
+	if matchAny(opts.Exclude, item.Name) {
+		return false
+	}
+	if len(opts.Types) > 0 {
+		found := false
+		for _, t := range opts.Types {
+			found = found || item.Type == t
+		}
+		if !found {
+			return false
+		}
+	}
+	return opts.Playable == nil || opts.Playable(item.Filename)
+}
+
+// matchAny returns whether any of the patterns match either the base name
+// or the relative path.
+func matchAny(patterns []string, name string) bool {
+	base := filepath.Base(name)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Filenames returns the filename of each item.
+func Filenames(items []Item) []string {
+	filenames := make([]string, len(items))
+	for i, item := range items {
+		filenames[i] = item.Filename
+	}
+	return filenames
+}
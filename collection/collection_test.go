@@ -0,0 +1,287 @@
+package collection
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"a2", "a10", true},
+		{"a10", "a2", false},
+		{"track 2.mp3", "track 10.mp3", true},
+		{"a02", "a10", true},
+		{"a002", "a2", false},
+		{"a2", "a002", true},
+		{"a2", "a2", false},
+		{"A2", "a10", true},
+		{"apple", "Banana", true},
+		{"Banana", "apple", false},
+		{"Apple", "apple", true},
+		{"apple", "Apple", false},
+		{"a", "a1", true},
+		{"a1", "a", false},
+		{"1", "a", true},
+		{"disc1/track10", "disc2/track1", true},
+		{"disc10/track1", "disc2/track1", false},
+		{"file99999999999999999999", "file100000000000000000000", true},
+		{"", "a", true},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		if got := NaturalLess(test.a, test.b); got != test.less {
+			t.Errorf("NaturalLess(%q, %q): expected %v, got %v", test.a, test.b, test.less, got)
+		}
+	}
+}
+
+// testTree creates the files in a temporary directory, each with as many
+// bytes as its index, and returns the directory.
+func testTree(t *testing.T, names ...string) string {
+	dir, err := ioutil.TempDir("", "go-chromecast-collection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, make([]byte, i), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func names(items []Item) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = filepath.ToSlash(item.Name)
+	}
+	return names
+}
+
+func TestCollect(t *testing.T) {
+	dir := testTree(t,
+		"track10.mp3",
+		"track2.mp3",
+		"Track1.flac",
+		"cover.jpg",
+		"notes.txt",
+		"video.MKV",
+		"extras/bonus.mp3",
+		"extras/deep/hidden.mp3",
+		"skip/skipped.mp3",
+	)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{
+			name: "default",
+			want: []string{"cover.jpg", "notes.txt", "Track1.flac", "track2.mp3", "track10.mp3", "video.MKV"},
+		},
+		{
+			name: "recursive",
+			opts: Options{Recursive: true, Types: []MediaType{Audio}},
+			want: []string{
+				"extras/bonus.mp3", "extras/deep/hidden.mp3", "skip/skipped.mp3",
+				"Track1.flac", "track2.mp3", "track10.mp3",
+			},
+		},
+		{
+			name: "types",
+			opts: Options{Types: []MediaType{Image, Video}},
+			want: []string{"cover.jpg", "video.MKV"},
+		},
+		{
+			name: "include base name",
+			opts: Options{Recursive: true, Include: []string{"*.mp3"}},
+			want: []string{
+				"extras/bonus.mp3", "extras/deep/hidden.mp3", "skip/skipped.mp3",
+				"track2.mp3", "track10.mp3",
+			},
+		},
+		{
+			name: "include relative path",
+			opts: Options{Recursive: true, Include: []string{"extras/*"}},
+			want: []string{"extras/bonus.mp3"},
+		},
+		{
+			name: "exclude files and directories",
+			opts: Options{Recursive: true, Exclude: []string{"skip", "deep", "track1*"}, Types: []MediaType{Audio}},
+			want: []string{"extras/bonus.mp3", "Track1.flac", "track2.mp3"},
+		},
+		{
+			name: "exclude wins over include",
+			opts: Options{Include: []string{"*.mp3", "*.flac"}, Exclude: []string{"track2.mp3"}},
+			want: []string{"Track1.flac", "track10.mp3"},
+		},
+		{
+			name: "playable",
+			opts: Options{Playable: func(filename string) bool { return strings.HasSuffix(filename, ".mp3") }},
+			want: []string{"track2.mp3", "track10.mp3"},
+		},
+		{
+			name: "size",
+			opts: Options{Sort: SortSize, Types: []MediaType{Audio}},
+			want: []string{"track10.mp3", "track2.mp3", "Track1.flac"},
+		},
+	}
+	for _, test := range tests {
+		items, err := Collect(dir, test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := names(items); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+
+	items, err := Collect(dir, Options{Include: []string{"track2.mp3"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Item{
+		Filename: filepath.Join(dir, "track2.mp3"),
+		Name:     "track2.mp3",
+		Size:     1,
+		ModTime:  items[0].ModTime,
+		Type:     Audio,
+	}
+	if len(items) != 1 || items[0] != want {
+		t.Errorf("expected %+v, got %+v", want, items)
+	}
+
+	if _, err := Collect(filepath.Join(dir, "missing"), Options{}); err == nil {
+		t.Errorf("expected an error for a missing directory")
+	}
+}
+
+func TestCollectSymlinks(t *testing.T) {
+	dir := testTree(t, "music/a.mp3", "music/b.mp3", "elsewhere/linked.mp3", "elsewhere/sub/deep.mp3")
+	defer os.RemoveAll(dir)
+
+	symlinks := map[string]string{
+		"link":             "music",
+		"music/linked.mp3": filepath.Join("..", "elsewhere", "linked.mp3"),
+		"music/broken.mp3": "missing.mp3",
+		"music/linked-dir": filepath.Join("..", "elsewhere", "sub"),
+	}
+	for name, target := range symlinks {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Skipf("unable to create symlinks: %v", err)
+		}
+	}
+
+	root := filepath.Join(dir, "link")
+	items, err := Collect(root, Options{Recursive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.mp3", "b.mp3", "linked.mp3"}
+	if got := names(items); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	// Symlinked files keep their name under the root, with the size of
+	// the file they link to.
+	if linked := items[2]; linked.Filename != filepath.Join(root, "linked.mp3") || linked.Size != 2 {
+		t.Errorf("expected the symlinked file under the root, got %+v", linked)
+	}
+}
+
+func TestCollectSortMTime(t *testing.T) {
+	dir := testTree(t, "a.mp3", "b.mp3", "c.mp3", "d.mp3")
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	mtimes := map[string]time.Time{
+		"a.mp3": now,
+		"b.mp3": now.Add(-time.Hour),
+		"c.mp3": now.Add(-2 * time.Hour),
+		// Same time as a.mp3, ties are broken in natural order.
+		"d.mp3": now,
+	}
+	for name, mtime := range mtimes {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := Collect(dir, Options{Sort: SortMTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"c.mp3", "b.mp3", "a.mp3", "d.mp3"}
+	if got := names(items); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestCollectSortRandom(t *testing.T) {
+	var files []string
+	for _, c := range "abcdefghijklmnop" {
+		files = append(files, string(c)+".mp3")
+	}
+	dir := testTree(t, files...)
+	defer os.RemoveAll(dir)
+
+	collect := func(seed int64) []string {
+		items, err := Collect(dir, Options{Sort: SortRandom, Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names(items)
+	}
+
+	first := collect(42)
+	if again := collect(42); !reflect.DeepEqual(first, again) {
+		t.Errorf("expected the same order for the same seed, got %q and %q", first, again)
+	}
+	if reflect.DeepEqual(first, files) {
+		t.Errorf("expected a shuffled order, got %q", first)
+	}
+	if other := collect(7); reflect.DeepEqual(first, other) {
+		t.Errorf("expected a different order for a different seed, got %q", other)
+	}
+
+	sorted := append([]string(nil), first...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(sorted, files) {
+		t.Errorf("expected a permutation of %q, got %q", files, first)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	if m, err := ParseSortMode("MTime"); err != nil || m != SortMTime {
+		t.Errorf("expected %q, got %q, %v", SortMTime, m, err)
+	}
+	if _, err := ParseSortMode("name"); err == nil {
+		t.Errorf("expected an error for an unknown sort mode")
+	}
+	if mt, err := ParseMediaType("Audio"); err != nil || mt != Audio {
+		t.Errorf("expected %q, got %q, %v", Audio, mt, err)
+	}
+	if _, err := ParseMediaType("text"); err == nil {
+		t.Errorf("expected an error for an unknown media type")
+	}
+	if mt := TypeOf("dir/PHOTO.JPG"); mt != Image {
+		t.Errorf("expected %q, got %q", Image, mt)
+	}
+	if mt := TypeOf("notes.txt"); mt != "" {
+		t.Errorf("expected no type, got %q", mt)
+	}
+}
@@ -0,0 +1,153 @@
+package collection
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/grasparv/go-chromecast/probe"
+)
+
+// SortMode is the order the items in a collection are returned in.
+type SortMode string
+
+const (
+	// SortNatural sorts by path, comparing runs of digits as numbers so
+	// 'track 2' comes before 'track 10'.
+	SortNatural SortMode = "natural"
+	// SortMTime sorts by modification time, oldest first.
+	SortMTime SortMode = "mtime"
+	// SortSize sorts by file size, smallest first.
+	SortSize SortMode = "size"
+	// SortTag sorts by the disc and track number tags of each directory,
+	// falling back to natural order. This requires ffprobe.
+	SortTag SortMode = "tag"
+	// SortRandom shuffles the items.
+	SortRandom SortMode = "random"
+)
+
+// ParseSortMode returns the SortMode for the given name.
+func ParseSortMode(name string) (SortMode, error) {
+	switch m := SortMode(strings.ToLower(name)); m {
+	case SortNatural, SortMTime, SortSize, SortTag, SortRandom:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown sort mode %q, expected one of %q, %q, %q, %q or %q",
+			name, SortNatural, SortMTime, SortSize, SortTag, SortRandom)
+	}
+}
+
+func sortItems(items []Item, mode SortMode, seed int64) {
+	natural := func(i, j int) bool { return NaturalLess(items[i].Name, items[j].Name) }
+	switch mode {
+	case SortMTime:
+		sort.SliceStable(items, func(i, j int) bool {
+			if !items[i].ModTime.Equal(items[j].ModTime) {
+				return items[i].ModTime.Before(items[j].ModTime)
+			}
+			return natural(i, j)
+		})
+	case SortSize:
+		sort.SliceStable(items, func(i, j int) bool {
+			if items[i].Size != items[j].Size {
+				return items[i].Size < items[j].Size
+			}
+			return natural(i, j)
+		})
+	case SortTag:
+		sortByTags(items)
+	case SortRandom:
+		sort.SliceStable(items, natural)
+		Shuffle(len(items), seed, func(i, j int) {
+			items[i], items[j] = items[j], items[i]
+		})
+	default:
+		sort.SliceStable(items, natural)
+	}
+}
+
+// Shuffle randomises the order of n elements using swap, the same seed
+// always gives the same order. A seed of 0 picks a different order every time.
+func Shuffle(n int, seed int64, swap func(i, j int)) {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rand.New(rand.NewSource(seed)).Shuffle(n, swap)
+}
+
+// sortByTags orders the items of each directory by disc and track number,
+// items without tags come after those with them.
+func sortByTags(items []Item) {
+	type position struct{ disc, track int }
+	positions := make(map[string]position, len(items))
+	for _, item := range items {
+		if item.Type != Audio && item.Type != Video {
+			continue
+		}
+		if info, err := probe.Probe(item.Filename); err == nil {
+			positions[item.Filename] = position{disc: info.Disc(), track: info.Track()}
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		di, dj := filepath.Dir(items[i].Name), filepath.Dir(items[j].Name)
+		if di != dj {
+			return NaturalLess(di, dj)
+		}
+		pi, pj := positions[items[i].Filename], positions[items[j].Filename]
+		if (pi.track == 0) != (pj.track == 0) {
+			return pi.track != 0
+		}
+		if pi.disc != pj.disc {
+			return pi.disc < pj.disc
+		}
+		if pi.track != pj.track {
+			return pi.track < pj.track
+		}
+		return NaturalLess(items[i].Name, items[j].Name)
+	})
+}
+
+// NaturalLess compares two strings case insensitively, treating runs of
+// digits as numbers, ie: 'file2' < 'file10'.
+func NaturalLess(a, b string) bool {
+	ar, br := []rune(strings.ToLower(a)), []rune(strings.ToLower(b))
+	i, j := 0, 0
+	for i < len(ar) && j < len(br) {
+		if unicode.IsDigit(ar[i]) && unicode.IsDigit(br[j]) {
+			si, sj := i, j
+			for i < len(ar) && unicode.IsDigit(ar[i]) {
+				i++
+			}
+			for j < len(br) && unicode.IsDigit(br[j]) {
+				j++
+			}
+			na := strings.TrimLeft(string(ar[si:i]), "0")
+			nb := strings.TrimLeft(string(br[sj:j]), "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			// Equal numbers, the one with fewer leading zeros first.
+			if i-si != j-sj {
+				return i-si < j-sj
+			}
+			continue
+		}
+		if ar[i] != br[j] {
+			return ar[i] < br[j]
+		}
+		i++
+		j++
+	}
+	if len(ar)-i != len(br)-j {
+		return len(ar)-i < len(br)-j
+	}
+	return a < b
+}
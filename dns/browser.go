@@ -0,0 +1,492 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dnsmsg "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	castService = "_googlecast._tcp.local."
+
+	// How often the browser asks for all cast devices. Devices also
+	// announce themselves when they join the network or change, so this
+	// only needs to catch the ones that were missed.
+	defaultBrowseInterval = time.Minute
+)
+
+var (
+	mdnsIPv4Addr = &net.UDPAddr{IP: net.ParseIP("224.0.0.251"), Port: 5353}
+	mdnsIPv6Addr = &net.UDPAddr{IP: net.ParseIP("ff02::fb"), Port: 5353}
+)
+
+// EventType is the kind of change to a browsed cast entry.
+type EventType int
+
+const (
+	// Added is sent when a cast entry is first found.
+	Added EventType = iota
+	// Updated is sent when the address, port or TXT fields of a known cast
+	// entry change, this includes the 'rs' status field.
+	Updated
+	// Removed is sent when a cast entry leaves the network, or its records
+	// expire without being refreshed.
+	Removed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Added:
+		return "added"
+	case Updated:
+		return "updated"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// Event is a change to the cast entries found by a Browser.
+type Event struct {
+	Type  EventType
+	Entry CastEntry
+}
+
+// browsedService is a single '_googlecast._tcp' service instance, it is
+// built up from the PTR, SRV, TXT and address records as they arrive.
+type browsedService struct {
+	name    string
+	host    string
+	port    int
+	txt     []string
+	expires time.Time
+	// added is set once an Added event has been sent for the service.
+	added bool
+	entry CastEntry
+}
+
+// browsedHost is the addresses of a host, each expires with the TTL of the
+// record it came from.
+type browsedHost struct {
+	v4        net.IP
+	v4Expires time.Time
+	v6        net.IP
+	v6Expires time.Time
+	// zone is the interface the IPv6 address was received on, it is
+	// needed to dial link-local addresses.
+	zone string
+}
+
+// mdnsConn is a socket joined to the mDNS group of one address family.
+type mdnsConn struct {
+	conn  *net.UDPConn
+	group *net.UDPAddr
+}
+
+// received is an mDNS message and the zone of the interface it arrived on.
+type received struct {
+	msg  *dnsmsg.Msg
+	zone string
+}
+
+// Browser continuously browses for cast devices with mDNS. It tracks the
+// TTL of the records each device announces, and sends an Event whenever a
+// device is added, changes or goes away.
+type Browser struct {
+	iface    *net.Interface
+	interval time.Duration
+
+	mu       sync.Mutex
+	services map[string]*browsedService
+	hosts    map[string]*browsedHost
+	// Events are queued while the lock is held, and sent once it has been
+	// released so a slow reader can still call Entries.
+	pending []Event
+	events  chan Event
+}
+
+// NewBrowser returns a Browser that asks for all cast devices every interval,
+// an interval of 0 uses the default of one minute. If iface is set only that
+// network interface is browsed, otherwise the system default is used.
+func NewBrowser(iface *net.Interface, interval time.Duration) *Browser {
+	if interval <= 0 {
+		interval = defaultBrowseInterval
+	}
+	return &Browser{
+		iface:    iface,
+		interval: interval,
+		services: map[string]*browsedService{},
+		hosts:    map[string]*browsedHost{},
+	}
+}
+
+// Browse starts browsing until ctx is done, the returned channel receives an
+// event for every change and is closed once browsing has stopped. Events
+// must be read, otherwise browsing is blocked. Both IPv4 and IPv6 are
+// browsed, an error is only returned if neither is available.
+func (b *Browser) Browse(ctx context.Context) (<-chan Event, error) {
+	var conns []mdnsConn
+	var listenErr error
+	for _, group := range []*net.UDPAddr{mdnsIPv4Addr, mdnsIPv6Addr} {
+		network := "udp4"
+		if group.IP.To4() == nil {
+			network = "udp6"
+		}
+		conn, err := net.ListenMulticastUDP(network, b.iface, group)
+		if err != nil {
+			listenErr = err
+			continue
+		}
+		// Go turns off multicast loopback, turn it back on so services
+		// advertised on this machine are found too.
+		if network == "udp4" {
+			ipv4.NewPacketConn(conn).SetMulticastLoopback(true)
+		} else {
+			ipv6.NewPacketConn(conn).SetMulticastLoopback(true)
+		}
+		conns = append(conns, mdnsConn{conn: conn, group: group})
+	}
+	if len(conns) == 0 {
+		return nil, errors.Wrap(listenErr, "unable to listen for mdns")
+	}
+
+	b.events = make(chan Event, 16)
+	msgs := make(chan received, 32)
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c mdnsConn) {
+			defer wg.Done()
+			b.read(c, msgs)
+		}(c)
+	}
+	go func() {
+		<-ctx.Done()
+		for _, c := range conns {
+			c.conn.Close()
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(msgs)
+	}()
+	go b.run(ctx, conns, msgs)
+	return b.events, nil
+}
+
+// read receives mDNS packets until the connection is closed.
+func (b *Browser) read(c mdnsConn, msgs chan<- received) {
+	buf := make([]byte, 65536)
+	for {
+		n, from, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		msg := new(dnsmsg.Msg)
+		if err := msg.Unpack(buf[:n]); err != nil {
+			continue
+		}
+		zone := from.Zone
+		if zone == "" && b.iface != nil {
+			zone = b.iface.Name
+		}
+		msgs <- received{msg: msg, zone: zone}
+	}
+}
+
+func (b *Browser) run(ctx context.Context, conns []mdnsConn, msgs <-chan received) {
+	defer close(b.events)
+
+	// Ask a few times at the start, in case the first queries are lost.
+	queryTimes := []time.Duration{0, time.Second, 3 * time.Second}
+	query := time.NewTimer(0)
+	defer query.Stop()
+	expire := time.NewTicker(time.Second)
+	defer expire.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-query.C:
+			b.query(conns, castService, dnsmsg.TypePTR)
+			next := b.interval
+			if len(queryTimes) > 1 {
+				next = queryTimes[1] - queryTimes[0]
+				queryTimes = queryTimes[1:]
+			}
+			query.Reset(next)
+		case <-expire.C:
+			for _, missing := range b.expire(time.Now()) {
+				b.query(conns, missing.name, missing.qtype)
+			}
+		case r, ok := <-msgs:
+			if !ok {
+				return
+			}
+			for _, missing := range b.handle(r.msg, r.zone, time.Now()) {
+				b.query(conns, missing.name, missing.qtype)
+			}
+		}
+		if !b.flush(ctx) {
+			return
+		}
+	}
+}
+
+// flush sends the queued events, it returns false if ctx was done first.
+func (b *Browser) flush(ctx context.Context) bool {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	for _, e := range pending {
+		select {
+		case b.events <- e:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// query sends an mDNS question on every connection, from the mDNS port so
+// that the answers are multicast with their full TTLs.
+func (b *Browser) query(conns []mdnsConn, name string, qtype uint16) {
+	m := new(dnsmsg.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = false
+	buf, err := m.Pack()
+	if err != nil {
+		return
+	}
+	for _, c := range conns {
+		c.conn.WriteToUDP(buf, c.group)
+	}
+}
+
+type question struct {
+	name  string
+	qtype uint16
+}
+
+// handle applies the records in an mDNS message that arrived on the
+// interface zone, and returns questions for any records still needed to
+// complete a service.
+func (b *Browser) handle(msg *dnsmsg.Msg, zone string, now time.Time) []question {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	changed := map[*browsedService]bool{}
+	for _, answer := range append(msg.Answer, msg.Extra...) {
+		ttl := time.Duration(answer.Header().Ttl) * time.Second
+		switch rr := answer.(type) {
+		case *dnsmsg.PTR:
+			if !strings.EqualFold(rr.Hdr.Name, castService) {
+				continue
+			}
+			// A TTL of 0 is a goodbye, the device is leaving the network.
+			if ttl == 0 {
+				b.remove(rr.Ptr)
+				continue
+			}
+			changed[b.service(rr.Ptr, now.Add(ttl))] = true
+		case *dnsmsg.SRV:
+			if !isCastService(rr.Hdr.Name) {
+				continue
+			}
+			if ttl == 0 {
+				b.remove(rr.Hdr.Name)
+				continue
+			}
+			s := b.service(rr.Hdr.Name, now.Add(ttl))
+			s.host, s.port = rr.Target, int(rr.Port)
+			changed[s] = true
+		case *dnsmsg.TXT:
+			if !isCastService(rr.Hdr.Name) || ttl == 0 {
+				continue
+			}
+			s := b.service(rr.Hdr.Name, now.Add(ttl))
+			s.txt = rr.Txt
+			changed[s] = true
+		case *dnsmsg.A:
+			h := b.host(rr.Hdr.Name)
+			// A TTL of 0 is a goodbye for the address.
+			if ttl == 0 {
+				h.v4 = nil
+			} else {
+				h.v4, h.v4Expires = rr.A, now.Add(ttl)
+			}
+			for _, s := range b.servicesOnHost(rr.Hdr.Name) {
+				changed[s] = true
+			}
+		case *dnsmsg.AAAA:
+			h := b.host(rr.Hdr.Name)
+			if ttl == 0 {
+				h.v6, h.zone = nil, ""
+			} else {
+				h.v6, h.v6Expires, h.zone = rr.AAAA, now.Add(ttl), zone
+			}
+			for _, s := range b.servicesOnHost(rr.Hdr.Name) {
+				changed[s] = true
+			}
+		}
+	}
+	return b.resolve(changed)
+}
+
+// resolve updates the entries of the changed services, and returns
+// questions for any records still needed to complete them.
+func (b *Browser) resolve(changed map[*browsedService]bool) []question {
+	var missing []question
+	for s := range changed {
+		if b.services[strings.ToLower(s.name)] != s {
+			// Removed by a later record in the same message.
+			continue
+		}
+		h := b.hosts[strings.ToLower(s.host)]
+		switch {
+		case s.port == 0:
+			missing = append(missing, question{s.name, dnsmsg.TypeSRV})
+		case s.txt == nil:
+			missing = append(missing, question{s.name, dnsmsg.TypeTXT})
+		case h == nil || (h.v4 == nil && h.v6 == nil):
+			missing = append(missing, question{s.host, dnsmsg.TypeA}, question{s.host, dnsmsg.TypeAAAA})
+		default:
+			b.update(s, newCastEntry(s.name, s.host, s.port, h.v4, h.v6, h.zone, s.txt))
+		}
+	}
+	return missing
+}
+
+// update sends an Added or Updated event if the entry of the service has
+// changed.
+func (b *Browser) update(s *browsedService, entry CastEntry) {
+	if !s.added {
+		s.added, s.entry = true, entry
+		b.pending = append(b.pending, Event{Type: Added, Entry: entry})
+		return
+	}
+	if !entry.equal(s.entry) {
+		s.entry = entry
+		b.pending = append(b.pending, Event{Type: Updated, Entry: entry})
+	}
+}
+
+// service returns the service with the given name, creating it if needed,
+// and extends its expiry time.
+func (b *Browser) service(name string, expires time.Time) *browsedService {
+	key := strings.ToLower(name)
+	s, ok := b.services[key]
+	if !ok {
+		s = &browsedService{name: name}
+		b.services[key] = s
+	}
+	if expires.After(s.expires) {
+		s.expires = expires
+	}
+	return s
+}
+
+func (b *Browser) host(name string) *browsedHost {
+	key := strings.ToLower(name)
+	h, ok := b.hosts[key]
+	if !ok {
+		h = &browsedHost{}
+		b.hosts[key] = h
+	}
+	return h
+}
+
+func (b *Browser) servicesOnHost(host string) []*browsedService {
+	var services []*browsedService
+	for _, s := range b.services {
+		if strings.EqualFold(s.host, host) {
+			services = append(services, s)
+		}
+	}
+	return services
+}
+
+// remove forgets the service, sending a Removed event if it had been added.
+func (b *Browser) remove(name string) {
+	key := strings.ToLower(name)
+	s, ok := b.services[key]
+	if !ok {
+		return
+	}
+	delete(b.services, key)
+	if s.added {
+		b.pending = append(b.pending, Event{Type: Removed, Entry: s.entry})
+	}
+}
+
+// expire removes the services and host addresses whose records have not
+// been refreshed before their TTL ran out, and returns questions for the
+// addresses of services that have none left.
+func (b *Browser) expire(now time.Time) []question {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range b.services {
+		if now.After(s.expires) {
+			b.remove(s.name)
+		}
+	}
+
+	changed := map[*browsedService]bool{}
+	for key, h := range b.hosts {
+		expired := false
+		if h.v4 != nil && now.After(h.v4Expires) {
+			h.v4, expired = nil, true
+		}
+		if h.v6 != nil && now.After(h.v6Expires) {
+			h.v6, h.zone, expired = nil, "", true
+		}
+		if h.v4 == nil && h.v6 == nil {
+			delete(b.hosts, key)
+		}
+		if expired {
+			for _, s := range b.servicesOnHost(key) {
+				changed[s] = true
+			}
+		}
+	}
+	return b.resolve(changed)
+}
+
+// Entries returns the cast entries that are currently known, sorted by
+// device name.
+func (b *Browser) Entries() []CastEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries := make([]CastEntry, 0, len(b.services))
+	for _, s := range b.services {
+		if s.added {
+			entries = append(entries, s.entry)
+		}
+	}
+	sortEntries(entries)
+	return entries
+}
+
+func isCastService(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), "."+castService)
+}
+
+// sortEntries sorts the entries in a deterministic order.
+func sortEntries(entries []CastEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].DeviceName != entries[j].DeviceName {
+			return entries[i].DeviceName < entries[j].DeviceName
+		}
+		return entries[i].Name < entries[j].Name
+	})
+}
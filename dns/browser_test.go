@@ -0,0 +1,139 @@
+package dns_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/grasparv/go-chromecast/dns"
+	"github.com/grasparv/go-chromecast/dns/dnstest"
+)
+
+// testID returns an id that won't clash with real devices on the network.
+func testID(t *testing.T) string {
+	return fmt.Sprintf("test%x", time.Now().UnixNano())
+}
+
+func newAdvertiser(t *testing.T, services ...dnstest.Service) *dnstest.Advertiser {
+	a, err := dnstest.NewAdvertiser(nil, services...)
+	if err != nil {
+		t.Skipf("mdns is not available: %v", err)
+	}
+	return a
+}
+
+// nextEvent returns the next event for the entry with the given id, events
+// for other devices on the network are skipped.
+func nextEvent(t *testing.T, events <-chan dns.Event, id string) dns.Event {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed while waiting for %q", id)
+			}
+			if e.Entry.UUID == id {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for an event for %q", id)
+		}
+	}
+}
+
+func TestBrowserEvents(t *testing.T) {
+	id := testID(t)
+	service := dnstest.Service{ID: id, Model: "Chromecast", Name: "Living Room TV", Capabilities: dns.CapabilityVideoOut | dns.CapabilityAudioOut}
+	a := newAdvertiser(t)
+	defer a.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := dns.NewBrowser(nil, 0)
+	events, err := b.Browse(ctx)
+	if err != nil {
+		t.Skipf("mdns is not available: %v", err)
+	}
+
+	a.Set(service)
+	e := nextEvent(t, events, id)
+	if e.Type != dns.Added {
+		t.Fatalf("expected %s event, got %s", dns.Added, e.Type)
+	}
+	if e.Entry.DeviceName != "Living Room TV" || e.Entry.Device != "Chromecast" || e.Entry.GetAddr() != "127.0.0.1" || e.Entry.Port != 8009 {
+		t.Errorf("unexpected entry %+v", e.Entry)
+	}
+	if e.Entry.IsGroup() {
+		t.Errorf("expected %q to not be a group", e.Entry.DeviceName)
+	}
+
+	service.Status = "Casting: YouTube"
+	a.Set(service)
+	e = nextEvent(t, events, id)
+	if e.Type != dns.Updated || e.Entry.Status != "Casting: YouTube" {
+		t.Fatalf("expected %s event with the new status, got %s with %q", dns.Updated, e.Type, e.Entry.Status)
+	}
+
+	found := false
+	for _, entry := range b.Entries() {
+		found = found || entry.UUID == id
+	}
+	if !found {
+		t.Errorf("expected %q in the browser entries", id)
+	}
+
+	a.Remove(id)
+	e = nextEvent(t, events, id)
+	if e.Type != dns.Removed {
+		t.Fatalf("expected %s event, got %s", dns.Removed, e.Type)
+	}
+	for _, entry := range b.Entries() {
+		if entry.UUID == id {
+			t.Errorf("expected %q to not be in the browser entries", id)
+		}
+	}
+}
+
+func TestBrowserExpiry(t *testing.T) {
+	id := testID(t)
+	a := newAdvertiser(t, dnstest.Service{ID: id, Name: "Kitchen", TTL: time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := dns.NewBrowser(nil, 0).Browse(ctx)
+	if err != nil {
+		t.Skipf("mdns is not available: %v", err)
+	}
+	if e := nextEvent(t, events, id); e.Type != dns.Added {
+		t.Fatalf("expected %s event, got %s", dns.Added, e.Type)
+	}
+
+	// Without a goodbye, the entry goes away once its records expire.
+	a.Close()
+	if e := nextEvent(t, events, id); e.Type != dns.Removed {
+		t.Fatalf("expected %s event, got %s", dns.Removed, e.Type)
+	}
+}
+
+func TestMDNSResolver(t *testing.T) {
+	id := testID(t)
+	a := newAdvertiser(t, dnstest.Service{ID: id, Model: "Google Cast Group", Name: "Home group", Port: 32187, Capabilities: dns.CapabilityMultizoneGroup | dns.CapabilityAudioOut})
+	defer a.Close()
+
+	r := &dns.MDNSResolver{Timeout: 2 * time.Second}
+	entries, err := r.Resolve(context.Background())
+	if err != nil {
+		t.Skipf("mdns is not available: %v", err)
+	}
+	for _, e := range entries {
+		if e.UUID != id {
+			continue
+		}
+		if !e.IsGroup() {
+			t.Errorf("expected %q to be a group", e.DeviceName)
+		}
+		return
+	}
+	t.Errorf("expected %q in the resolved entries", id)
+}
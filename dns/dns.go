@@ -1,24 +1,15 @@
 package dns
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
+	"context"
 	"net"
-	"sort"
 	"strings"
 	"time"
-
-	"github.com/hashicorp/mdns"
 )
 
-func init() {
-	// Disable mdns annoying and verbose logging
-	log.SetOutput(ioutil.Discard)
-}
-
 const (
-	maxEntries = 20
+	// How long FindCastDNSEntries browses for.
+	findTimeout = time.Second * 3
 )
 
 // CastDNSEntry is the interface that satisfies a Cast type.
@@ -27,13 +18,16 @@ type CastDNSEntry interface {
 	GetUUID() string
 	GetAddr() string
 	GetPort() int
+	GetDevice() string
 }
 
 // CastEntry is the concrete cast entry type.
 type CastEntry struct {
 	AddrV4 net.IP
 	AddrV6 net.IP
-	Port   int
+	// Zone is the network interface a link-local AddrV6 is reachable on.
+	Zone string
+	Port int
 
 	Name string
 	Host string
@@ -43,6 +37,10 @@ type CastEntry struct {
 	Status     string
 	DeviceName string
 	InfoFields map[string]string
+
+	// MemberOf are the names or uuids of the speaker groups the entry is a
+	// member of, if known without asking the device.
+	MemberOf []string
 }
 
 // GetUUID returns a unqiue id of a cast entry.
@@ -55,9 +53,19 @@ func (e CastEntry) GetName() string {
 	return e.DeviceName
 }
 
-// GetAddr returns the IPV4 of a cast entry.
+// GetAddr returns the IPV4 of a cast entry, falling back to the IPV6 if the
+// entry has no IPV4. A link-local IPV6 includes its zone, ie: 'fe80::1%eth0'.
 func (e CastEntry) GetAddr() string {
-	return fmt.Sprintf("%s", e.AddrV4)
+	switch {
+	case e.AddrV4 != nil:
+		return e.AddrV4.String()
+	case e.AddrV6 == nil:
+		// Static entries can be configured with a host name.
+		return strings.TrimSuffix(e.Host, ".")
+	case e.Zone != "" && e.AddrV6.IsLinkLocalUnicast():
+		return e.AddrV6.String() + "%" + e.Zone
+	}
+	return e.AddrV6.String()
 }
 
 // GetPort returns the port of a cast entry.
@@ -65,45 +73,87 @@ func (e CastEntry) GetPort() int {
 	return e.Port
 }
 
-// FindCastDNSEntries returns all found cast entries.
-func FindCastDNSEntries() []CastEntry {
-	entriesCh := make(chan *mdns.ServiceEntry, maxEntries)
-	go func() {
-		// This will find any and all google products, including chromecast, home mini, etc.
-		mdns.Query(&mdns.QueryParam{
-			Service: "_googlecast._tcp",
-			Domain:  "local",
-			Timeout: time.Second * 3,
-			Entries: entriesCh,
-		})
-		close(entriesCh)
-	}()
-	entries := make([]CastEntry, 0)
-	for entry := range entriesCh {
-		infoFields := make(map[string]string, len(entry.InfoFields))
-		for _, infoField := range entry.InfoFields {
-			splitField := strings.Split(infoField, "=")
-			if len(splitField) != 2 {
-				continue
-			}
-			infoFields[splitField[0]] = splitField[1]
+// GetDevice returns the device model of a cast entry, ie: 'Chromecast Ultra'.
+func (e CastEntry) GetDevice() string {
+	return e.Device
+}
+
+// FindCastDNSEntries returns all cast entries found within a few seconds. If
+// iface is set only that network interface is searched.
+func FindCastDNSEntries(iface *net.Interface) []CastEntry {
+	entries, err := (&MDNSResolver{Iface: iface}).Resolve(context.Background())
+	if err != nil {
+		return []CastEntry{}
+	}
+	return entries
+}
+
+// newCastEntry builds a cast entry from the records of a '_googlecast._tcp'
+// service instance.
+func newCastEntry(name, host string, port int, v4, v6 net.IP, zone string, txt []string) CastEntry {
+	infoFields := make(map[string]string, len(txt))
+	for _, infoField := range txt {
+		splitField := strings.SplitN(infoField, "=", 2)
+		if len(splitField) != 2 {
+			continue
 		}
-		entries = append(entries, CastEntry{
-			AddrV4:     entry.AddrV4,
-			AddrV6:     entry.AddrV6,
-			Port:       entry.Port,
-			Name:       entry.Name,
-			Host:       entry.Host,
-			InfoFields: infoFields,
-			UUID:       infoFields["id"],
-			Device:     infoFields["md"],
-			DeviceName: infoFields["fn"],
-			Status:     infoFields["rs"],
-		})
+		infoFields[splitField[0]] = splitField[1]
 	}
+	return CastEntry{
+		AddrV4:     v4,
+		AddrV6:     v6,
+		Zone:       zone,
+		Port:       port,
+		Name:       name,
+		Host:       host,
+		InfoFields: infoFields,
+		UUID:       infoFields["id"],
+		Device:     infoFields["md"],
+		DeviceName: infoFields["fn"],
+		Status:     infoFields["rs"],
+	}
+}
 
-	// Always return entries in deterministic order.
-	sort.Slice(entries, func(i, j int) bool { return entries[i].DeviceName < entries[j].DeviceName })
+// NewStaticEntry returns a cast entry for a device that wasn't discovered,
+// addr is an IP address, optionally with a zone, or a host name. The infoFields
+// are the same as the TXT fields the device would announce.
+func NewStaticEntry(addr string, port int, infoFields map[string]string, memberOf []string) CastEntry {
+	txt := make([]string, 0, len(infoFields))
+	for k, v := range infoFields {
+		txt = append(txt, k+"="+v)
+	}
+	var host, zone string
+	var v4, v6 net.IP
+	ip := addr
+	if i := strings.LastIndex(addr, "%"); i >= 0 {
+		ip, zone = addr[:i], addr[i+1:]
+	}
+	switch parsed := net.ParseIP(ip); {
+	case parsed == nil:
+		host = addr
+	case parsed.To4() != nil:
+		v4 = parsed
+	default:
+		v6 = parsed
+	}
+	entry := newCastEntry("", host, port, v4, v6, zone, txt)
+	entry.MemberOf = memberOf
+	return entry
+}
 
-	return entries
+// equal returns whether both entries have the same address, port and
+// TXT fields.
+func (e CastEntry) equal(o CastEntry) bool {
+	if !e.AddrV4.Equal(o.AddrV4) || !e.AddrV6.Equal(o.AddrV6) || e.Zone != o.Zone || e.Port != o.Port || e.Host != o.Host {
+		return false
+	}
+	if len(e.InfoFields) != len(o.InfoFields) {
+		return false
+	}
+	for k, v := range e.InfoFields {
+		if ov, ok := o.InfoFields[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,204 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	dnsmsg "github.com/miekg/dns"
+)
+
+func TestGetAddr(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry CastEntry
+		want  string
+	}{
+		{"ipv4", CastEntry{AddrV4: net.ParseIP("192.168.0.5"), AddrV6: net.ParseIP("fe80::5"), Zone: "eth0"}, "192.168.0.5"},
+		{"ipv6 link-local", CastEntry{AddrV6: net.ParseIP("fe80::5"), Zone: "eth0"}, "fe80::5%eth0"},
+		{"ipv6 global", CastEntry{AddrV6: net.ParseIP("2001:db8::5"), Zone: "eth0"}, "2001:db8::5"},
+		{"host", CastEntry{Host: "kitchen.example.com."}, "kitchen.example.com"},
+		{"none", CastEntry{}, ""},
+	}
+	for _, test := range tests {
+		if got := test.entry.GetAddr(); got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestIsGroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry CastEntry
+		want  bool
+	}{
+		{"device", CastEntry{Port: 8009, InfoFields: map[string]string{"ca": "4101"}}, false},
+		{"group", CastEntry{Port: 32187, InfoFields: map[string]string{"ca": "2084"}}, true},
+		{"no capabilities on default port", CastEntry{Port: 8009}, false},
+		{"no capabilities on other port", CastEntry{Port: 32187}, true},
+	}
+	for _, test := range tests {
+		if got := test.entry.IsGroup(); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+// cachedEntry is a cast entry without capabilities, like the ones cached
+// by the commands.
+type cachedEntry struct {
+	device string
+	port   int
+}
+
+func (e cachedEntry) GetName() string   { return "" }
+func (e cachedEntry) GetUUID() string   { return "" }
+func (e cachedEntry) GetAddr() string   { return "10.0.0.1" }
+func (e cachedEntry) GetPort() int      { return e.port }
+func (e cachedEntry) GetDevice() string { return e.device }
+
+func TestIsGroupEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry CastDNSEntry
+		want  bool
+	}{
+		{"discovered group", CastEntry{Port: DefaultPort, InfoFields: map[string]string{"ca": "2084"}}, true},
+		{"discovered device", CastEntry{Port: 32187, InfoFields: map[string]string{"ca": "4101"}}, false},
+		{"cached group model", cachedEntry{device: "Google Cast Group", port: DefaultPort}, true},
+		{"cached group port", cachedEntry{port: 32187}, true},
+		{"cached device", cachedEntry{device: "Chromecast", port: DefaultPort}, false},
+		{"no port", cachedEntry{device: "Chromecast"}, false},
+	}
+	for _, test := range tests {
+		if got := IsGroupEntry(test.entry); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestNewStaticEntry(t *testing.T) {
+	e := NewStaticEntry("fe80::1%eth0", 8009, map[string]string{"fn": "Kitchen", "id": "abc", "md": "Google Home Mini"}, []string{"Home group"})
+	if e.GetAddr() != "fe80::1%eth0" || e.DeviceName != "Kitchen" || e.UUID != "abc" || e.Device != "Google Home Mini" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e.AddrV4 != nil {
+		t.Errorf("expected no ipv4 address, got %s", e.AddrV4)
+	}
+	if e := NewStaticEntry("kitchen.lan", 8009, nil, nil); e.GetAddr() != "kitchen.lan" {
+		t.Errorf("expected host name address, got %q", e.GetAddr())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a := newCastEntry("a", "a.local.", 8009, net.ParseIP("10.0.0.1"), nil, "", []string{"id=a", "rs="})
+	b := newCastEntry("a", "a.local.", 8009, net.ParseIP("10.0.0.1"), nil, "", []string{"rs=", "id=a"})
+	if !a.equal(b) {
+		t.Errorf("expected entries with the same fields in another order to be equal")
+	}
+	c := newCastEntry("a", "a.local.", 8009, net.ParseIP("10.0.0.1"), nil, "", []string{"id=a", "rs=Casting"})
+	if a.equal(c) {
+		t.Errorf("expected entries with a different status to not be equal")
+	}
+}
+
+func TestResolveGroupsMemberOf(t *testing.T) {
+	group := NewStaticEntry("10.0.0.1", 32187, map[string]string{"fn": "Home group", "id": "9d5a8c8b-0000", "ca": "32"}, nil)
+	byName := NewStaticEntry("10.0.0.2", 8009, map[string]string{"fn": "Kitchen"}, []string{"home group"})
+	byUUID := NewStaticEntry("10.0.0.3", 8009, map[string]string{"fn": "Bedroom"}, []string{"9D5A8C8B0000"})
+	other := NewStaticEntry("10.0.0.4", 8009, map[string]string{"fn": "Garage"}, []string{"Other group"})
+
+	groups := ResolveGroups(context.Background(), []CastEntry{byName, group, byUUID, other})
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	var members []string
+	for _, m := range groups[0].Members {
+		members = append(members, m.DeviceName)
+	}
+	if len(members) != 2 || members[0] != "Bedroom" || members[1] != "Kitchen" {
+		t.Errorf("expected members [Bedroom Kitchen], got %v", members)
+	}
+}
+
+func TestStaticResolver(t *testing.T) {
+	r := StaticResolver{{DeviceName: "Kitchen"}}
+	entries, err := r.Resolve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries[0].DeviceName = "changed"
+	if r[0].DeviceName != "Kitchen" {
+		t.Errorf("expected the resolved entries to be a copy")
+	}
+}
+
+func TestBrowserHostExpiry(t *testing.T) {
+	const (
+		service = "Kitchen-abc._googlecast._tcp.local."
+		host    = "abc.local."
+	)
+	header := func(name string, rrtype uint16, ttl time.Duration) dnsmsg.RR_Header {
+		return dnsmsg.RR_Header{Name: name, Rrtype: rrtype, Class: dnsmsg.ClassINET, Ttl: uint32(ttl / time.Second)}
+	}
+	a := func(ip string, ttl time.Duration) *dnsmsg.A {
+		return &dnsmsg.A{Hdr: header(host, dnsmsg.TypeA, ttl), A: net.ParseIP(ip)}
+	}
+	aaaa := func(ip string, ttl time.Duration) *dnsmsg.AAAA {
+		return &dnsmsg.AAAA{Hdr: header(host, dnsmsg.TypeAAAA, ttl), AAAA: net.ParseIP(ip)}
+	}
+	msg := func(records ...dnsmsg.RR) *dnsmsg.Msg {
+		return &dnsmsg.Msg{Answer: records}
+	}
+	events := func(b *Browser) []Event {
+		pending := b.pending
+		b.pending = nil
+		return pending
+	}
+	now := time.Now()
+
+	b := NewBrowser(nil, 0)
+	b.handle(msg(
+		&dnsmsg.PTR{Hdr: header(castService, dnsmsg.TypePTR, 2*time.Minute), Ptr: service},
+		&dnsmsg.SRV{Hdr: header(service, dnsmsg.TypeSRV, 2*time.Minute), Target: host, Port: 8009},
+		&dnsmsg.TXT{Hdr: header(service, dnsmsg.TypeTXT, 2*time.Minute), Txt: []string{"id=abc", "fn=Kitchen"}},
+		a("192.168.0.5", 10*time.Second),
+	), "", now)
+	if e := events(b); len(e) != 1 || e[0].Type != Added || e[0].Entry.GetAddr() != "192.168.0.5" {
+		t.Fatalf("expected the entry to be added, got %+v", e)
+	}
+
+	// The address expires before the service, so it is asked for again
+	// while the entry is kept.
+	missing := b.expire(now.Add(11 * time.Second))
+	if len(missing) != 2 || missing[0] != (question{host, dnsmsg.TypeA}) || missing[1] != (question{host, dnsmsg.TypeAAAA}) {
+		t.Errorf("expected the addresses to be asked for, got %+v", missing)
+	}
+	if e := events(b); len(e) != 0 || len(b.Entries()) != 1 {
+		t.Errorf("expected the entry to be kept, got %+v", e)
+	}
+
+	b.handle(msg(a("192.168.0.6", 10*time.Second)), "", now.Add(12*time.Second))
+	if e := events(b); len(e) != 1 || e[0].Type != Updated || e[0].Entry.GetAddr() != "192.168.0.6" {
+		t.Fatalf("expected the new address, got %+v", e)
+	}
+
+	// A goodbye removes the address straight away.
+	b.handle(msg(aaaa("fe80::6", 2*time.Minute)), "eth0", now.Add(13*time.Second))
+	events(b)
+	if missing := b.handle(msg(a("192.168.0.6", 0)), "", now.Add(14*time.Second)); len(missing) != 0 {
+		t.Errorf("expected the remaining address to be used, got %+v", missing)
+	}
+	if e := events(b); len(e) != 1 || e[0].Type != Updated || e[0].Entry.GetAddr() != "fe80::6%eth0" {
+		t.Fatalf("expected the ipv6 address, got %+v", e)
+	}
+
+	// Hosts without any addresses left are forgotten.
+	b.handle(msg(aaaa("fe80::6", 0)), "eth0", now.Add(15*time.Second))
+	b.expire(now.Add(16 * time.Second))
+	if len(b.hosts) != 0 {
+		t.Errorf("expected the host to be removed, got %+v", b.hosts)
+	}
+}
@@ -0,0 +1,213 @@
+// Package dnstest advertises synthetic cast devices with mDNS, so discovery
+// can be tested without real devices.
+package dnstest
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dnsmsg "github.com/miekg/dns"
+	"github.com/pkg/errors"
+	"golang.org/x/net/ipv4"
+)
+
+const castService = "_googlecast._tcp.local."
+
+var mdnsIPv4Addr = &net.UDPAddr{IP: net.ParseIP("224.0.0.251"), Port: 5353}
+
+// Service is a synthetic '_googlecast._tcp' service.
+type Service struct {
+	// ID, Model, Name, Status and Capabilities are announced in the 'id',
+	// 'md', 'fn', 'rs' and 'ca' TXT fields. ID must be unique.
+	ID           string
+	Model        string
+	Name         string
+	Status       string
+	Capabilities int
+
+	// IP defaults to 127.0.0.1 and Port to 8009.
+	IP   net.IP
+	Port int
+	// TTL of the records, defaults to two minutes.
+	TTL time.Duration
+}
+
+// Instance returns the mDNS service instance name of the service.
+func (s Service) Instance() string {
+	return "Chromecast-" + s.ID + "." + castService
+}
+
+func (s Service) host() string {
+	return s.ID + ".local."
+}
+
+func (s Service) ttl() uint32 {
+	if s.TTL <= 0 {
+		return 120
+	}
+	return uint32(s.TTL / time.Second)
+}
+
+func (s Service) header(name string, rrtype uint16, ttl uint32) dnsmsg.RR_Header {
+	return dnsmsg.RR_Header{Name: name, Rrtype: rrtype, Class: dnsmsg.ClassINET, Ttl: ttl}
+}
+
+func (s Service) ptr(ttl uint32) dnsmsg.RR {
+	return &dnsmsg.PTR{Hdr: s.header(castService, dnsmsg.TypePTR, ttl), Ptr: s.Instance()}
+}
+
+func (s Service) srv(ttl uint32) dnsmsg.RR {
+	port := s.Port
+	if port == 0 {
+		port = 8009
+	}
+	return &dnsmsg.SRV{Hdr: s.header(s.Instance(), dnsmsg.TypeSRV, ttl), Port: uint16(port), Target: s.host()}
+}
+
+func (s Service) txt(ttl uint32) dnsmsg.RR {
+	return &dnsmsg.TXT{Hdr: s.header(s.Instance(), dnsmsg.TypeTXT, ttl), Txt: []string{
+		"id=" + s.ID,
+		"md=" + s.Model,
+		"fn=" + s.Name,
+		"rs=" + s.Status,
+		"ca=" + strconv.Itoa(s.Capabilities),
+	}}
+}
+
+func (s Service) a(ttl uint32) dnsmsg.RR {
+	ip := s.IP
+	if ip == nil {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	return &dnsmsg.A{Hdr: s.header(s.host(), dnsmsg.TypeA, ttl), A: ip}
+}
+
+// records returns a response with all the records of the service.
+func (s Service) records(ttl uint32) *dnsmsg.Msg {
+	m := new(dnsmsg.Msg)
+	m.Response = true
+	m.Authoritative = true
+	m.Answer = []dnsmsg.RR{s.ptr(ttl)}
+	m.Extra = []dnsmsg.RR{s.srv(ttl), s.txt(ttl), s.a(ttl)}
+	return m
+}
+
+// Advertiser answers mDNS queries for its services, and announces them when
+// they are added, changed or removed.
+type Advertiser struct {
+	conn *net.UDPConn
+
+	mu       sync.Mutex
+	services map[string]Service
+}
+
+// NewAdvertiser starts advertising the services on iface, or the system
+// default interface if iface is nil.
+func NewAdvertiser(iface *net.Interface, services ...Service) (*Advertiser, error) {
+	conn, err := net.ListenMulticastUDP("udp4", iface, mdnsIPv4Addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to listen for mdns")
+	}
+	// Go turns off multicast loopback, which would hide the services from
+	// browsers on this machine.
+	if err := ipv4.NewPacketConn(conn).SetMulticastLoopback(true); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "unable to enable multicast loopback")
+	}
+	a := &Advertiser{
+		conn:     conn,
+		services: map[string]Service{},
+	}
+	go a.serve()
+	for _, s := range services {
+		a.Set(s)
+	}
+	return a, nil
+}
+
+// Set adds the service, or replaces the service with the same ID, and
+// announces it.
+func (a *Advertiser) Set(s Service) {
+	a.mu.Lock()
+	a.services[s.ID] = s
+	a.mu.Unlock()
+	a.send(s.records(s.ttl()))
+}
+
+// Remove stops advertising the service with the given ID, and sends a
+// goodbye for it.
+func (a *Advertiser) Remove(id string) {
+	a.mu.Lock()
+	s, ok := a.services[id]
+	delete(a.services, id)
+	a.mu.Unlock()
+	if ok {
+		a.send(s.records(0))
+	}
+}
+
+// Close stops advertising, without sending goodbyes, as if the devices had
+// been unplugged.
+func (a *Advertiser) Close() error {
+	return a.conn.Close()
+}
+
+func (a *Advertiser) send(m *dnsmsg.Msg) {
+	buf, err := m.Pack()
+	if err != nil {
+		return
+	}
+	a.conn.WriteToUDP(buf, mdnsIPv4Addr)
+}
+
+// serve answers queries until the advertiser is closed.
+func (a *Advertiser) serve() {
+	buf := make([]byte, 65536)
+	for {
+		n, err := a.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		query := new(dnsmsg.Msg)
+		if err := query.Unpack(buf[:n]); err != nil || query.Response {
+			continue
+		}
+		if resp := a.answer(query); resp != nil {
+			a.send(resp)
+		}
+	}
+}
+
+// answer returns the response to the query, or nil if none of the
+// questions are for the advertised services.
+func (a *Advertiser) answer(query *dnsmsg.Msg) *dnsmsg.Msg {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	resp := new(dnsmsg.Msg)
+	resp.Response = true
+	resp.Authoritative = true
+	for _, q := range query.Question {
+		for _, s := range a.services {
+			ttl := s.ttl()
+			switch {
+			case q.Qtype == dnsmsg.TypePTR && strings.EqualFold(q.Name, castService):
+				resp.Answer = append(resp.Answer, s.ptr(ttl))
+				resp.Extra = append(resp.Extra, s.srv(ttl), s.txt(ttl), s.a(ttl))
+			case q.Qtype == dnsmsg.TypeSRV && strings.EqualFold(q.Name, s.Instance()):
+				resp.Answer = append(resp.Answer, s.srv(ttl))
+			case q.Qtype == dnsmsg.TypeTXT && strings.EqualFold(q.Name, s.Instance()):
+				resp.Answer = append(resp.Answer, s.txt(ttl))
+			case q.Qtype == dnsmsg.TypeA && strings.EqualFold(q.Name, s.host()):
+				resp.Answer = append(resp.Answer, s.a(ttl))
+			}
+		}
+	}
+	if len(resp.Answer) == 0 {
+		return nil
+	}
+	return resp
+}
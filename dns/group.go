@@ -0,0 +1,194 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Bits of the 'ca' TXT field, which lists the capabilities of a cast entry.
+const (
+	CapabilityVideoOut       = 1 << 0
+	CapabilityVideoIn        = 1 << 1
+	CapabilityAudioOut       = 1 << 2
+	CapabilityAudioIn        = 1 << 3
+	CapabilityDevMode        = 1 << 4
+	CapabilityMultizoneGroup = 1 << 5
+)
+
+const (
+	// DefaultPort is the port cast devices listen on, groups are hosted by
+	// their leader on another port.
+	DefaultPort = 8009
+
+	// Ports of the local setup api, newer firmware only serves it over https.
+	setupHTTPPort  = 8008
+	setupHTTPSPort = 8443
+
+	setupTimeout = time.Second * 3
+
+	// groupModel is the model that speaker groups announce.
+	groupModel = "Google Cast Group"
+)
+
+// Capabilities returns the 'ca' bits of the entry, and whether they were set.
+func (e CastEntry) Capabilities() (int, bool) {
+	ca, err := strconv.Atoi(e.InfoFields["ca"])
+	return ca, err == nil
+}
+
+// IsGroup returns whether the entry is a speaker group rather than a single
+// device. Entries without capabilities are groups if they aren't on the
+// default port.
+func (e CastEntry) IsGroup() bool {
+	if ca, ok := e.Capabilities(); ok {
+		return ca&CapabilityMultizoneGroup != 0
+	}
+	return e.Port != 0 && e.Port != DefaultPort
+}
+
+// IsGroupEntry returns whether the entry is a speaker group. Entries that
+// weren't discovered, ie: cached ones, have no capabilities, so their model
+// and port are used instead.
+func IsGroupEntry(entry CastDNSEntry) bool {
+	if e, ok := entry.(CastEntry); ok {
+		return e.IsGroup()
+	}
+	return entry.GetDevice() == groupModel || (entry.GetPort() != 0 && entry.GetPort() != DefaultPort)
+}
+
+// Group is a speaker group and the devices that are members of it.
+type Group struct {
+	Entry   CastEntry
+	Members []CastEntry
+}
+
+// eurekaInfo is the part of the setup api 'eureka_info' response listing the
+// groups a device is a member of.
+type eurekaInfo struct {
+	Multizone struct {
+		Groups []struct {
+			Name string `json:"name"`
+			UUID string `json:"uuid"`
+		} `json:"groups"`
+	} `json:"multizone"`
+}
+
+// ResolveGroups returns the groups in entries with their members. Membership
+// is taken from MemberOf if it is set, otherwise it is asked from the local
+// setup api of each device, devices that don't answer are left out. Groups
+// are in the same order as in entries.
+func ResolveGroups(ctx context.Context, entries []CastEntry) []Group {
+	var groups []Group
+	index := map[string]int{}
+	for _, e := range entries {
+		if e.IsGroup() {
+			if e.UUID != "" {
+				index[normaliseUUID(e.UUID)] = len(groups)
+			}
+			index[strings.ToLower(e.DeviceName)] = len(groups)
+			groups = append(groups, Group{Entry: e})
+		}
+	}
+	if len(groups) == 0 {
+		return groups
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		if e.IsGroup() {
+			continue
+		}
+		wg.Add(1)
+		go func(e CastEntry) {
+			defer wg.Done()
+			memberOf := e.MemberOf
+			if len(memberOf) == 0 {
+				var err error
+				if memberOf, err = setupMemberOf(ctx, e); err != nil {
+					return
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, g := range memberOf {
+				if i, ok := index[normaliseUUID(g)]; ok {
+					groups[i].Members = append(groups[i].Members, e)
+				} else if i, ok := index[strings.ToLower(g)]; ok {
+					groups[i].Members = append(groups[i].Members, e)
+				}
+			}
+		}(e)
+	}
+	wg.Wait()
+
+	for _, g := range groups {
+		sortEntries(g.Members)
+	}
+	return groups
+}
+
+// setupMemberOf returns the uuids of the groups the device is a member of,
+// from its setup api.
+func setupMemberOf(ctx context.Context, e CastEntry) ([]string, error) {
+	client := &http.Client{
+		Timeout: setupTimeout,
+		Transport: &http.Transport{
+			// Devices use a self-signed certificate.
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+
+	var err error
+	for _, u := range []string{
+		fmt.Sprintf("http://%s/setup/eureka_info?params=multizone", net.JoinHostPort(e.GetAddr(), strconv.Itoa(setupHTTPPort))),
+		fmt.Sprintf("https://%s/setup/eureka_info?params=multizone", net.JoinHostPort(e.GetAddr(), strconv.Itoa(setupHTTPSPort))),
+	} {
+		var info eurekaInfo
+		if info, err = getEurekaInfo(ctx, client, u); err != nil {
+			continue
+		}
+		uuids := make([]string, len(info.Multizone.Groups))
+		for i, g := range info.Multizone.Groups {
+			uuids[i] = g.UUID
+		}
+		return uuids, nil
+	}
+	return nil, err
+}
+
+func getEurekaInfo(ctx context.Context, client *http.Client, u string) (eurekaInfo, error) {
+	var info eurekaInfo
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return info, err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return info, errors.Wrapf(err, "unable to get %q", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("unable to get %q: %s", u, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return info, errors.Wrapf(err, "unable to decode %q", u)
+	}
+	return info, nil
+}
+
+// normaliseUUID makes the uuids from mDNS, which have no dashes, comparable
+// with the ones from the setup api.
+func normaliseUUID(uuid string) string {
+	return strings.ToLower(strings.Replace(uuid, "-", "", -1))
+}
@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Resolver finds cast entries. Discovery is done through a Resolver so that
+// it can be replaced, ie: in tests where there are no real devices.
+type Resolver interface {
+	Resolve(ctx context.Context) ([]CastEntry, error)
+}
+
+// MDNSResolver finds cast entries with mDNS.
+type MDNSResolver struct {
+	// Iface is the network interface to browse, nil for the system default.
+	Iface *net.Interface
+	// Timeout is how long to browse for, 0 uses the default of a few seconds.
+	Timeout time.Duration
+}
+
+// Resolve browses for cast entries until the timeout or ctx is done.
+func (r *MDNSResolver) Resolve(ctx context.Context) ([]CastEntry, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = findTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	b := NewBrowser(r.Iface, 0)
+	events, err := b.Browse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for range events {
+	}
+	return b.Entries(), nil
+}
+
+// UnicastResolver finds cast entries with unicast DNS-SD, see
+// LookupCastEntries.
+type UnicastResolver struct {
+	Server string
+	Domain string
+}
+
+// Resolve asks the DNS server for the cast entries in the domain.
+func (r *UnicastResolver) Resolve(ctx context.Context) ([]CastEntry, error) {
+	return LookupCastEntries(ctx, r.Server, r.Domain)
+}
+
+// StaticResolver always resolves to the same cast entries.
+type StaticResolver []CastEntry
+
+// Resolve returns a copy of the entries.
+func (r StaticResolver) Resolve(ctx context.Context) ([]CastEntry, error) {
+	entries := make([]CastEntry, len(r))
+	copy(entries, r)
+	return entries, nil
+}
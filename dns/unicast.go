@@ -0,0 +1,114 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	dnsmsg "github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// LookupCastEntries finds cast devices with unicast DNS-SD, by asking server
+// for the '_googlecast._tcp' services in domain, ie: 'office.example.com'.
+// This works on networks where multicast doesn't, as long as the devices are
+// registered with the DNS server. The server defaults to port 53.
+func LookupCastEntries(ctx context.Context, server, domain string) ([]CastEntry, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	r := &unicastResolver{client: &dnsmsg.Client{}, server: server}
+
+	service := "_googlecast._tcp." + dnsmsg.Fqdn(domain)
+	ptrs, err := r.lookup(ctx, service, dnsmsg.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []CastEntry{}
+	for _, rr := range ptrs {
+		ptr, ok := rr.(*dnsmsg.PTR)
+		if !ok {
+			continue
+		}
+		entry, err := r.resolve(ctx, ptr.Ptr)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+type unicastResolver struct {
+	client *dnsmsg.Client
+	server string
+}
+
+// resolve looks up the SRV, TXT and address records of a service instance.
+func (r *unicastResolver) resolve(ctx context.Context, name string) (CastEntry, error) {
+	srvs, err := r.lookup(ctx, name, dnsmsg.TypeSRV)
+	if err != nil {
+		return CastEntry{}, err
+	}
+	var srv *dnsmsg.SRV
+	for _, rr := range srvs {
+		if s, ok := rr.(*dnsmsg.SRV); ok {
+			srv = s
+			break
+		}
+	}
+	if srv == nil {
+		return CastEntry{}, errors.Errorf("no SRV record for %q", name)
+	}
+
+	var txt []string
+	if txts, err := r.lookup(ctx, name, dnsmsg.TypeTXT); err == nil {
+		for _, rr := range txts {
+			if t, ok := rr.(*dnsmsg.TXT); ok {
+				txt = append(txt, t.Txt...)
+			}
+		}
+	}
+
+	var v4, v6 net.IP
+	if as, err := r.lookup(ctx, srv.Target, dnsmsg.TypeA); err == nil {
+		for _, rr := range as {
+			if a, ok := rr.(*dnsmsg.A); ok {
+				v4 = a.A
+				break
+			}
+		}
+	}
+	if v4 == nil {
+		if aaaas, err := r.lookup(ctx, srv.Target, dnsmsg.TypeAAAA); err == nil {
+			for _, rr := range aaaas {
+				if a, ok := rr.(*dnsmsg.AAAA); ok {
+					v6 = a.AAAA
+					break
+				}
+			}
+		}
+	}
+	host := srv.Target
+	if v4 == nil && v6 == nil {
+		// Leave resolving the host to the system resolver when dialing.
+		host = strings.TrimSuffix(host, ".")
+	}
+	return newCastEntry(name, host, int(srv.Port), v4, v6, "", txt), nil
+}
+
+// lookup returns the answers of the given type for name.
+func (r *unicastResolver) lookup(ctx context.Context, name string, qtype uint16) ([]dnsmsg.RR, error) {
+	m := new(dnsmsg.Msg)
+	m.SetQuestion(dnsmsg.Fqdn(name), qtype)
+	resp, _, err := r.client.ExchangeContext(ctx, m, r.server)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query %q for %q", r.server, name)
+	}
+	if resp.Rcode != dnsmsg.RcodeSuccess {
+		return nil, errors.Errorf("unable to query %q for %q: %s", r.server, name, dnsmsg.RcodeToString[resp.Rcode])
+	}
+	return resp.Answer, nil
+}
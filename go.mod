@@ -6,15 +6,19 @@ require (
 	cloud.google.com/go v0.46.3
 	github.com/buger/jsonparser v0.0.0-20191004114745-ee4c978eae7e
 	github.com/gogo/protobuf v1.3.0
-	github.com/hashicorp/mdns v1.0.1
+	github.com/hashicorp/mdns v1.0.1 // indirect
 	github.com/jroimartin/gocui v0.4.0
+	github.com/miekg/dns v1.0.14
 	github.com/mitchellh/go-homedir v1.1.0
-	github.com/nsf/termbox-go v0.0.0-20190817171036-93860e161317
+	github.com/nsf/termbox-go v0.0.0-20190817171036-93860e161317 // indirect
 	github.com/pkg/errors v0.8.1
 	github.com/rogpeppe/go-internal v1.5.0
 	github.com/sirupsen/logrus v1.4.0
 	github.com/spf13/cobra v0.0.3
 	github.com/vishen/go-chromecast v0.0.14
+	go.etcd.io/bbolt v1.3.5
+	golang.org/x/crypto v0.0.0-20190605123033-f99c8df09eb5
+	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
 	google.golang.org/api v0.9.0
 	google.golang.org/genproto v0.0.0-20190911173649-1774047e7e51
 )
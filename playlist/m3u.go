@@ -0,0 +1,74 @@
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseM3U parses M3U and extended M3U playlists, '#EXTINF:<seconds>,<title>'
+// lines set the duration and title of the location that follows.
+func parseM3U(b []byte) ([]Entry, error) {
+	var entries []Entry
+	var pending Entry
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		// Strip the UTF-8 byte order mark that some players write.
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			pending = parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+		case strings.HasPrefix(line, "#"):
+			// Comments and unsupported directives.
+		default:
+			pending.Location = line
+			entries = append(entries, pending)
+			pending = Entry{}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// parseExtInf parses the value of an '#EXTINF' line, ie: '123 tvg-id="x",Title'.
+func parseExtInf(value string) Entry {
+	var e Entry
+	parts := strings.SplitN(value, ",", 2)
+	if len(parts) == 2 {
+		e.Title = strings.TrimSpace(parts[1])
+	}
+	// The duration can be followed by attributes.
+	fields := strings.Fields(parts[0])
+	if len(fields) > 0 {
+		if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil && seconds > 0 {
+			e.Duration = time.Duration(seconds * float64(time.Second))
+		}
+	}
+	return e
+}
+
+// WriteM3U writes the entries as an extended M3U playlist.
+func WriteM3U(w io.Writer, entries []Entry) error {
+	if _, err := fmt.Fprintln(w, "#EXTM3U"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Title != "" || e.Duration > 0 {
+			seconds := -1
+			if e.Duration > 0 {
+				seconds = int(e.Duration.Seconds())
+			}
+			if _, err := fmt.Fprintf(w, "#EXTINF:%d,%s\n", seconds, e.Title); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, e.Location); err != nil {
+			return err
+		}
+	}
+	return nil
+}
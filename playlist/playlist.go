@@ -0,0 +1,115 @@
+// Package playlist reads M3U, PLS and XSPF playlist files, and writes
+// M3U playlists.
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Entry is a single item in a playlist.
+type Entry struct {
+	// Location is either an absolute path to a local file or a url.
+	Location string
+	Title    string
+	// Duration is zero if unknown.
+	Duration time.Duration
+}
+
+// IsPlaylistFile returns whether the file is a playlist that can be parsed.
+// M3U8 files that are HLS media playlists, rather than a list of media
+// files, are not considered playlist files.
+func IsPlaylistFile(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".m3u", ".pls", ".xspf":
+		return true
+	case ".m3u8":
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return false
+		}
+		return !isHLS(b)
+	}
+	return false
+}
+
+// isHLS returns whether the playlist contains HLS tags.
+func isHLS(b []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), "#EXT-X-") {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads the playlist file, the format is determined by the file
+// extension. Relative locations are resolved against the directory of
+// the playlist file.
+func Parse(filename string) ([]Entry, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read playlist %q", filename)
+	}
+
+	var entries []Entry
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".m3u", ".m3u8":
+		entries, err = parseM3U(b)
+	case ".pls":
+		entries, err = parsePLS(b)
+	case ".xspf":
+		entries, err = parseXSPF(b)
+	default:
+		return nil, errors.Errorf("unknown playlist format %q", ext)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse playlist %q", filename)
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to find playlist directory")
+	}
+	for i := range entries {
+		entries[i].Location = resolveLocation(dir, entries[i].Location)
+	}
+	return entries, nil
+}
+
+// resolveLocation turns a playlist location into an absolute path or a url.
+func resolveLocation(dir, location string) string {
+	if u, err := url.Parse(location); err == nil {
+		switch u.Scheme {
+		case "http", "https":
+			return location
+		case "file":
+			location = u.Path
+		}
+	}
+	// Playlists written on windows use backslashes.
+	if filepath.Separator == '/' {
+		location = strings.Replace(location, `\`, "/", -1)
+	}
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(dir, location)
+	}
+	return filepath.Clean(location)
+}
+
+// Locations returns the location of each entry.
+func Locations(entries []Entry) []string {
+	locations := make([]string, len(entries))
+	for i, e := range entries {
+		locations[i] = e.Location
+	}
+	return locations
+}
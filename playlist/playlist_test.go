@@ -0,0 +1,186 @@
+package playlist
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast-playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := func(elem ...string) string {
+		return filepath.Join(append([]string{dir}, elem...)...)
+	}
+	tests := []struct {
+		filename string
+		contents string
+		want     []Entry
+	}{
+		{
+			filename: "plain.m3u",
+			contents: "\ufeffsong1.mp3\r\n# a comment\r\n\r\nsub/song2.flac\r\n../up.mp3\r\n",
+			want: []Entry{
+				{Location: local("song1.mp3")},
+				{Location: local("sub", "song2.flac")},
+				{Location: filepath.Join(filepath.Dir(dir), "up.mp3")},
+			},
+		},
+		{
+			filename: "extended.m3u8",
+			contents: `#EXTM3U
+#EXTINF:215,Artist - Song
+song1.mp3
+#EXTINF:-1 tvg-id="radio" tvg-logo="logo.png",Radio, live
+http://radio.example.com/stream?format=mp3
+#EXTINF:12.5,
+/music/absolute.ogg
+file:///music/file%20url.mp3
+sub\windows.mp3
+`,
+			want: []Entry{
+				{Location: local("song1.mp3"), Title: "Artist - Song", Duration: 215 * time.Second},
+				{Location: "http://radio.example.com/stream?format=mp3", Title: "Radio, live"},
+				{Location: "/music/absolute.ogg", Duration: 12500 * time.Millisecond},
+				{Location: "/music/file url.mp3"},
+				{Location: local("sub", "windows.mp3")},
+			},
+		},
+		{
+			filename: "radio.pls",
+			contents: `[playlist]
+NumberOfEntries=3
+File2=https://example.com/podcast.mp3
+Title2=Podcast
+Length2=-1
+File1=song1.mp3
+Title1=Song One
+Length1=180
+Title3=No file
+Version=2
+`,
+			want: []Entry{
+				{Location: local("song1.mp3"), Title: "Song One", Duration: 180 * time.Second},
+				{Location: "https://example.com/podcast.mp3", Title: "Podcast"},
+			},
+		},
+		{
+			filename: "mixed.xspf",
+			contents: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track>
+      <location>song1.mp3</location>
+      <location>http://mirror.example.com/song1.mp3</location>
+      <title>Song One</title>
+      <duration>180500</duration>
+    </track>
+    <track><title>No location</title></track>
+    <track>
+      <location> http://example.com/stream.ogg </location>
+    </track>
+    <track><location>file:///music/absolute.flac</location></track>
+    <track><location>sub/My%20Song%23%201.mp3</location></track>
+  </trackList>
+</playlist>`,
+			want: []Entry{
+				{Location: local("song1.mp3"), Title: "Song One", Duration: 180500 * time.Millisecond},
+				{Location: "http://example.com/stream.ogg"},
+				{Location: "/music/absolute.flac"},
+				{Location: local("sub", "My Song# 1.mp3")},
+			},
+		},
+	}
+	for _, test := range tests {
+		filename := local(test.filename)
+		if err := ioutil.WriteFile(filename, []byte(test.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(filename)
+		if err != nil {
+			t.Errorf("%s: %v", test.filename, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %+v, got %+v", test.filename, test.want, got)
+		}
+	}
+
+	if _, err := Parse(local("missing.m3u")); err == nil {
+		t.Errorf("expected an error for a missing playlist")
+	}
+	bad := local("bad.xspf")
+	ioutil.WriteFile(bad, []byte("<playlist><trackList>"), 0644)
+	if _, err := Parse(bad); err == nil {
+		t.Errorf("expected an error for invalid XSPF")
+	}
+}
+
+func TestIsPlaylistFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast-playlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"songs.m3u8": "#EXTM3U\n#EXTINF:10,Song\nsong.mp3\n",
+		"video.m3u8": "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\nsegment0.ts\n",
+	}
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := map[string]bool{
+		"songs.m3u8":   true,
+		"video.m3u8":   false,
+		"list.M3U":     true,
+		"radio.pls":    true,
+		"mixed.xspf":   true,
+		"song.mp3":     false,
+		"missing.m3u8": false,
+	}
+	for name, want := range tests {
+		if got := IsPlaylistFile(filepath.Join(dir, name)); got != want {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestWriteM3U(t *testing.T) {
+	var b bytes.Buffer
+	entries := []Entry{
+		{Location: "/music/song1.mp3", Title: "Song One", Duration: 180 * time.Second},
+		{Location: "http://example.com/stream.mp3", Title: "Stream"},
+		{Location: "/music/untitled.mp3"},
+	}
+	if err := WriteM3U(&b, entries); err != nil {
+		t.Fatal(err)
+	}
+	want := "#EXTM3U\n#EXTINF:180,Song One\n/music/song1.mp3\n#EXTINF:-1,Stream\nhttp://example.com/stream.mp3\n/music/untitled.mp3\n"
+	if b.String() != want {
+		t.Errorf("expected %q, got %q", want, b.String())
+	}
+
+	// What is written reads back the same.
+	got, err := parseM3U(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, entries) {
+		t.Errorf("expected %+v, got %+v", entries, got)
+	}
+}
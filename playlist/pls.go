@@ -0,0 +1,70 @@
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parsePLS parses PLS playlists, which are INI files with numbered
+// 'FileN', 'TitleN' and 'LengthN' keys.
+func parsePLS(b []byte) ([]Entry, error) {
+	byIndex := map[int]*Entry{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := strings.ToLower(strings.TrimSpace(parts[0])), strings.TrimSpace(parts[1])
+
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if err != nil {
+			continue
+		}
+		e, ok := byIndex[index]
+		if !ok {
+			e = &Entry{}
+			byIndex[index] = e
+		}
+		switch field {
+		case "file":
+			e.Location = value
+		case "title":
+			e.Title = value
+		case "length":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				e.Duration = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	indexes := make([]int, 0, len(byIndex))
+	for i, e := range byIndex {
+		if e.Location != "" {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	entries := make([]Entry, len(indexes))
+	for i, index := range indexes {
+		entries[i] = *byIndex[index]
+	}
+	return entries, nil
+}
@@ -0,0 +1,43 @@
+package playlist
+
+import (
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type xspfPlaylist struct {
+	Tracks []struct {
+		Locations []string `xml:"location"`
+		Title     string   `xml:"title"`
+		// Duration is in milliseconds.
+		Duration int64 `xml:"duration"`
+	} `xml:"trackList>track"`
+}
+
+// parseXSPF parses XSPF playlists, only the first location of each
+// track is used. Locations are URIs, so relative ones are unescaped into
+// a path here, unlike the paths in M3U and PLS playlists.
+func parseXSPF(b []byte) ([]Entry, error) {
+	var p xspfPlaylist
+	if err := xml.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(p.Tracks))
+	for _, t := range p.Tracks {
+		if len(t.Locations) == 0 {
+			continue
+		}
+		location := strings.TrimSpace(t.Locations[0])
+		if u, err := url.Parse(location); err == nil && u.Scheme == "" {
+			location = u.Path
+		}
+		entries = append(entries, Entry{
+			Location: location,
+			Title:    strings.TrimSpace(t.Title),
+			Duration: time.Duration(t.Duration) * time.Millisecond,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,133 @@
+package probe
+
+import "strings"
+
+// Capabilities describes what a cast device model is able to play.
+type Capabilities struct {
+	// Video is false for audio-only devices, ie: Google Home.
+	Video       bool
+	MaxWidth    int
+	MaxHeight   int
+	VideoCodecs []string
+	// H264Level is the maximum h264 level multiplied by 10, as reported by
+	// ffprobe, ie: 41 for level 4.1.
+	H264Level   int
+	AudioCodecs []string
+	MaxChannels int
+	Containers  []string
+}
+
+var (
+	audioOnlyCapabilities = Capabilities{
+		Video:       false,
+		AudioCodecs: []string{"aac", "mp3", "flac", "vorbis", "opus", "pcm_s16le", "pcm_s24le"},
+		MaxChannels: 2,
+		Containers:  []string{"mp4", "webm", "mp3", "flac", "wav", "ogg", "aac"},
+	}
+
+	chromecastCapabilities = Capabilities{
+		Video:       true,
+		MaxWidth:    1920,
+		MaxHeight:   1080,
+		VideoCodecs: []string{"h264", "vp8"},
+		H264Level:   41,
+		AudioCodecs: []string{"aac", "mp3", "flac", "vorbis", "opus", "pcm_s16le", "pcm_s24le"},
+		MaxChannels: 2,
+		Containers:  []string{"mp4", "webm", "mp3", "flac", "wav", "ogg", "aac"},
+	}
+
+	chromecast4KCapabilities = Capabilities{
+		Video:       true,
+		MaxWidth:    3840,
+		MaxHeight:   2160,
+		VideoCodecs: []string{"h264", "hevc", "vp8", "vp9"},
+		H264Level:   42,
+		AudioCodecs: []string{"aac", "mp3", "flac", "vorbis", "opus", "ac3", "eac3", "pcm_s16le", "pcm_s24le"},
+		MaxChannels: 6,
+		Containers:  []string{"mp4", "webm", "mp3", "flac", "wav", "ogg", "aac"},
+	}
+
+	smartDisplayCapabilities = Capabilities{
+		Video:       true,
+		MaxWidth:    1280,
+		MaxHeight:   720,
+		VideoCodecs: []string{"h264", "vp8", "vp9"},
+		H264Level:   41,
+		AudioCodecs: []string{"aac", "mp3", "flac", "vorbis", "opus", "pcm_s16le", "pcm_s24le"},
+		MaxChannels: 2,
+		Containers:  []string{"mp4", "webm", "mp3", "flac", "wav", "ogg", "aac"},
+	}
+
+	// Capabilities for known device models, keyed on the 'md' mDNS field.
+	modelCapabilities = map[string]Capabilities{
+		"Chromecast":          chromecastCapabilities,
+		"Chromecast HD":       chromecastCapabilities,
+		"Chromecast Ultra":    chromecast4KCapabilities,
+		"Google TV":           chromecast4KCapabilities,
+		"Google Nest Hub":     smartDisplayCapabilities,
+		"Google Nest Hub Max": smartDisplayCapabilities,
+		"Google Home Hub":     smartDisplayCapabilities,
+		"Chromecast Audio":    audioOnlyCapabilities,
+		"Google Home":         audioOnlyCapabilities,
+		"Google Home Mini":    audioOnlyCapabilities,
+		"Google Home Max":     audioOnlyCapabilities,
+		"Google Nest Mini":    audioOnlyCapabilities,
+		"Google Nest Audio":   audioOnlyCapabilities,
+		"Google Cast Group":   audioOnlyCapabilities,
+	}
+)
+
+// CapabilitiesForModel returns the capabilities for a device model. Unknown
+// models are treated as a regular Chromecast, which is the lowest common
+// denominator for video devices.
+func CapabilitiesForModel(model string) Capabilities {
+	if c, ok := modelCapabilities[model]; ok {
+		return c
+	}
+
+	// Third party devices usually include a recognisable name in the model.
+	lower := strings.ToLower(model)
+	switch {
+	case strings.Contains(lower, "audio"), strings.Contains(lower, "speaker"), strings.Contains(lower, "group"):
+		return audioOnlyCapabilities
+	case strings.Contains(lower, "4k"), strings.Contains(lower, "tv"):
+		return chromecast4KCapabilities
+	}
+	return chromecastCapabilities
+}
+
+func (c Capabilities) supportsVideo(s *Stream) bool {
+	if !c.Video || !contains(c.VideoCodecs, s.CodecName) {
+		return false
+	}
+	if s.Width > c.MaxWidth || s.Height > c.MaxHeight {
+		return false
+	}
+	if s.CodecName == "h264" {
+		// 10 bit and 4:2:2 / 4:4:4 profiles aren't supported by any device.
+		if strings.HasPrefix(s.Profile, "High 10") || strings.HasPrefix(s.Profile, "High 4:") {
+			return false
+		}
+		if s.Level > c.H264Level {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Capabilities) supportsAudio(s *Stream) bool {
+	return contains(c.AudioCodecs, s.CodecName) && s.Channels <= c.MaxChannels
+}
+
+func (c Capabilities) supportsContainer(container string) bool {
+	return contains(c.Containers, container)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
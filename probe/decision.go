@@ -0,0 +1,57 @@
+package probe
+
+// Decision is how a media file should be prepared before it is served
+// to a cast device.
+type Decision int
+
+const (
+	// DirectPlay serves the file as-is.
+	DirectPlay Decision = iota
+	// Remux copies the audio and video streams into a container that the
+	// device supports, ie: mkv to mp4.
+	Remux
+	// TranscodeAudio copies the video stream and transcodes the audio.
+	TranscodeAudio
+	// TranscodeFull transcodes both the audio and video streams.
+	TranscodeFull
+)
+
+func (d Decision) String() string {
+	switch d {
+	case DirectPlay:
+		return "direct play"
+	case Remux:
+		return "remux"
+	case TranscodeAudio:
+		return "audio transcode"
+	case TranscodeFull:
+		return "full transcode"
+	}
+	return "unknown"
+}
+
+// Decide compares the probed media against the device capabilities and
+// returns the cheapest way of making the media playable.
+func Decide(info *MediaInfo, caps Capabilities) Decision {
+	videoOK := info.Video == nil || caps.supportsVideo(info.Video)
+	audioOK := info.Audio == nil || caps.supportsAudio(info.Audio)
+
+	// Audio-only devices can't play video at all, the video stream has
+	// to be dropped which means transcoding.
+	if info.Video != nil && !caps.Video {
+		return TranscodeFull
+	}
+
+	switch {
+	case !videoOK:
+		return TranscodeFull
+	case !audioOK:
+		if info.Video == nil {
+			return TranscodeFull
+		}
+		return TranscodeAudio
+	case !caps.supportsContainer(info.Container):
+		return Remux
+	}
+	return DirectPlay
+}
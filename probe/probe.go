@@ -0,0 +1,186 @@
+// Package probe inspects media files with ffprobe and decides how a
+// cast device is able to play them.
+package probe
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Stream is a single audio or video stream in a media file.
+type Stream struct {
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	Profile   string `json:"profile"`
+	Level     int    `json:"level"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Channels  int    `json:"channels"`
+
+	Tags map[string]string `json:"tags"`
+}
+
+// MediaInfo is the result of probing a media file.
+type MediaInfo struct {
+	Filename string
+	// Container is the normalised container of the file, ie: mp4, webm, mkv, mp3.
+	Container string
+	Duration  float64
+	Video     *Stream
+	Audio     *Stream
+	// Tags are the metadata tags of the file, ie: 'title' or 'track'. The
+	// keys are lowercase.
+	Tags map[string]string
+}
+
+type ffprobeOutput struct {
+	Streams []Stream `json:"streams"`
+	Format  struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// Probe runs ffprobe against filename and returns what was found. Only the
+// first audio and video stream are taken into account, this is what ffmpeg
+// will pick by default when transcoding. Any inputArgs are passed to ffprobe
+// before the filename, ie: '-headers' when probing a url.
+func Probe(filename string, inputArgs ...string) (*MediaInfo, error) {
+	args := []string{
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+	}
+	args = append(args, inputArgs...)
+	args = append(args, filename)
+	out, err := exec.Command("ffprobe", args...).Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to probe %q", filename)
+	}
+
+	var output ffprobeOutput
+	if err := json.Unmarshal(out, &output); err != nil {
+		return nil, errors.Wrap(err, "unable to unmarshal ffprobe output")
+	}
+
+	info := &MediaInfo{
+		Filename:  filename,
+		Container: normaliseContainer(output.Format.FormatName, filename),
+	}
+	info.Duration, _ = strconv.ParseFloat(output.Format.Duration, 64)
+	for i := range output.Streams {
+		s := output.Streams[i]
+		switch s.CodecType {
+		case "video":
+			// Cover art in audio files shows up as a video stream.
+			if info.Video == nil && !isAttachedPicture(s) {
+				info.Video = &s
+			}
+		case "audio":
+			if info.Audio == nil {
+				info.Audio = &s
+			}
+		}
+	}
+	// Ogg files keep their tags on the audio stream rather than the container.
+	info.Tags = map[string]string{}
+	if info.Audio != nil {
+		for k, v := range info.Audio.Tags {
+			info.Tags[strings.ToLower(k)] = v
+		}
+	}
+	for k, v := range output.Format.Tags {
+		info.Tags[strings.ToLower(k)] = v
+	}
+	return info, nil
+}
+
+// Track returns the track number from the tags, or 0 if there isn't one.
+func (m *MediaInfo) Track() int {
+	return tagNumber(m.Tags, "track", "tracknumber")
+}
+
+// Disc returns the disc number from the tags, or 0 if there isn't one.
+func (m *MediaInfo) Disc() int {
+	return tagNumber(m.Tags, "disc", "discnumber")
+}
+
+// tagNumber returns the number in the first of the tags that is set, the
+// value can be a fraction like '3/12'.
+func tagNumber(tags map[string]string, names ...string) int {
+	for _, name := range names {
+		value, ok := tags[name]
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.SplitN(value, "/", 2)[0])
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// ContentType returns the content-type the cast device expects for the
+// media when it is played directly, or an empty string if unknown.
+func (m *MediaInfo) ContentType() string {
+	switch m.Container {
+	case "mp4":
+		if m.Video == nil {
+			return "audio/mp4"
+		}
+		return "video/mp4"
+	case "webm":
+		if m.Video == nil {
+			return "audio/webm"
+		}
+		return "video/webm"
+	case "mp3":
+		return "audio/mp3"
+	case "flac":
+		return "audio/flac"
+	case "wav":
+		return "audio/wav"
+	case "ogg":
+		return "audio/ogg"
+	case "aac":
+		return "audio/aac"
+	}
+	return ""
+}
+
+func isAttachedPicture(s Stream) bool {
+	switch s.CodecName {
+	case "mjpeg", "png", "bmp", "gif":
+		return true
+	}
+	return false
+}
+
+// normaliseContainer turns the ffprobe format name, which can be a comma
+// separated list, into a single container name.
+func normaliseContainer(formatName, filename string) string {
+	for _, f := range strings.Split(formatName, ",") {
+		switch f {
+		case "mov", "mp4", "m4a":
+			return "mp4"
+		case "matroska", "webm":
+			// ffprobe reports the same format for both, so fall back to the
+			// file extension to tell them apart.
+			if strings.ToLower(filepath.Ext(filename)) == ".webm" {
+				return "webm"
+			}
+			return "mkv"
+		case "mp3", "flac", "wav", "ogg", "aac", "avi", "mpegts":
+			return f
+		}
+	}
+	return formatName
+}
@@ -0,0 +1,117 @@
+package probe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecide(t *testing.T) {
+	h264 := &Stream{CodecType: "video", CodecName: "h264", Profile: "High", Level: 40, Width: 1920, Height: 1080}
+	aac := &Stream{CodecType: "audio", CodecName: "aac", Channels: 2}
+	chromecast := CapabilitiesForModel("Chromecast")
+	ultra := CapabilitiesForModel("Chromecast Ultra")
+	speaker := CapabilitiesForModel("Google Home")
+
+	with := func(s *Stream, f func(s *Stream)) *Stream {
+		c := *s
+		f(&c)
+		return &c
+	}
+	tests := []struct {
+		name string
+		info MediaInfo
+		caps Capabilities
+		want Decision
+	}{
+		{"playable mp4", MediaInfo{Container: "mp4", Video: h264, Audio: aac}, chromecast, DirectPlay},
+		{"mkv container", MediaInfo{Container: "mkv", Video: h264, Audio: aac}, chromecast, Remux},
+		{"surround audio", MediaInfo{Container: "mp4", Video: h264, Audio: with(aac, func(s *Stream) { s.Channels = 6 })}, chromecast, TranscodeAudio},
+		{"surround audio on 4k", MediaInfo{Container: "mp4", Video: h264, Audio: with(aac, func(s *Stream) { s.Channels = 6 })}, ultra, DirectPlay},
+		{"ac3 audio", MediaInfo{Container: "mkv", Video: h264, Audio: &Stream{CodecName: "ac3", Channels: 2}}, chromecast, TranscodeAudio},
+		{"4k video", MediaInfo{Container: "mp4", Video: with(h264, func(s *Stream) { s.Width, s.Height = 3840, 2160 }), Audio: aac}, chromecast, TranscodeFull},
+		{"4k video on 4k", MediaInfo{Container: "mp4", Video: with(h264, func(s *Stream) { s.Width, s.Height = 3840, 2160; s.Level = 42 }), Audio: aac}, ultra, DirectPlay},
+		{"level 5.1", MediaInfo{Container: "mp4", Video: with(h264, func(s *Stream) { s.Level = 51 }), Audio: aac}, chromecast, TranscodeFull},
+		{"10 bit", MediaInfo{Container: "mp4", Video: with(h264, func(s *Stream) { s.Profile = "High 10" }), Audio: aac}, ultra, TranscodeFull},
+		{"hevc", MediaInfo{Container: "mkv", Video: &Stream{CodecName: "hevc", Width: 1920, Height: 1080}, Audio: aac}, chromecast, TranscodeFull},
+		{"hevc on 4k", MediaInfo{Container: "mkv", Video: &Stream{CodecName: "hevc", Width: 1920, Height: 1080}, Audio: aac}, ultra, Remux},
+		{"flac", MediaInfo{Container: "flac", Audio: &Stream{CodecName: "flac", Channels: 2}}, speaker, DirectPlay},
+		{"wma", MediaInfo{Container: "asf", Audio: &Stream{CodecName: "wmav2", Channels: 2}}, speaker, TranscodeFull},
+		{"video on a speaker", MediaInfo{Container: "mp4", Video: h264, Audio: aac}, speaker, TranscodeFull},
+		{"aac in mkv", MediaInfo{Container: "mkv", Audio: aac}, speaker, Remux},
+	}
+	for _, test := range tests {
+		if got := Decide(&test.info, test.caps); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.name, test.want, got)
+		}
+	}
+}
+
+func TestCapabilitiesForModel(t *testing.T) {
+	tests := map[string]Capabilities{
+		"Chromecast":         chromecastCapabilities,
+		"Chromecast Ultra":   chromecast4KCapabilities,
+		"Google Nest Hub":    smartDisplayCapabilities,
+		"Google Home Mini":   audioOnlyCapabilities,
+		"Google Cast Group":  audioOnlyCapabilities,
+		"JBL Link Speaker":   audioOnlyCapabilities,
+		"Sony Audio Dock":    audioOnlyCapabilities,
+		"BRAVIA 4K GB":       chromecast4KCapabilities,
+		"Philips Android TV": chromecast4KCapabilities,
+		"":                   chromecastCapabilities,
+		"Unknown Dongle":     chromecastCapabilities,
+	}
+	for model, want := range tests {
+		if got := CapabilitiesForModel(model); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: expected %+v, got %+v", model, want, got)
+		}
+	}
+}
+
+func TestNormaliseContainer(t *testing.T) {
+	tests := []struct {
+		formatName, filename, want string
+	}{
+		{"mov,mp4,m4a,3gp,3g2,mj2", "film.mp4", "mp4"},
+		{"mov,mp4,m4a,3gp,3g2,mj2", "song.m4a", "mp4"},
+		{"matroska,webm", "film.mkv", "mkv"},
+		{"matroska,webm", "clip.WEBM", "webm"},
+		{"mp3", "song.mp3", "mp3"},
+		{"flac", "song.flac", "flac"},
+		{"ogg", "song.ogg", "ogg"},
+		{"avi", "film.avi", "avi"},
+		{"mpegts", "recording.ts", "mpegts"},
+		{"asf", "song.wma", "asf"},
+		{"", "unknown", ""},
+	}
+	for _, test := range tests {
+		if got := normaliseContainer(test.formatName, test.filename); got != test.want {
+			t.Errorf("%q %q: expected %q, got %q", test.formatName, test.filename, test.want, got)
+		}
+	}
+}
+
+func TestMediaInfoTags(t *testing.T) {
+	info := MediaInfo{Tags: map[string]string{"track": "3/12", "discnumber": " 2 "}}
+	if info.Track() != 3 || info.Disc() != 2 {
+		t.Errorf("expected track 3 of disc 2, got %d of %d", info.Track(), info.Disc())
+	}
+	if (&MediaInfo{Tags: map[string]string{"track": "A1"}}).Track() != 0 {
+		t.Errorf("expected no track number")
+	}
+
+	contentTypes := []struct {
+		info MediaInfo
+		want string
+	}{
+		{MediaInfo{Container: "mp4", Video: &Stream{}}, "video/mp4"},
+		{MediaInfo{Container: "mp4"}, "audio/mp4"},
+		{MediaInfo{Container: "webm"}, "audio/webm"},
+		{MediaInfo{Container: "mp3"}, "audio/mp3"},
+		{MediaInfo{Container: "mkv", Video: &Stream{}}, ""},
+	}
+	for _, test := range contentTypes {
+		if got := test.info.ContentType(); got != test.want {
+			t.Errorf("%+v: expected %q, got %q", test.info, test.want, got)
+		}
+	}
+}
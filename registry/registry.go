@@ -0,0 +1,194 @@
+// Package registry keeps a file of statically configured cast devices, for
+// networks where they can't be discovered with mDNS, ie: guest VLANs, docker
+// networks and VPNs.
+package registry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	castdns "github.com/grasparv/go-chromecast/dns"
+)
+
+// Device is a cast device or speaker group in the devices file.
+type Device struct {
+	Name  string `json:"name"`
+	UUID  string `json:"uuid,omitempty"`
+	Addr  string `json:"addr"`
+	Port  int    `json:"port,omitempty"`
+	Model string `json:"model,omitempty"`
+	// Group is set if the entry is a speaker group rather than a device.
+	Group bool `json:"group,omitempty"`
+	// MemberOf are the names or uuids of the speaker groups the device is
+	// a member of.
+	MemberOf []string `json:"member_of,omitempty"`
+}
+
+// Entry returns the device as a cast entry.
+func (d Device) Entry() castdns.CastEntry {
+	port := d.Port
+	if port == 0 {
+		port = castdns.DefaultPort
+	}
+	infoFields := map[string]string{
+		"id": d.UUID,
+		"fn": d.Name,
+		"md": d.Model,
+	}
+	if d.Group {
+		infoFields["ca"] = strconv.Itoa(castdns.CapabilityMultizoneGroup | castdns.CapabilityAudioOut)
+	}
+	return castdns.NewStaticEntry(d.Addr, port, infoFields, d.MemberOf)
+}
+
+// matches returns whether the device has the given name or uuid, ignoring case.
+func (d Device) matches(nameOrUUID string) bool {
+	return strings.EqualFold(d.Name, nameOrUUID) || (d.UUID != "" && strings.EqualFold(d.UUID, nameOrUUID))
+}
+
+type devicesFile struct {
+	Devices []Device `json:"devices"`
+}
+
+// Registry is the list of devices in a devices file.
+type Registry struct {
+	filename string
+	Devices  []Device
+}
+
+// DefaultFilename returns the devices file in the user config directory, or
+// an empty string if there is no user config directory.
+func DefaultFilename() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "go-chromecast", "devices.json")
+}
+
+// Load reads the devices file, a missing file is an empty registry.
+func Load(filename string) (*Registry, error) {
+	r := &Registry{filename: filename}
+	if filename == "" {
+		return r, nil
+	}
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return r, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "unable to read devices file %q", filename)
+	}
+	var f devicesFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse devices file %q", filename)
+	}
+	r.Devices = f.Devices
+	return r, nil
+}
+
+// Save writes the registry back to its devices file. The file is replaced
+// atomically so a failed write never leaves it truncated.
+func (r *Registry) Save() error {
+	if r.filename == "" {
+		return errors.New("no devices file")
+	}
+	b, err := json.MarshalIndent(devicesFile{Devices: r.Devices}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal devices")
+	}
+	dir := filepath.Dir(r.filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "unable to create devices file directory")
+	}
+	f, err := ioutil.TempFile(dir, filepath.Base(r.filename)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "unable to create devices file")
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrap(err, "unable to write devices file")
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "unable to write devices file")
+	}
+	if err := os.Rename(f.Name(), r.filename); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "unable to replace devices file")
+	}
+	return nil
+}
+
+// Add adds the device, replacing any device with the same name or uuid.
+func (r *Registry) Add(d Device) {
+	for i, existing := range r.Devices {
+		if existing.matches(d.Name) || (d.UUID != "" && existing.matches(d.UUID)) {
+			r.Devices[i] = d
+			return
+		}
+	}
+	r.Devices = append(r.Devices, d)
+}
+
+// Remove removes the device with the given name or uuid, and returns whether
+// it was found.
+func (r *Registry) Remove(nameOrUUID string) bool {
+	for i, d := range r.Devices {
+		if d.matches(nameOrUUID) {
+			r.Devices = append(r.Devices[:i], r.Devices[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the device with the given name or uuid.
+func (r *Registry) Find(nameOrUUID string) (Device, bool) {
+	for _, d := range r.Devices {
+		if d.matches(nameOrUUID) {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// Entries returns the devices as cast entries.
+func (r *Registry) Entries() []castdns.CastEntry {
+	entries := make([]castdns.CastEntry, len(r.Devices))
+	for i, d := range r.Devices {
+		entries[i] = d.Entry()
+	}
+	return entries
+}
+
+// Merge returns the discovered entries together with the devices in the
+// registry. A discovered entry with the same uuid, or the same name if the
+// device has no uuid, replaces the device since its address is more recent.
+// The group membership from the registry is kept.
+func (r *Registry) Merge(discovered []castdns.CastEntry) []castdns.CastEntry {
+	merged := make([]castdns.CastEntry, len(discovered))
+	copy(merged, discovered)
+	for _, d := range r.Devices {
+		found := false
+		for i, e := range merged {
+			if (d.UUID != "" && strings.EqualFold(d.UUID, e.UUID)) || (d.UUID == "" && strings.EqualFold(d.Name, e.DeviceName)) {
+				if len(merged[i].MemberOf) == 0 {
+					merged[i].MemberOf = d.MemberOf
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, d.Entry())
+		}
+	}
+	return merged
+}
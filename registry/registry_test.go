@@ -0,0 +1,114 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	castdns "github.com/grasparv/go-chromecast/dns"
+)
+
+func TestMerge(t *testing.T) {
+	r := &Registry{Devices: []Device{
+		// Discovered with the same uuid, but a different name and address.
+		{Name: "Old TV", UUID: "B380C584", Addr: "10.8.0.10", MemberOf: []string{"Downstairs"}},
+		// Discovered by name, it has no uuid.
+		{Name: "kitchen", Addr: "10.8.0.11", MemberOf: []string{"Downstairs"}},
+		// Discovered with its own group membership.
+		{Name: "Bedroom", UUID: "c1d2", Addr: "10.8.0.12", MemberOf: []string{"Upstairs"}},
+		// A uuid that doesn't match, even though the name does.
+		{Name: "Office", UUID: "e5f6", Addr: "10.8.0.13"},
+		{Name: "Garage", Addr: "10.8.0.14", Port: 8010, Model: "Chromecast"},
+		{Name: "Everywhere", UUID: "g7h8", Addr: "10.8.0.15", Group: true},
+	}}
+	discovered := []castdns.CastEntry{
+		{DeviceName: "Living Room TV", UUID: "b380c584", Port: 8009},
+		{DeviceName: "Kitchen", Port: 8009},
+		{DeviceName: "Bedroom", UUID: "c1d2", Port: 8009, MemberOf: []string{"Everywhere"}},
+		{DeviceName: "Office", UUID: "0000", Port: 8009},
+	}
+
+	merged := r.Merge(discovered)
+	var names []string
+	for _, e := range merged {
+		names = append(names, e.DeviceName)
+	}
+	want := []string{"Living Room TV", "Kitchen", "Bedroom", "Office", "Office", "Garage", "Everywhere"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected %q, got %q", want, names)
+	}
+
+	memberOf := [][]string{{"Downstairs"}, {"Downstairs"}, {"Everywhere"}, nil, nil, nil, nil}
+	for i, e := range merged {
+		if !reflect.DeepEqual(e.MemberOf, memberOf[i]) {
+			t.Errorf("%s: expected member of %q, got %q", e.DeviceName, memberOf[i], e.MemberOf)
+		}
+	}
+	if merged[0].Port != 8009 || merged[0].UUID != "b380c584" {
+		t.Errorf("expected the discovered entry to be kept, got %+v", merged[0])
+	}
+	if e := merged[4]; e.GetAddr() != "10.8.0.13" || e.UUID != "e5f6" {
+		t.Errorf("expected the device from the registry, got %+v", e)
+	}
+	if e := merged[5]; e.GetAddr() != "10.8.0.14" || e.GetPort() != 8010 || e.GetDevice() != "Chromecast" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e := merged[6]; e.GetPort() != castdns.DefaultPort || !e.IsGroup() {
+		t.Errorf("expected a group on the default port, got %+v", e)
+	}
+
+	// The discovered entries aren't modified.
+	if discovered[0].MemberOf != nil || len(discovered) != 4 {
+		t.Errorf("expected the discovered entries to be unchanged, got %+v", discovered)
+	}
+	if merged := (&Registry{}).Merge(discovered); !reflect.DeepEqual(merged, discovered) {
+		t.Errorf("expected an empty registry to add nothing, got %+v", merged)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "config", "devices.json")
+
+	r, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Add(Device{Name: "Garage", Addr: "10.8.0.12"})
+	r.Add(Device{Name: "Cabin", UUID: "a1b2", Addr: "10.8.0.13"})
+	// Replaces the existing devices with the same name or uuid.
+	r.Add(Device{Name: "garage", Addr: "10.8.0.14"})
+	r.Add(Device{Name: "Lake house", UUID: "A1B2", Addr: "10.8.0.15"})
+	if err := r.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Device{
+		{Name: "garage", Addr: "10.8.0.14"},
+		{Name: "Lake house", UUID: "A1B2", Addr: "10.8.0.15"},
+	}
+	if !reflect.DeepEqual(loaded.Devices, want) {
+		t.Errorf("expected %+v, got %+v", want, loaded.Devices)
+	}
+	if d, ok := loaded.Find("a1b2"); !ok || d.Name != "Lake house" {
+		t.Errorf("expected to find the device by uuid, got %+v, %v", d, ok)
+	}
+	if !loaded.Remove("GARAGE") || loaded.Remove("garage") {
+		t.Errorf("expected the device to be removed once")
+	}
+
+	ioutil.WriteFile(filename, []byte("{"), 0644)
+	if _, err := Load(filename); err == nil {
+		t.Errorf("expected an error for an invalid devices file")
+	}
+}
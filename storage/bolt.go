@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	boltFilename = "storage.db"
+	// boltTimeout is how long to wait for another process to close the
+	// database.
+	boltTimeout = 10 * time.Second
+)
+
+var boltBucket = []byte("entries")
+
+// BoltStore is a Store backed by an embedded bolt database. The database is
+// only open while an operation runs, as bolt locks it for as long as it is
+// open and other processes would have to wait for that.
+type BoltStore struct {
+	mu       sync.Mutex
+	filename string
+}
+
+// NewBoltStore returns a BoltStore using the given database file, or the
+// file in the default directory if filename is empty, see DefaultDir.
+func NewBoltStore(filename string) *BoltStore {
+	return &BoltStore{filename: filename}
+}
+
+// Filename returns the database file.
+func (s *BoltStore) Filename() (string, error) {
+	if s.filename != "" {
+		return s.filename, nil
+	}
+	dir, err := DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, boltFilename), nil
+}
+
+// Load implements Store.
+func (s *BoltStore) Load(key string) ([]byte, error) {
+	var value []byte
+	err := s.withDB(false, func(b *bolt.Bucket) error {
+		r, err := getRecord(b, key)
+		if err != nil || r.expired(now()) {
+			return err
+		}
+		value = r.Value
+		return nil
+	})
+	return value, err
+}
+
+// Save implements Store.
+func (s *BoltStore) Save(key string, value []byte, ttl time.Duration) error {
+	return s.withDB(true, func(b *bolt.Bucket) error {
+		return putRecord(b, key, newRecord(value, ttl))
+	})
+}
+
+// Update implements Store.
+func (s *BoltStore) Update(key string, f func(value []byte) ([]byte, error)) error {
+	return s.withDB(true, func(b *bolt.Bucket) error {
+		r, err := getRecord(b, key)
+		if err != nil {
+			return err
+		}
+		if r.expired(now()) {
+			r = record{}
+		}
+		value, err := f(r.Value)
+		if err != nil {
+			return err
+		}
+		return putRecord(b, key, r.updated(value))
+	})
+}
+
+// Delete implements Store.
+func (s *BoltStore) Delete(key string) error {
+	return s.withDB(true, func(b *bolt.Bucket) error {
+		return b.Delete([]byte(key))
+	})
+}
+
+// Entries implements Store.
+func (s *BoltStore) Entries(prefix string) ([]Entry, error) {
+	var es []Entry
+	err := s.withDB(false, func(b *bolt.Bucket) error {
+		if b == nil {
+			return nil
+		}
+		t := now()
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			var r record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return errors.Wrapf(err, "unable to parse stored value of %q", k)
+			}
+			if !r.expired(t) {
+				es = append(es, r.entry(string(k)))
+			}
+		}
+		return nil
+	})
+	return es, err
+}
+
+// withDB opens the database and calls f with its bucket in a transaction,
+// which is only writable if write is set. Writes also remove the expired
+// entries. A database that doesn't exist is only created by writes, reads
+// are given a nil bucket.
+func (s *BoltStore) withDB(write bool, f func(b *bolt.Bucket) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filename, err := s.Filename()
+	if err != nil {
+		return err
+	}
+	if !write {
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return f(nil)
+		}
+	} else if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return errors.Wrap(err, "unable to create storage directory")
+	}
+
+	db, err := bolt.Open(filename, 0644, &bolt.Options{Timeout: boltTimeout, ReadOnly: !write})
+	if err != nil {
+		return errors.Wrapf(err, "unable to open storage database %q", filename)
+	}
+	defer db.Close()
+
+	if !write {
+		return db.View(func(tx *bolt.Tx) error {
+			return f(tx.Bucket(boltBucket))
+		})
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(boltBucket)
+		if err != nil {
+			return err
+		}
+		if err := removeExpired(b); err != nil {
+			return err
+		}
+		return f(b)
+	})
+}
+
+// getRecord returns the record for key, or an empty record if there is
+// none. b may be nil.
+func getRecord(b *bolt.Bucket, key string) (record, error) {
+	var r record
+	if b == nil {
+		return r, nil
+	}
+	v := b.Get([]byte(key))
+	if v == nil {
+		return r, nil
+	}
+	if err := json.Unmarshal(v, &r); err != nil {
+		return r, errors.Wrapf(err, "unable to parse stored value of %q", key)
+	}
+	return r, nil
+}
+
+func putRecord(b *bolt.Bucket, key string, r record) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal stored value")
+	}
+	return b.Put([]byte(key), v)
+}
+
+func removeExpired(b *bolt.Bucket) error {
+	t := now()
+	var expired [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var r record
+		if json.Unmarshal(v, &r) == nil && r.expired(t) {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
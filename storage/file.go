@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// schemaVersion is the version of the storage file format, it is
+	// increased when the format changes so older files can be migrated.
+	schemaVersion = 1
+
+	storageFilename = "storage.json"
+)
+
+// fileContents is the format of the storage file.
+type fileContents struct {
+	Version int               `json:"version"`
+	Entries map[string]record `json:"entries"`
+}
+
+// FileStore is a Store backed by a JSON file. Every operation reads the file
+// again under an advisory lock, and writes replace the file atomically, so
+// several processes can use the same file without losing each other's
+// changes.
+type FileStore struct {
+	mu       sync.Mutex
+	filename string
+	// migrated is set once the legacy storage file has been checked for,
+	// only the default file is migrated.
+	migrated bool
+}
+
+// NewFileStore returns a FileStore using the given file, or the file in the
+// default directory if filename is empty, see DefaultDir.
+func NewFileStore(filename string) *FileStore {
+	return &FileStore{filename: filename, migrated: filename != ""}
+}
+
+// Filename returns the file the storage is kept in.
+func (s *FileStore) Filename() (string, error) {
+	if s.filename != "" {
+		return s.filename, nil
+	}
+	dir, err := DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, storageFilename), nil
+}
+
+// Load implements Store.
+func (s *FileStore) Load(key string) ([]byte, error) {
+	var value []byte
+	err := s.withFile(false, func(c *fileContents) (bool, error) {
+		value = c.Entries[key].Value
+		return false, nil
+	})
+	return value, err
+}
+
+// Save implements Store.
+func (s *FileStore) Save(key string, value []byte, ttl time.Duration) error {
+	return s.withFile(true, func(c *fileContents) (bool, error) {
+		c.Entries[key] = newRecord(value, ttl)
+		return true, nil
+	})
+}
+
+// Update implements Store.
+func (s *FileStore) Update(key string, f func(value []byte) ([]byte, error)) error {
+	return s.withFile(true, func(c *fileContents) (bool, error) {
+		r := c.Entries[key]
+		value, err := f(r.Value)
+		if err != nil {
+			return false, err
+		}
+		c.Entries[key] = r.updated(value)
+		return true, nil
+	})
+}
+
+// Delete implements Store.
+func (s *FileStore) Delete(key string) error {
+	return s.withFile(true, func(c *fileContents) (bool, error) {
+		_, ok := c.Entries[key]
+		delete(c.Entries, key)
+		return ok, nil
+	})
+}
+
+// Entries implements Store.
+func (s *FileStore) Entries(prefix string) ([]Entry, error) {
+	var es []Entry
+	err := s.withFile(false, func(c *fileContents) (bool, error) {
+		es = entries(c.Entries, prefix)
+		return false, nil
+	})
+	return es, err
+}
+
+// withFile locks the storage file, reads it and calls f with its contents,
+// without the expired entries. If f returns true the contents are written
+// back before unlocking. Only writes take an exclusive lock.
+func (s *FileStore) withFile(write bool, f func(c *fileContents) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	filename, err := s.Filename()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return errors.Wrap(err, "unable to create storage directory")
+	}
+
+	lock, err := os.OpenFile(filename+".lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "unable to open storage lock file")
+	}
+	defer lock.Close()
+	// Migrating writes the file, so it needs the exclusive lock.
+	exclusive := write || !s.migrated
+	if err := lockFile(lock, exclusive); err != nil {
+		return errors.Wrap(err, "unable to lock storage file")
+	}
+	defer unlockFile(lock)
+
+	if !s.migrated {
+		if err := migrateLegacy(filename); err != nil {
+			return err
+		}
+		s.migrated = true
+	}
+
+	c, err := readFile(filename)
+	if err != nil {
+		return err
+	}
+	t := now()
+	for key, r := range c.Entries {
+		if r.expired(t) {
+			delete(c.Entries, key)
+		}
+	}
+	changed, err := f(c)
+	if err != nil || !changed {
+		return err
+	}
+	return writeFile(filename, c)
+}
+
+// readFile reads the storage file, a missing file has no entries.
+func readFile(filename string) (*fileContents, error) {
+	c := &fileContents{Version: schemaVersion, Entries: map[string]record{}}
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "unable to read storage file %q", filename)
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, errors.Wrapf(err, "unable to parse storage file %q", filename)
+	}
+	if c.Version > schemaVersion {
+		return nil, errors.Errorf("storage file %q is version %d, only up to version %d is supported", filename, c.Version, schemaVersion)
+	}
+	if c.Entries == nil {
+		c.Entries = map[string]record{}
+	}
+	return c, nil
+}
+
+// writeFile replaces the storage file atomically, by writing to a temporary
+// file in the same directory and renaming it over the storage file.
+func writeFile(filename string, c *fileContents) error {
+	c.Version = schemaVersion
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal storage")
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "unable to create storage file")
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return errors.Wrap(err, "unable to write storage file")
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "unable to write storage file")
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		os.Remove(f.Name())
+		return errors.Wrap(err, "unable to replace storage file")
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps values in memory only, it is used when
+// nothing should be written to disk, and in tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]record{}}
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if !ok || r.expired(now()) {
+		return nil, nil
+	}
+	return r.Value, nil
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = newRecord(value, ttl)
+	return nil
+}
+
+// Update implements Store.
+func (s *MemoryStore) Update(key string, f func(value []byte) ([]byte, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	if ok && r.expired(now()) {
+		r = record{}
+	}
+	value, err := f(r.Value)
+	if err != nil {
+		return err
+	}
+	s.records[key] = r.updated(value)
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// Entries implements Store.
+func (s *MemoryStore) Entries(prefix string) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return entries(s.records, prefix), nil
+}
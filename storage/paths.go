@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/pkg/errors"
+)
+
+// legacyPaths are where the storage file was kept, relative to the home
+// directory, before it followed the XDG base directory layout.
+var legacyPaths = []string{
+	".config/gochromecast",
+	".gochromecast",
+}
+
+// DefaultDir returns the directory the storage file is kept in by default.
+// This is $XDG_STATE_HOME/go-chromecast, or ~/.local/state/go-chromecast if
+// XDG_STATE_HOME is unset. On windows and macOS, which don't use the XDG
+// layout, the user config directory is used instead.
+func DefaultDir() (string, error) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", errors.Wrap(err, "unable to find config directory")
+		}
+		return filepath.Join(dir, "go-chromecast"), nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "go-chromecast"), nil
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", errors.Wrap(err, "unable to find homedir")
+	}
+	return filepath.Join(home, ".local", "state", "go-chromecast"), nil
+}
+
+// migrateLegacy moves the contents of a storage file from a legacy path to
+// filename, if filename doesn't exist yet. The legacy file is kept with a
+// '.bak' suffix. Legacy files are version 0 of the format, a plain JSON
+// object of keys to values.
+func migrateLegacy(filename string) error {
+	home, err := homedir.Dir()
+	if err != nil {
+		// Without a home directory there is nothing to migrate.
+		return nil
+	}
+	return migrateLegacyFrom(filename, home)
+}
+
+// migrateLegacyFrom migrates the legacy file in the home directory home.
+func migrateLegacyFrom(filename, home string) error {
+	if _, err := os.Stat(filename); err == nil || !os.IsNotExist(err) {
+		return nil
+	}
+	for _, p := range legacyPaths {
+		legacy := filepath.Join(home, p)
+		info, err := os.Stat(legacy)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		b, err := ioutil.ReadFile(legacy)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read legacy storage file %q", legacy)
+		}
+		c := &fileContents{Version: schemaVersion, Entries: map[string]record{}}
+		// Older versions created the file empty before anything was saved.
+		if len(b) > 0 {
+			var values map[string][]byte
+			if err := json.Unmarshal(b, &values); err != nil {
+				return errors.Wrapf(err, "unable to parse legacy storage file %q", legacy)
+			}
+			for key, value := range values {
+				if len(value) > 0 {
+					c.Entries[key] = newRecord(value, 0)
+				}
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return errors.Wrap(err, "unable to create storage directory")
+		}
+		if err := writeFile(filename, c); err != nil {
+			return err
+		}
+		if err := os.Rename(legacy, legacy+".bak"); err != nil {
+			return errors.Wrapf(err, "unable to move legacy storage file %q", legacy)
+		}
+		return nil
+	}
+	return nil
+}
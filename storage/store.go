@@ -0,0 +1,115 @@
+// Package storage persists small values, like cached device addresses and
+// the history of played media, so they can be shared between go-chromecast
+// processes.
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The backends a Store can be opened with, see Open.
+const (
+	BackendFile   = "file"
+	BackendBolt   = "bolt"
+	BackendMemory = "memory"
+)
+
+// Backends are the names of the backends, in the order they are listed in
+// help texts.
+var Backends = []string{BackendFile, BackendBolt, BackendMemory}
+
+// now is replaced in tests to expire entries without waiting.
+var now = time.Now
+
+// Store is a key value store where values can expire.
+type Store interface {
+	// Load returns the value stored for key, or nil if there is none or it
+	// has expired.
+	Load(key string) ([]byte, error)
+	// Save stores the value for key. It expires after ttl, or never if ttl
+	// is 0.
+	Save(key string, value []byte, ttl time.Duration) error
+	// Update replaces the value for key with the result of f, which is given
+	// the current value or nil. No other process can change the value in
+	// between, this allows values to be merged rather than overwritten. The
+	// value keeps its expiry, a new value never expires.
+	Update(key string, f func(value []byte) ([]byte, error)) error
+	// Delete removes the value for key.
+	Delete(key string) error
+	// Entries returns the entries with keys starting with prefix, which
+	// haven't expired, sorted by key.
+	Entries(prefix string) ([]Entry, error)
+}
+
+// Entry is a stored value.
+type Entry struct {
+	Key     string    `json:"key"`
+	Value   []byte    `json:"value"`
+	Updated time.Time `json:"updated"`
+	// Expires is zero if the value never expires.
+	Expires time.Time `json:"expires"`
+}
+
+// Open returns a Store using the named backend. For the file and bolt
+// backends path is the file to store in, if it is empty the file is in the
+// default directory, see DefaultDir. path is ignored by the memory backend.
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case BackendFile:
+		return NewFileStore(path), nil
+	case BackendBolt:
+		return NewBoltStore(path), nil
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	default:
+		return nil, errors.Errorf("unknown storage backend %q, use one of %v", backend, Backends)
+	}
+}
+
+// record is a stored value, the backends that keep values outside of memory
+// marshal it to JSON.
+type record struct {
+	Value   []byte    `json:"value"`
+	Updated time.Time `json:"updated"`
+	Expires time.Time `json:"expires"`
+}
+
+func newRecord(value []byte, ttl time.Duration) record {
+	r := record{Value: value, Updated: now()}
+	if ttl > 0 {
+		r.Expires = r.Updated.Add(ttl)
+	}
+	return r
+}
+
+// expired returns whether the record has expired at t.
+func (r record) expired(t time.Time) bool {
+	return !r.Expires.IsZero() && !t.Before(r.Expires)
+}
+
+// updated returns the record with its value replaced, keeping its expiry.
+func (r record) updated(value []byte) record {
+	return record{Value: value, Updated: now(), Expires: r.Expires}
+}
+
+// entries returns the entries of the records with keys starting with
+// prefix, which haven't expired, sorted by key.
+func entries(records map[string]record, prefix string) []Entry {
+	t := now()
+	var es []Entry
+	for key, r := range records {
+		if strings.HasPrefix(key, prefix) && !r.expired(t) {
+			es = append(es, r.entry(key))
+		}
+	}
+	sort.Slice(es, func(i, j int) bool { return es[i].Key < es[j].Key })
+	return es
+}
+
+func (r record) entry(key string) Entry {
+	return Entry{Key: key, Value: r.Value, Updated: r.Updated, Expires: r.Expires}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testStores returns a store of every backend, using files in dir.
+func testStores(dir string) map[string]Store {
+	return map[string]Store{
+		BackendFile:   NewFileStore(filepath.Join(dir, "storage.json")),
+		BackendBolt:   NewBoltStore(filepath.Join(dir, "storage.db")),
+		BackendMemory: NewMemoryStore(),
+	}
+}
+
+// withNow makes the stores see the time returned by the given function,
+// until the returned function is called.
+func withNow(f func() time.Time) func() {
+	original := now
+	now = f
+	return func() { now = original }
+}
+
+func TestStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, s := range testStores(dir) {
+		if v, err := s.Load("missing"); err != nil || v != nil {
+			t.Errorf("%s: expected no value for a missing key, got %q, %v", name, v, err)
+		}
+		if err := s.Save("a", []byte("1"), 0); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if v, err := s.Load("a"); err != nil || string(v) != "1" {
+			t.Errorf("%s: expected %q, got %q, %v", name, "1", v, err)
+		}
+		err := s.Update("a", func(v []byte) ([]byte, error) {
+			return append(v, '2'), nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if v, _ := s.Load("a"); string(v) != "12" {
+			t.Errorf("%s: expected the updated value %q, got %q", name, "12", v)
+		}
+		s.Save("b/1", []byte("x"), 0)
+		s.Save("b/2", []byte("y"), 0)
+		s.Save("c", []byte("z"), 0)
+		es, err := s.Entries("b/")
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(es) != 2 || es[0].Key != "b/1" || es[1].Key != "b/2" || string(es[1].Value) != "y" {
+			t.Errorf("%s: expected the entries b/1 and b/2, got %+v", name, es)
+		}
+		if es, _ := s.Entries(""); len(es) != 4 {
+			t.Errorf("%s: expected 4 entries, got %d", name, len(es))
+		}
+		if err := s.Delete("a"); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if v, _ := s.Load("a"); v != nil {
+			t.Errorf("%s: expected no value after delete, got %q", name, v)
+		}
+	}
+}
+
+func TestStoresExpiry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	start := time.Now()
+	current := start
+	defer withNow(func() time.Time { return current })()
+
+	for name, s := range testStores(dir) {
+		current = start
+		s.Save("dns", []byte("10.0.0.5"), time.Minute)
+		s.Save("history", []byte("{}"), 0)
+		// Updates keep the expiry of the value.
+		s.Update("dns", func(v []byte) ([]byte, error) { return []byte("10.0.0.6"), nil })
+
+		current = start.Add(59 * time.Second)
+		if v, _ := s.Load("dns"); string(v) != "10.0.0.6" {
+			t.Errorf("%s: expected %q before it expired, got %q", name, "10.0.0.6", v)
+		}
+		current = start.Add(time.Minute)
+		if v, _ := s.Load("dns"); v != nil {
+			t.Errorf("%s: expected no value once expired, got %q", name, v)
+		}
+		if es, _ := s.Entries(""); len(es) != 1 || es[0].Key != "history" {
+			t.Errorf("%s: expected only the value without a ttl to be listed, got %+v", name, es)
+		}
+		if v, _ := s.Load("history"); string(v) != "{}" {
+			t.Errorf("%s: expected the value without a ttl to be kept, got %q", name, v)
+		}
+		// An expired value is not given to updates.
+		s.Update("dns", func(v []byte) ([]byte, error) {
+			if v != nil {
+				t.Errorf("%s: expected no value to update once expired, got %q", name, v)
+			}
+			return []byte("10.0.0.7"), nil
+		})
+		current = start.Add(time.Hour)
+		if v, _ := s.Load("dns"); string(v) != "10.0.0.7" {
+			t.Errorf("%s: expected a value set after expiry to not expire, got %q", name, v)
+		}
+	}
+}
+
+func TestFileStoreMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	legacy := filepath.Join(dir, ".gochromecast")
+	if err := ioutil.WriteFile(legacy, []byte(`{"application":"e30=","cmd/utils/dns/Kitchen":null}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "state", "storage.json")
+	if err := migrateLegacyFrom(filename, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewFileStore(filename)
+	if v, _ := s.Load("application"); string(v) != "{}" {
+		t.Errorf("expected the legacy value to be migrated, got %q", v)
+	}
+	if _, err := os.Stat(legacy + ".bak"); err != nil {
+		t.Errorf("expected the legacy file to be kept as a backup: %v", err)
+	}
+	c, err := readFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Version != schemaVersion || len(c.Entries) != 1 {
+		t.Errorf("expected version %d with 1 entry, got version %d with %d", schemaVersion, c.Version, len(c.Entries))
+	}
+
+	if err := ioutil.WriteFile(filename, []byte(`{"version":99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("application"); err == nil {
+		t.Errorf("expected an error for a newer version of the file")
+	}
+}
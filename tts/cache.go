@@ -0,0 +1,130 @@
+package tts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CachedEngine keeps the audio synthesized by an engine in a directory, so
+// the same speech is only synthesized once.
+type CachedEngine struct {
+	Engine Engine
+	// Key identifies the engine and its settings, ie: the engine name and
+	// server url. Audio is cached by a hash of the key and the request.
+	Key string
+	Dir string
+	// MaxSize is the most bytes of audio kept in Dir, the least recently
+	// used audio is removed first. 0 doesn't limit the size.
+	MaxSize int64
+}
+
+// NewCachedEngine returns engine with its audio cached in dir, using no
+// more than maxSize bytes.
+func NewCachedEngine(engine Engine, key, dir string, maxSize int64) *CachedEngine {
+	return &CachedEngine{Engine: engine, Key: key, Dir: dir, MaxSize: maxSize}
+}
+
+// Synthesize implements Engine. The audio is returned even if it can't be
+// written to the cache.
+func (e *CachedEngine) Synthesize(ctx context.Context, r Request) (Audio, error) {
+	filename, err := e.filename(r)
+	if err != nil {
+		return Audio{}, err
+	}
+	if data, err := ioutil.ReadFile(filename); err == nil && len(data) > 0 {
+		// Mark the audio as recently used.
+		now := time.Now()
+		os.Chtimes(filename, now, now)
+		return Audio{Data: data, ContentType: detectContentType(data)}, nil
+	}
+
+	audio, err := e.Engine.Synthesize(ctx, r)
+	if err != nil {
+		return Audio{}, err
+	}
+	// The content type isn't kept in the cache, so audio is only cached if
+	// the content type can be detected again when it is read.
+	if detectContentType(audio.Data) == audio.ContentType {
+		if err := writeCacheFile(filename, audio.Data); err == nil {
+			e.evict()
+		}
+	}
+	return audio, nil
+}
+
+// evict removes the least recently used audio until the cache is no larger
+// than MaxSize.
+func (e *CachedEngine) evict() {
+	if e.MaxSize <= 0 {
+		return
+	}
+	files, err := ioutil.ReadDir(e.Dir)
+	if err != nil {
+		return
+	}
+
+	var total int64
+	cached := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		// Files still being written by another process are left alone.
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".tmp") {
+			continue
+		}
+		cached = append(cached, f)
+		total += f.Size()
+	}
+
+	sort.Slice(cached, func(i, j int) bool { return cached[i].ModTime().Before(cached[j].ModTime()) })
+	for _, f := range cached {
+		if total <= e.MaxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(e.Dir, f.Name())); err == nil {
+			total -= f.Size()
+		}
+	}
+}
+
+// filename returns the cache file of the request.
+func (e *CachedEngine) filename(r Request) (string, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to marshal request")
+	}
+	h := sha256.New()
+	h.Write([]byte(e.Key))
+	h.Write([]byte{0})
+	h.Write(b)
+	return filepath.Join(e.Dir, hex.EncodeToString(h.Sum(nil))), nil
+}
+
+// writeCacheFile writes the file through a temp file, so a partially
+// written file is never read from the cache.
+func writeCacheFile(filename string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return errors.Wrap(err, "unable to create cache directory")
+	}
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "unable to create cache file")
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to write cache file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "unable to write cache file")
+	}
+	return errors.Wrap(os.Rename(f.Name(), filename), "unable to write cache file")
+}
@@ -0,0 +1,299 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// presetArgs build the arguments of the local engines for a request, with
+// the same placeholders as CommandEngine.
+var presetArgs = map[string]func(r Request) ([]string, error){
+	EngineEspeakNG:  espeakArgs,
+	EnginePiper:     piperArgs,
+	EnginePico2Wave: pico2waveArgs,
+}
+
+// CommandEngine synthesizes speech by running a local command, which writes
+// WAV, MP3 or Ogg audio to stdout or to a file.
+//
+// These placeholders in the arguments of the command are replaced:
+//
+//	{text}     the text, it is written to stdin if no argument has it
+//	{ssml}     'true' if the text is SSML, otherwise 'false'
+//	{lang}     the language code
+//	{voice}    the voice, or the language code if there is none
+//	{gender}   the gender of the voice, or nothing
+//	{rate}     the speaking rate, 1 is the normal speed
+//	{pitch}    the pitch change in semitones
+//	{gain}     the volume gain in dB
+//	{encoding} the requested audio encoding, or nothing
+//	{output}   a file ending in '.wav' to write the audio to, instead of stdout
+type CommandEngine struct {
+	Name string
+	Args []string
+
+	// args builds the arguments for a request instead of Args, it is set
+	// for the local engines.
+	args func(r Request) ([]string, error)
+}
+
+// NewCommandEngine returns a CommandEngine running the command line, which
+// is split on spaces outside of single and double quotes.
+func NewCommandEngine(commandLine string) (*CommandEngine, error) {
+	args, err := splitCommandLine(commandLine)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("the command line is empty")
+	}
+	return &CommandEngine{Name: args[0], Args: args[1:]}, nil
+}
+
+// newPresetEngine returns the CommandEngine of the named local engine.
+func newPresetEngine(name string) *CommandEngine {
+	return &CommandEngine{Name: name, args: presetArgs[name]}
+}
+
+// Synthesize implements Engine.
+func (e *CommandEngine) Synthesize(ctx context.Context, r Request) (Audio, error) {
+	templates := e.Args
+	if e.args != nil {
+		var err error
+		if templates, err = e.args(r); err != nil {
+			return Audio{}, err
+		}
+	}
+	// The voice only falls back to the language once the arguments are
+	// built, the local engines need to know whether a voice was given.
+	if r.Voice == "" {
+		r.Voice = r.LanguageCode
+	}
+
+	var output string
+	for _, arg := range templates {
+		if strings.Contains(arg, "{output}") {
+			f, err := ioutil.TempFile("", "go-chromecast-tts-*.wav")
+			if err != nil {
+				return Audio{}, errors.Wrap(err, "unable to create temp file")
+			}
+			f.Close()
+			output = f.Name()
+			defer os.Remove(output)
+			break
+		}
+	}
+	textInArgs := false
+	placeholders := r.placeholders(func(s string) string { return s }, "{output}", output)
+	args := make([]string, len(templates))
+	for i, arg := range templates {
+		textInArgs = textInArgs || strings.Contains(arg, "{text}")
+		args[i] = placeholders.Replace(arg)
+	}
+
+	cmd := exec.CommandContext(ctx, e.Name, args...)
+	if !textInArgs {
+		cmd.Stdin = strings.NewReader(r.Text)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Audio{}, errors.Wrapf(err, "unable to run %s: %s", e.Name, msg)
+		}
+		return Audio{}, errors.Wrapf(err, "unable to run %s", e.Name)
+	}
+
+	data := stdout.Bytes()
+	if output != "" {
+		var err error
+		if data, err = ioutil.ReadFile(output); err != nil {
+			return Audio{}, errors.Wrapf(err, "unable to read the audio written by %s", e.Name)
+		}
+	}
+	if len(data) == 0 {
+		return Audio{}, errors.Errorf("%s did not output any audio", e.Name)
+	}
+	return Audio{Data: data, ContentType: detectContentType(data)}, nil
+}
+
+// Voices implements VoiceLister for the espeak-ng and pico2wave engines.
+func (e *CommandEngine) Voices(ctx context.Context, languageCode string) ([]Voice, error) {
+	switch {
+	case e.args == nil:
+		return nil, errors.Errorf("listing the voices of %s is not supported", e.Name)
+	case e.Name == EnginePico2Wave:
+		var voices []Voice
+		for _, lang := range pico2waveLanguages {
+			if languageCode == "" || strings.EqualFold(lang, languageCode) {
+				voices = append(voices, Voice{Name: lang, LanguageCodes: []string{lang}})
+			}
+		}
+		return voices, nil
+	case e.Name == EngineEspeakNG:
+		arg := "--voices"
+		if languageCode != "" {
+			arg += "=" + strings.ToLower(languageCode)
+		}
+		out, err := exec.CommandContext(ctx, e.Name, arg).Output()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list the voices of %s", e.Name)
+		}
+		return parseEspeakVoices(out), nil
+	default:
+		return nil, errors.Errorf("listing the voices of %s is not supported, its voices are model files", e.Name)
+	}
+}
+
+// espeakArgs are the arguments of espeak-ng, it changes the voice for the
+// gender with a variant.
+func espeakArgs(r Request) ([]string, error) {
+	voice := "{voice}"
+	switch r.Gender {
+	case GenderMale:
+		voice += "+m3"
+	case GenderFemale:
+		voice += "+f3"
+	}
+	args := []string{"--stdout", "-v", voice}
+	if r.SSML {
+		args = append(args, "-m")
+	}
+	if r.SpeakingRate != 0 {
+		// 175 words per minute is the normal speed.
+		args = append(args, "-s", strconv.Itoa(int(math.Round(175*r.SpeakingRate))))
+	}
+	if r.Pitch != 0 {
+		// The pitch goes from 0 to 99, 50 is the normal pitch.
+		args = append(args, "-p", strconv.Itoa(clamp(int(math.Round(50+2.5*r.Pitch)), 0, 99)))
+	}
+	if r.VolumeGain != 0 {
+		// The amplitude goes from 0 to 200, 100 is the normal volume.
+		args = append(args, "-a", strconv.Itoa(clamp(int(math.Round(100*dbToRatio(r.VolumeGain))), 0, 200)))
+	}
+	return append(args, "{text}"), nil
+}
+
+// piperArgs are the arguments of piper, which only supports changing the
+// speaking rate. Its voices are model files, there is no voice to fall back
+// to for a language.
+func piperArgs(r Request) ([]string, error) {
+	if r.SSML {
+		return nil, errors.New("piper does not support SSML")
+	}
+	if r.Voice == "" {
+		return nil, errors.New("piper needs the model file as --voice")
+	}
+	args := []string{"--model", "{voice}", "--output_file", "{output}"}
+	if r.SpeakingRate != 0 {
+		args = append(args, "--length_scale", formatFloat(1/r.SpeakingRate))
+	}
+	return args, nil
+}
+
+// pico2waveLanguages are the languages pico2wave has voices for.
+var pico2waveLanguages = []string{"de-DE", "en-GB", "en-US", "es-ES", "fr-FR", "it-IT"}
+
+// pico2waveArgs are the arguments of pico2wave, the speaking rate, pitch and
+// volume are set with its own markup.
+func pico2waveArgs(r Request) ([]string, error) {
+	if r.SSML {
+		return nil, errors.New("pico2wave does not support SSML")
+	}
+	text := "{text}"
+	if r.SpeakingRate != 0 {
+		text = fmt.Sprintf(`<speed level="%d">%s</speed>`, int(math.Round(100*r.SpeakingRate)), text)
+	}
+	if r.Pitch != 0 {
+		// The pitch level goes from 50 to 200, 100 is the normal pitch.
+		text = fmt.Sprintf(`<pitch level="%d">%s</pitch>`, clamp(int(math.Round(100*math.Pow(2, r.Pitch/12))), 50, 200), text)
+	}
+	if r.VolumeGain != 0 {
+		// The volume level goes from 0 to 500, 100 is the normal volume.
+		text = fmt.Sprintf(`<volume level="%d">%s</volume>`, clamp(int(math.Round(100*dbToRatio(r.VolumeGain))), 0, 500), text)
+	}
+	return []string{"-l", "{lang}", "-w", "{output}", text}, nil
+}
+
+// parseEspeakVoices parses the voices listed by 'espeak-ng --voices', ie:
+//
+//	Pty Language       Age/Gender VoiceName          File                 Other Languages
+//	 2  en-us           --/M      English_(America)  gmw/en-US            (en 3)
+func parseEspeakVoices(out []byte) []Voice {
+	var voices []Voice
+	for i, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 5 {
+			continue
+		}
+		v := Voice{Name: fields[3], LanguageCodes: []string{fields[1]}}
+		switch {
+		case strings.HasSuffix(fields[2], "/M"):
+			v.Gender = GenderMale
+		case strings.HasSuffix(fields[2], "/F"):
+			v.Gender = GenderFemale
+		}
+		voices = append(voices, v)
+	}
+	return voices
+}
+
+// dbToRatio converts a gain in dB to an amplitude ratio.
+func dbToRatio(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// splitCommandLine splits s on spaces outside of single and double quotes.
+func splitCommandLine(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	for _, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			arg.WriteRune(c)
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.Errorf("unterminated quote in command %q", s)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
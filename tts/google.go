@@ -0,0 +1,122 @@
+package tts
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	texttospeech "cloud.google.com/go/texttospeech/apiv1"
+	"google.golang.org/api/option"
+	texttospeechpb "google.golang.org/genproto/googleapis/cloud/texttospeech/v1"
+)
+
+const (
+	timeout = time.Second * 10
+)
+
+var (
+	googleGenders = map[string]texttospeechpb.SsmlVoiceGender{
+		GenderMale:    texttospeechpb.SsmlVoiceGender_MALE,
+		GenderFemale:  texttospeechpb.SsmlVoiceGender_FEMALE,
+		GenderNeutral: texttospeechpb.SsmlVoiceGender_NEUTRAL,
+	}
+	googleEncodings = map[string]texttospeechpb.AudioEncoding{
+		"":              texttospeechpb.AudioEncoding_MP3,
+		EncodingMP3:     texttospeechpb.AudioEncoding_MP3,
+		EncodingOggOpus: texttospeechpb.AudioEncoding_OGG_OPUS,
+		EncodingWAV:     texttospeechpb.AudioEncoding_LINEAR16,
+	}
+	googleContentTypes = map[texttospeechpb.AudioEncoding]string{
+		texttospeechpb.AudioEncoding_MP3:      "audio/mpeg",
+		texttospeechpb.AudioEncoding_OGG_OPUS: "audio/ogg",
+		texttospeechpb.AudioEncoding_LINEAR16: "audio/wav",
+	}
+)
+
+// GoogleEngine synthesizes speech with Google Cloud Text-to-Speech, which
+// needs the api to be enabled for the service account's project.
+type GoogleEngine struct {
+	// ServiceAccountKey is the JSON key of the service account.
+	ServiceAccountKey []byte
+}
+
+func (e *GoogleEngine) client(ctx context.Context) (*texttospeech.Client, error) {
+	client, err := texttospeech.NewClient(ctx, option.WithCredentialsJSON(e.ServiceAccountKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create texttospeech client")
+	}
+	return client, nil
+}
+
+// Synthesize implements Engine, the audio is MP3 unless another encoding is
+// requested.
+func (e *GoogleEngine) Synthesize(ctx context.Context, r Request) (Audio, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := e.client(ctx)
+	if err != nil {
+		return Audio{}, err
+	}
+	defer client.Close()
+
+	input := &texttospeechpb.SynthesisInput{
+		InputSource: &texttospeechpb.SynthesisInput_Text{Text: r.Text},
+	}
+	if r.SSML {
+		input.InputSource = &texttospeechpb.SynthesisInput_Ssml{Ssml: r.Text}
+	}
+	gender := googleGenders[r.Gender]
+	if r.Gender == "" && r.Voice == "" {
+		gender = texttospeechpb.SsmlVoiceGender_NEUTRAL
+	}
+	encoding := googleEncodings[r.Encoding]
+	req := texttospeechpb.SynthesizeSpeechRequest{
+		Input: input,
+		Voice: &texttospeechpb.VoiceSelectionParams{
+			LanguageCode: r.LanguageCode,
+			Name:         r.Voice,
+			SsmlGender:   gender,
+		},
+		AudioConfig: &texttospeechpb.AudioConfig{
+			AudioEncoding: encoding,
+			SpeakingRate:  r.SpeakingRate,
+			Pitch:         r.Pitch,
+			VolumeGainDb:  r.VolumeGain,
+		},
+	}
+
+	resp, err := client.SynthesizeSpeech(ctx, &req)
+	if err != nil {
+		return Audio{}, errors.Wrap(err, "unable to synthesize speech")
+	}
+	return Audio{Data: resp.AudioContent, ContentType: googleContentTypes[encoding]}, nil
+}
+
+// Voices implements VoiceLister.
+func (e *GoogleEngine) Voices(ctx context.Context, languageCode string) ([]Voice, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	client, err := e.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	resp, err := client.ListVoices(ctx, &texttospeechpb.ListVoicesRequest{LanguageCode: languageCode})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list voices")
+	}
+	var voices []Voice
+	for _, v := range resp.Voices {
+		voices = append(voices, Voice{
+			Name:          v.Name,
+			LanguageCodes: v.LanguageCodes,
+			Gender:        strings.ToLower(texttospeechpb.SsmlVoiceGender_name[int32(v.SsmlGender)]),
+		})
+	}
+	return voices, nil
+}
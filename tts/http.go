@@ -0,0 +1,73 @@
+package tts
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPEngine synthesizes speech with a self-hosted text-to-speech server,
+// ie: OpenTTS, MaryTTS, Coqui TTS or a piper http server.
+//
+// If the url has the {text} placeholder, a GET request is made with the
+// placeholders replaced by their query escaped values, ie:
+// 'http://localhost:5500/api/tts?voice={voice}&text={text}'. Otherwise the
+// text is POSTed to the url as the plain text body. The placeholders are the
+// ones of CommandEngine, except that {voice} is empty if there is no voice
+// and there is no {output}. The audio is read from the response body.
+type HTTPEngine struct {
+	URL string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// Synthesize implements Engine.
+func (e *HTTPEngine) Synthesize(ctx context.Context, r Request) (Audio, error) {
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	u := r.placeholders(url.QueryEscape).Replace(e.URL)
+
+	var req *http.Request
+	var err error
+	if strings.Contains(e.URL, "{text}") {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(r.Text))
+		if req != nil {
+			req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		}
+	}
+	if err != nil {
+		return Audio{}, errors.Wrap(err, "invalid text-to-speech server url")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Audio{}, errors.Wrap(err, "unable to request speech")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Audio{}, errors.Wrap(err, "unable to read speech")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Audio{}, errors.Errorf("text-to-speech server returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	if len(data) == 0 {
+		return Audio{}, errors.New("text-to-speech server returned no audio")
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	if !strings.HasPrefix(contentType, "audio/") {
+		contentType = detectContentType(data)
+	}
+	return Audio{Data: data, ContentType: contentType}, nil
+}
@@ -0,0 +1,88 @@
+package tts
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// paragraphBreak is an empty line, which ends a sentence even without
+// punctuation, ie: after a heading.
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+// Split splits text into chunks of at most max bytes, so a long text can be
+// synthesized and played piece by piece. Whole sentences are kept together
+// in a chunk where possible, sentences longer than max are split between
+// words. Whitespace is collapsed to single spaces. If max is 0 or less the
+// text isn't split.
+func Split(text string, max int) []string {
+	var chunks []string
+	var chunk string
+	add := func(s string) {
+		if chunk != "" && max > 0 && len(chunk)+1+len(s) > max {
+			chunks = append(chunks, chunk)
+			chunk = ""
+		}
+		if chunk != "" {
+			chunk += " "
+		}
+		chunk += s
+	}
+	for _, sentence := range sentences(text) {
+		if max <= 0 || len(sentence) <= max {
+			add(sentence)
+			continue
+		}
+		for _, word := range strings.Fields(sentence) {
+			for len(word) > max {
+				n := cutIndex(word, max)
+				add(word[:n])
+				word = word[n:]
+			}
+			add(word)
+		}
+	}
+	if chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// sentences returns the sentences in text, with whitespace collapsed.
+func sentences(text string) []string {
+	var sentences []string
+	for _, paragraph := range paragraphBreak.Split(text, -1) {
+		var words []string
+		for _, word := range strings.Fields(paragraph) {
+			words = append(words, word)
+			if endsSentence(word) {
+				sentences = append(sentences, strings.Join(words, " "))
+				words = nil
+			}
+		}
+		if len(words) > 0 {
+			sentences = append(sentences, strings.Join(words, " "))
+		}
+	}
+	return sentences
+}
+
+// endsSentence returns whether the word ends with a full stop, question or
+// exclamation mark, possibly followed by closing quotes or brackets.
+func endsSentence(word string) bool {
+	word = strings.TrimRight(word, `"')]}»”’`)
+	r, _ := utf8.DecodeLastRuneInString(word)
+	return strings.ContainsRune(".!?…。！？", r)
+}
+
+// cutIndex returns the index of the last rune boundary in word at or before
+// max, or after the first rune if there is none.
+func cutIndex(word string, max int) int {
+	for n := max; n > 0; n-- {
+		if utf8.RuneStart(word[n]) {
+			return n
+		}
+	}
+	_, n := utf8.DecodeRuneInString(word)
+	return n
+}
@@ -1,45 +1,210 @@
+// Package tts turns text into speech with one of several engines, from
+// Google Cloud Text-to-Speech to local command line engines that work
+// offline.
 package tts
 
 import (
+	"bytes"
 	"context"
-	"time"
+	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
+)
 
-	texttospeech "cloud.google.com/go/texttospeech/apiv1"
-	"google.golang.org/api/option"
-	texttospeechpb "google.golang.org/genproto/googleapis/cloud/texttospeech/v1"
+// The engines New can create.
+const (
+	EngineGoogle    = "google"
+	EngineEspeakNG  = "espeak-ng"
+	EnginePiper     = "piper"
+	EnginePico2Wave = "pico2wave"
+	EngineCommand   = "command"
+	EngineHTTP      = "http"
 )
 
+// Engines are the names of the engines, in the order they are listed in help
+// texts.
+var Engines = []string{EngineGoogle, EngineEspeakNG, EnginePiper, EnginePico2Wave, EngineCommand, EngineHTTP}
+
+// The genders of voices.
 const (
-	timeout = time.Second * 10
+	GenderMale    = "male"
+	GenderFemale  = "female"
+	GenderNeutral = "neutral"
 )
 
-func Create(sentence string, serviceAccountKey []byte, languageCode string) ([]byte, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+// The audio encodings engines can be asked for.
+const (
+	EncodingMP3     = "mp3"
+	EncodingOggOpus = "ogg-opus"
+	EncodingWAV     = "wav"
+)
+
+// Request is the speech to synthesize.
+type Request struct {
+	Text string
+	// SSML is set if Text is SSML markup rather than plain text.
+	SSML bool
+	// LanguageCode is a BCP-47 language code, ie: 'en-US'.
+	LanguageCode string
+	// Voice is the name of the voice, what it is depends on the engine, ie:
+	// the model file for piper. The engine's default is used if it is empty.
+	Voice string
+	// Gender is one of the Gender constants, or empty for the engine's
+	// default.
+	Gender string
+	// SpeakingRate is the speed relative to the normal speed, from 0.25 to
+	// 4, ie: 0.8 is slower. 0 is the normal speed.
+	SpeakingRate float64
+	// Pitch is the change from the normal pitch in semitones, from -20 to
+	// 20.
+	Pitch float64
+	// VolumeGain is the change from the normal volume in dB, from -96 to 16.
+	VolumeGain float64
+	// Encoding is one of the Encoding constants, or empty for the engine's
+	// default. Engines that can only create one encoding ignore it.
+	Encoding string
+}
 
-	client, err := texttospeech.NewClient(ctx, option.WithCredentialsJSON(serviceAccountKey))
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to create texttospeech client")
+// Validate returns an error if a setting of the request is out of range.
+func (r Request) Validate() error {
+	switch r.Gender {
+	case "", GenderMale, GenderFemale, GenderNeutral:
+	default:
+		return errors.Errorf("unknown gender %q, use %s, %s or %s", r.Gender, GenderMale, GenderFemale, GenderNeutral)
+	}
+	switch r.Encoding {
+	case "", EncodingMP3, EncodingOggOpus, EncodingWAV:
+	default:
+		return errors.Errorf("unknown audio encoding %q, use %s, %s or %s", r.Encoding, EncodingMP3, EncodingOggOpus, EncodingWAV)
 	}
+	if r.SpeakingRate != 0 && (r.SpeakingRate < 0.25 || r.SpeakingRate > 4) {
+		return errors.Errorf("speaking rate %g is not between 0.25 and 4", r.SpeakingRate)
+	}
+	if r.Pitch < -20 || r.Pitch > 20 {
+		return errors.Errorf("pitch %g is not between -20 and 20", r.Pitch)
+	}
+	if r.VolumeGain < -96 || r.VolumeGain > 16 {
+		return errors.Errorf("volume gain %g is not between -96 and 16", r.VolumeGain)
+	}
+	return nil
+}
+
+// rate returns the speaking rate, with 0 as the normal speed.
+func (r Request) rate() float64 {
+	if r.SpeakingRate == 0 {
+		return 1
+	}
+	return r.SpeakingRate
+}
+
+// placeholders returns a replacer of the placeholders of the request, in
+// command lines and urls, with the values passed through escape. The extra
+// old, new pairs are replaced too.
+func (r Request) placeholders(escape func(string) string, extra ...string) *strings.Replacer {
+	oldnew := append([]string{
+		"{text}", escape(r.Text),
+		"{ssml}", escape(strconv.FormatBool(r.SSML)),
+		"{lang}", escape(r.LanguageCode),
+		"{voice}", escape(r.Voice),
+		"{gender}", escape(r.Gender),
+		"{rate}", escape(formatFloat(r.rate())),
+		"{pitch}", escape(formatFloat(r.Pitch)),
+		"{gain}", escape(formatFloat(r.VolumeGain)),
+		"{encoding}", escape(r.Encoding),
+	}, extra...)
+	return strings.NewReplacer(oldnew...)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Voice is a voice an engine can speak with.
+type Voice struct {
+	Name          string
+	LanguageCodes []string
+	// Gender is one of the Gender constants, or empty if it is unknown.
+	Gender string
+}
+
+// VoiceLister is implemented by engines that can list their voices.
+type VoiceLister interface {
+	// Voices returns the voices for the language, or all the voices if
+	// languageCode is empty.
+	Voices(ctx context.Context, languageCode string) ([]Voice, error)
+}
+
+// Audio is synthesized speech.
+type Audio struct {
+	Data []byte
+	// ContentType is the media type of Data, ie: 'audio/mpeg'.
+	ContentType string
+}
 
-	req := texttospeechpb.SynthesizeSpeechRequest{
-		Input: &texttospeechpb.SynthesisInput{
-			InputSource: &texttospeechpb.SynthesisInput_Text{Text: sentence},
-		},
-		Voice: &texttospeechpb.VoiceSelectionParams{
-			LanguageCode: languageCode,
-			SsmlGender:   texttospeechpb.SsmlVoiceGender_NEUTRAL,
-		},
-		AudioConfig: &texttospeechpb.AudioConfig{
-			AudioEncoding: texttospeechpb.AudioEncoding_MP3,
-		},
+// Engine synthesizes speech.
+type Engine interface {
+	Synthesize(ctx context.Context, req Request) (Audio, error)
+}
+
+// Config has the settings of every engine, only the ones of the engine that
+// is created are used.
+type Config struct {
+	// GoogleServiceAccountKey is the JSON key of the service account used
+	// by the google engine.
+	GoogleServiceAccountKey []byte
+	// Command is the command line run by the command engine, see
+	// CommandEngine.
+	Command string
+	// URL is the url of the server used by the http engine, see HTTPEngine.
+	URL string
+}
+
+// New returns the named engine.
+func New(name string, config Config) (Engine, error) {
+	switch name {
+	case EngineGoogle:
+		if len(config.GoogleServiceAccountKey) == 0 {
+			return nil, errors.New("the google engine needs a service account key")
+		}
+		return &GoogleEngine{ServiceAccountKey: config.GoogleServiceAccountKey}, nil
+	case EngineEspeakNG, EnginePiper, EnginePico2Wave:
+		return newPresetEngine(name), nil
+	case EngineCommand:
+		if config.Command == "" {
+			return nil, errors.New("the command engine needs a command to run")
+		}
+		return NewCommandEngine(config.Command)
+	case EngineHTTP:
+		if config.URL == "" {
+			return nil, errors.New("the http engine needs a server url")
+		}
+		return &HTTPEngine{URL: config.URL}, nil
+	default:
+		return nil, errors.Errorf("unknown text-to-speech engine %q, use one of %s", name, strings.Join(Engines, ", "))
 	}
+}
+
+// Create synthesizes the sentence as MP3 with Google Cloud Text-to-Speech.
+func Create(sentence string, serviceAccountKey []byte, languageCode string) ([]byte, error) {
+	e := &GoogleEngine{ServiceAccountKey: serviceAccountKey}
+	audio, err := e.Synthesize(context.Background(), Request{Text: sentence, LanguageCode: languageCode})
+	return audio.Data, err
+}
 
-	resp, err := client.SynthesizeSpeech(ctx, &req)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to synthesize speech")
+// detectContentType returns the media type of audio from its first bytes,
+// for engines that don't say what they return.
+func detectContentType(data []byte) string {
+	switch {
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE")):
+		return "audio/wav"
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) >= 2 && data[0] == 0xff && data[1]&0xe0 == 0xe0:
+		return "audio/mpeg"
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return "audio/ogg"
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return "audio/flac"
 	}
-	return resp.AudioContent, nil
+	return http.DetectContentType(data)
 }
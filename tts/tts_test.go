@@ -0,0 +1,309 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wav is the start of a WAV file, enough to be detected as one.
+const wav = "RIFF1234WAVEfmt "
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"espeak-ng --stdout -v {voice} {text}", []string{"espeak-ng", "--stdout", "-v", "{voice}", "{text}"}, false},
+		{`sh -c 'printf "%s" {text}'  x`, []string{"sh", "-c", `printf "%s" {text}`, "x"}, false},
+		{`say ""`, []string{"say", ""}, false},
+		{`say "unterminated`, nil, true},
+	}
+	for _, test := range tests {
+		got, err := splitCommandLine(test.line)
+		if (err != nil) != test.wantErr || fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("%q: expected %q (error %v), got %q (%v)", test.line, test.want, test.wantErr, got, err)
+		}
+	}
+}
+
+func TestCommandEngine(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	req := Request{Text: "hello world", LanguageCode: "en-US"}
+	tests := []struct {
+		name string
+		line string
+	}{
+		{"text argument to stdout", `sh -c 'printf "` + wav + `%s/%s" "$0" "$1"' {text} {voice}`},
+		{"stdin to stdout", `sh -c 'printf "` + wav + `"; cat; printf /{voice}'`},
+		{"text argument to output file", `sh -c 'printf "` + wav + `%s/%s" "$1" "$2" > "$0"' {output} {text} {lang}`},
+	}
+	for _, test := range tests {
+		e, err := NewCommandEngine(test.line)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		audio, err := e.Synthesize(context.Background(), req)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if want := wav + "hello world/en-US"; string(audio.Data) != want {
+			t.Errorf("%s: expected %q, got %q", test.name, want, audio.Data)
+		}
+		if audio.ContentType != "audio/wav" {
+			t.Errorf("%s: expected audio/wav, got %q", test.name, audio.ContentType)
+		}
+	}
+
+	e, _ := NewCommandEngine(`sh -c 'echo no voice >&2; exit 1'`)
+	if _, err := e.Synthesize(context.Background(), req); err == nil || !strings.Contains(err.Error(), "no voice") {
+		t.Errorf("expected the command's stderr in the error, got %v", err)
+	}
+}
+
+func TestHTTPEngine(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		text := r.URL.Query().Get("text")
+		if r.Method == http.MethodPost {
+			b, _ := ioutil.ReadAll(r.Body)
+			text = string(b)
+		}
+		if text == "" {
+			http.Error(w, "no text", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		fmt.Fprintf(w, "ID3%s/%s/%s", r.Method, r.URL.Query().Get("voice"), text)
+	}))
+	defer s.Close()
+
+	req := Request{Text: "dinner & drinks", Voice: "larynx:harvard", Gender: GenderFemale, SpeakingRate: 0.8}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{s.URL + "/api/tts?voice={voice}&text={text}", "ID3GET/larynx:harvard/dinner & drinks"},
+		{s.URL + "/api/tts?voice={voice}", "ID3POST/larynx:harvard/dinner & drinks"},
+		{s.URL + "/api/tts?voice={voice}:{rate}:{gender}", "ID3POST/larynx:harvard:0.8:female/dinner & drinks"},
+	}
+	for _, test := range tests {
+		audio, err := (&HTTPEngine{URL: test.url}).Synthesize(context.Background(), req)
+		if err != nil {
+			t.Errorf("%s: %v", test.url, err)
+			continue
+		}
+		if string(audio.Data) != test.want || audio.ContentType != "audio/mpeg" {
+			t.Errorf("%s: expected %q as audio/mpeg, got %q as %q", test.url, test.want, audio.Data, audio.ContentType)
+		}
+	}
+
+	if _, err := (&HTTPEngine{URL: s.URL}).Synthesize(context.Background(), Request{}); err == nil || !strings.Contains(err.Error(), "no text") {
+		t.Errorf("expected the server error, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(EngineGoogle, Config{}); err == nil {
+		t.Errorf("expected an error for the google engine without a service account key")
+	}
+	if _, err := New("festival", Config{}); err == nil {
+		t.Errorf("expected an error for an unknown engine")
+	}
+	e, err := New(EnginePico2Wave, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := e.(*CommandEngine); c.Name != "pico2wave" {
+		t.Errorf("expected the pico2wave command, got %q", c.Name)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		req     Request
+		wantErr bool
+	}{
+		{Request{}, false},
+		{Request{Gender: GenderFemale, SpeakingRate: 0.25, Pitch: -20, VolumeGain: 16, Encoding: EncodingOggOpus}, false},
+		{Request{Gender: "robot"}, true},
+		{Request{Encoding: "flac"}, true},
+		{Request{SpeakingRate: 0.1}, true},
+		{Request{SpeakingRate: -1}, true},
+		{Request{Pitch: 21}, true},
+		{Request{VolumeGain: -97}, true},
+	}
+	for _, test := range tests {
+		if err := test.req.Validate(); (err != nil) != test.wantErr {
+			t.Errorf("%+v: expected error %v, got %v", test.req, test.wantErr, err)
+		}
+	}
+}
+
+func TestPresetArgs(t *testing.T) {
+	tests := []struct {
+		engine string
+		req    Request
+		want   []string
+	}{
+		{EngineEspeakNG, Request{}, []string{"--stdout", "-v", "{voice}", "{text}"}},
+		{EngineEspeakNG, Request{SSML: true, Gender: GenderFemale, SpeakingRate: 0.8, Pitch: 4, VolumeGain: -6},
+			[]string{"--stdout", "-v", "{voice}+f3", "-m", "-s", "140", "-p", "60", "-a", "50", "{text}"}},
+		{EnginePiper, Request{Voice: "en_US-lessac-medium.onnx", SpeakingRate: 0.5}, []string{"--model", "{voice}", "--output_file", "{output}", "--length_scale", "2"}},
+		{EnginePico2Wave, Request{SpeakingRate: 0.8, Pitch: 12},
+			[]string{"-l", "{lang}", "-w", "{output}", `<pitch level="200"><speed level="80">{text}</speed></pitch>`}},
+	}
+	for _, test := range tests {
+		got, err := presetArgs[test.engine](test.req)
+		if err != nil || fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("%s %+v: expected %q, got %q (%v)", test.engine, test.req, test.want, got, err)
+		}
+	}
+	if _, err := piperArgs(Request{SSML: true}); err == nil {
+		t.Errorf("expected an error for SSML with piper")
+	}
+	// The language isn't a piper voice, so a missing voice fails before
+	// piper is run.
+	_, err := newPresetEngine(EnginePiper).Synthesize(context.Background(), Request{Text: "hello", LanguageCode: "en-US"})
+	if err == nil || err.Error() != "piper needs the model file as --voice" {
+		t.Errorf("expected an error for piper without a voice, got %v", err)
+	}
+}
+
+func TestParseEspeakVoices(t *testing.T) {
+	out := `Pty Language       Age/Gender VoiceName          File                 Other Languages
+ 2  en-gb           --/M      English_(Great_Britain) gmw/en           (en 2)
+ 5  en-us           --/F      English_(America)  gmw/en-US            (en 3)
+`
+	want := []Voice{
+		{Name: "English_(Great_Britain)", LanguageCodes: []string{"en-gb"}, Gender: GenderMale},
+		{Name: "English_(America)", LanguageCodes: []string{"en-us"}, Gender: GenderFemale},
+	}
+	if got := parseEspeakVoices([]byte(out)); fmt.Sprintf("%+v", got) != fmt.Sprintf("%+v", want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		text string
+		max  int
+		want []string
+	}{
+		{"  Hello   world.  ", 100, []string{"Hello world."}},
+		{"One. Two! Three? Four.", 10, []string{"One. Two!", "Three?", "Four."}},
+		{"He said \"stop.\" Then left.", 16, []string{`He said "stop."`, "Then left."}},
+		{"A heading\n\nThe text.", 9, []string{"A heading", "The text."}},
+		{"a very long sentence without an end", 12, []string{"a very long", "sentence", "without an", "end"}},
+		{"Supercalifragilistic", 8, []string{"Supercal", "ifragili", "stic"}},
+		{"ééééé", 3, []string{"é", "é", "é", "é", "é"}},
+		{"One. Two.", 0, []string{"One. Two."}},
+		{" \n ", 10, nil},
+	}
+	for _, test := range tests {
+		if got := Split(test.text, test.max); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", test.want) {
+			t.Errorf("%q (%d): expected %q, got %q", test.text, test.max, test.want, got)
+		}
+	}
+}
+
+// countingEngine returns the text as WAV audio, and counts its calls.
+type countingEngine struct {
+	calls int
+}
+
+func (e *countingEngine) Synthesize(ctx context.Context, r Request) (Audio, error) {
+	e.calls++
+	return Audio{Data: []byte(wav + r.Text), ContentType: "audio/wav"}, nil
+}
+
+func TestCachedEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast-tts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engine := &countingEngine{}
+	cached := NewCachedEngine(engine, "counting", filepath.Join(dir, "tts"), 0)
+	requests := []Request{
+		{Text: "hello"},
+		{Text: "hello"},
+		{Text: "hello", SpeakingRate: 0.8},
+		{Text: "world"},
+	}
+	for _, req := range requests {
+		audio, err := cached.Synthesize(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(audio.Data) != wav+req.Text || audio.ContentType != "audio/wav" {
+			t.Errorf("%+v: expected %q as audio/wav, got %q as %q", req, wav+req.Text, audio.Data, audio.ContentType)
+		}
+	}
+	if engine.calls != 3 {
+		t.Errorf("expected 3 calls to the engine, got %d", engine.calls)
+	}
+
+	other := NewCachedEngine(engine, "other", filepath.Join(dir, "tts"), 0)
+	if _, err := other.Synthesize(context.Background(), requests[0]); err != nil {
+		t.Fatal(err)
+	}
+	if engine.calls != 4 {
+		t.Errorf("expected the audio of another engine not to be used, got %d calls", engine.calls)
+	}
+}
+
+func TestCachedEngineEvictsLeastRecentlyUsed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-chromecast-tts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	engine := &countingEngine{}
+	// Room for two of the 17 byte audio files.
+	cached := NewCachedEngine(engine, "counting", dir, 40)
+	synthesize := func(text string, age time.Duration) {
+		if _, err := cached.Synthesize(context.Background(), Request{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+		filename, _ := cached.filename(Request{Text: text})
+		// Backdate the use, so the order doesn't depend on the clock.
+		used := time.Now().Add(-age)
+		os.Chtimes(filename, used, used)
+	}
+	synthesize("a", 3*time.Minute)
+	synthesize("b", 2*time.Minute)
+	// Using a makes b the least recently used.
+	synthesize("a", time.Minute)
+	synthesize("c", 0)
+	if engine.calls != 3 {
+		t.Fatalf("expected 3 calls to the engine, got %d", engine.calls)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("expected 2 cached files, got %d", len(files))
+	}
+	for text, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		filename, _ := cached.filename(Request{Text: text})
+		if _, err := os.Stat(filename); (err == nil) != want {
+			t.Errorf("%q: expected cached %v, got %v", text, want, err == nil)
+		}
+	}
+}